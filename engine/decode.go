@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/engine/internal"
+	"github.com/janderland/fql/engine/trace"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/keyval/values"
+)
+
+// DecodeKey converts the raw bytes of an FDB key into a [keyval.Key]. The
+// directory containing the key is found by looking up the key's prefix in
+// the directory layer via [facade.ReadTransaction.DirFind]. The remainder
+// of the key is unpacked as a tuple. If no directory contains the key, or
+// the remainder isn't a valid tuple, the key is returned with a raw prefix
+// instead. The raw prefix is the shortest prefix of the key after which
+// the rest of the key unpacks as a tuple.
+func (x *Engine) DecodeKey(key []byte) (_ keyval.Key, err error) {
+	_, span := x.startSpan(context.Background(), "DecodeKey", trace.String("fql.key", hex.EncodeToString(key)))
+	defer func() { endSpan(span, err) }()
+
+	out, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		x.log.Log().Bytes("key", key).Msg("decoding key")
+
+		dir, err := tr.DirFind(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find directory")
+		}
+		if dir == nil {
+			return nil, nil
+		}
+
+		tup, err := values.UnpackTuple(key[len(dir.Bytes()):])
+		if err != nil {
+			x.log.Log().Err(err).Strs("dir", dir.GetPath()).Msg("key within directory isn't a tuple")
+			return nil, nil
+		}
+		return &keyval.Key{
+			Directory: convert.FromStringArray(dir.GetPath()),
+			Tuple:     convert.FromFDBTuple(tup),
+		}, nil
+	})
+	if err != nil {
+		return keyval.Key{}, errors.Wrap(err, "transaction failed")
+	}
+	if out, ok := out.(*keyval.Key); ok && out != nil {
+		return *out, nil
+	}
+
+	// Every key has a tuple suffix because the
+	// empty byte string unpacks as an empty tuple.
+	for i := 0; i <= len(key); i++ {
+		tup, err := values.UnpackTuple(key[i:])
+		if err != nil {
+			continue
+		}
+		return keyval.Key{
+			Directory: convert.FromRawPrefix(append([]byte(nil), key[:i]...)),
+			Tuple:     convert.FromFDBTuple(tup),
+		}, nil
+	}
+	return keyval.Key{}, errors.New("failed to unpack key")
+}
+
+// DecodeValue converts the raw bytes of an FDB value into a [keyval.Value].
+// The value is decoded as the first of the given variable's types which
+// succeeds. If the variable is empty, the value is returned as [keyval.Bytes].
+// If the value cannot be decoded as any of the types, an error is returned.
+func (x *Engine) DecodeValue(value []byte, valueType keyval.Variable) (keyval.Value, error) {
+	valHandler, err := internal.NewValueHandler(valueType, x.order, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to init value handler")
+	}
+
+	// The value handler treats nil as a missing
+	// value, but here it's an empty byte string.
+	if value == nil {
+		value = []byte{}
+	}
+
+	out, err := valHandler.Handle(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack value")
+	}
+	return out, nil
+}
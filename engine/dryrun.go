@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/class"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/parser/format"
+)
+
+// MutationKind specifies which FDB operation a [Mutation] would perform.
+type MutationKind string
+
+const (
+	MutationSet            MutationKind = "set"
+	MutationSetVStampKey   MutationKind = "set versionstamped key"
+	MutationSetVStampValue MutationKind = "set versionstamped value"
+	MutationClear          MutationKind = "clear"
+)
+
+// Mutation describes a write which an [Engine] in dry-run mode would
+// have performed. Mutations are passed to the function given to
+// [DryRun] or [Engine.WithDryRun].
+type Mutation struct {
+	// Query is the query which produced the mutation.
+	Query keyval.KeyValue
+
+	// Kind specifies which FDB operation would be performed.
+	Kind MutationKind
+
+	// NewDirectories contains the paths of the directories which
+	// would be created by the write, starting with the outermost
+	// missing ancestor & ending with the query's directory. If
+	// nil, the directory exists.
+	NewDirectories [][]string
+
+	// Prefix is the prefix of the query's directory or the
+	// query's raw prefix. If the directory would be created,
+	// its prefix isn't allocated yet so Prefix is nil.
+	Prefix []byte
+
+	// Key is the packed key. If the directory would be created,
+	// Key only contains the packed tuple. For versionstamped
+	// keys, Key ends with the 4-byte offset of the placeholder.
+	Key []byte
+
+	// Value is the packed value. For versionstamped values,
+	// Value ends with the 4-byte offset of the placeholder.
+	Value []byte
+
+	// VStampOffset is the offset of the versionstamp placeholder
+	// within Key or Value, as specified by Kind. If the mutation
+	// doesn't contain a versionstamp, VStampOffset is -1.
+	VStampOffset int
+}
+
+// DryRun enables dry-run mode. In dry-run mode, write queries
+// are described by passing a [Mutation] to the given function
+// instead of being performed. Directories are opened read-only.
+// This method must not be called concurrently with other methods.
+func DryRun(f func(Mutation)) Option {
+	return func(eg *Engine) {
+		eg.dryRun = f
+	}
+}
+
+// WithDryRun returns a copy of the Engine in dry-run mode, as
+// described by [DryRun]. If the given function is nil, the copy
+// performs writes normally.
+func (x *Engine) WithDryRun(f func(Mutation)) Engine {
+	return Engine{
+		tr:      x.tr,
+		log:     x.log,
+		order:   x.order,
+		dryRun:  f,
+		metrics: x.metrics,
+		tracer:  x.tracer,
+		span:    x.span,
+	}
+}
+
+func (x *Engine) drySet(query keyval.KeyValue, queryClass class.Class, space keySpace, valueBytes []byte) error {
+	mut := Mutation{
+		Query:        query,
+		Value:        valueBytes,
+		VStampOffset: -1,
+	}
+
+	_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		x.log.Log().Interface("query", query).Msg("dry-run setting")
+
+		prefix, exists, err := x.dryOpen(tr, space)
+		if err != nil {
+			return nil, err
+		}
+		mut.Prefix = prefix
+		mut.NewDirectories = nil
+		if !exists {
+			mut.NewDirectories, err = missingDirs(tr, space.path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		tup, err := convert.ToFDBTuple(query.Key.Tuple)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+		}
+
+		switch queryClass {
+		case class.VStampKey:
+			mut.Kind = MutationSetVStampKey
+			mut.Key, err = tup.PackWithVersionstamp(prefix)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to pack key")
+			}
+			mut.VStampOffset = vstampOffset(mut.Key)
+
+		case class.VStampVal:
+			mut.Kind = MutationSetVStampValue
+			mut.Key = append(prefix, tup.Pack()...)
+			mut.VStampOffset = vstampOffset(mut.Value)
+
+		case class.Constant:
+			mut.Kind = MutationSet
+			mut.Key = append(prefix, tup.Pack()...)
+
+		default:
+			return nil, errors.Errorf("invalid query class %s", queryClass)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "transaction failed")
+	}
+
+	x.dryRun(mut)
+	return nil
+}
+
+func (x *Engine) dryClear(query keyval.KeyValue, space keySpace) error {
+	var mut *Mutation
+	_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		x.log.Log().Interface("query", query).Msg("dry-run clearing")
+
+		prefix, exists, err := x.dryOpen(tr, space)
+		if err != nil {
+			return nil, err
+		}
+
+		// Clearing a key in a non-existent directory
+		// doesn't perform a write, so there is no
+		// mutation to describe.
+		mut = nil
+		if !exists {
+			return nil, nil
+		}
+
+		tup, err := convert.ToFDBTuple(query.Key.Tuple)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+		}
+
+		mut = &Mutation{
+			Query:        query,
+			Kind:         MutationClear,
+			Prefix:       prefix,
+			Key:          append(prefix, tup.Pack()...),
+			VStampOffset: -1,
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "transaction failed")
+	}
+
+	if mut != nil {
+		x.dryRun(*mut)
+	}
+	return nil
+}
+
+// dryOpen returns a copy of the prefix of the given keySpace. If the
+// keys are stored under a directory which doesn't exist, a nil prefix
+// is returned along with exists set to false.
+func (x *Engine) dryOpen(tr facade.ReadTransaction, space keySpace) (prefix []byte, exists bool, err error) {
+	dir, err := x.open(tr, space)
+	if err != nil {
+		if errors.Is(err, directory.ErrDirNotExists) {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrap(err, "failed to open directory")
+	}
+	return append([]byte(nil), dir.Bytes()...), true, nil
+}
+
+// missingDirs returns the paths of the directories which would be
+// created along with the directory at the given path, which must not
+// exist. The paths start with the outermost missing ancestor & end
+// with the given path.
+func missingDirs(tr facade.ReadTransaction, path []string) ([][]string, error) {
+	dirs := [][]string{path}
+	for i := len(path) - 1; i > 0; i-- {
+		_, err := tr.DirOpen(path[:i])
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, directory.ErrDirNotExists) {
+			return nil, errors.Wrap(err, "failed to open directory")
+		}
+		dirs = append([][]string{append([]string(nil), path[:i]...)}, dirs...)
+	}
+	return dirs, nil
+}
+
+// vstampOffset decodes the 4-byte, little-endian offset which the
+// FDB bindings append to versionstamped keys & values.
+func vstampOffset(packed []byte) int {
+	if len(packed) < 4 {
+		return -1
+	}
+	return int(binary.LittleEndian.Uint32(packed[len(packed)-4:]))
+}
+
+// Lines formats the Mutation as human-readable lines of text.
+// The given format.Format is used to format the query.
+func (x *Mutation) Lines(f format.Format) []string {
+	var lines []string
+
+	f.Reset()
+	f.KeyValue(x.Query)
+	lines = append(lines, "query: "+f.String())
+	lines = append(lines, "operation: "+string(x.Kind))
+
+	if x.NewDirectories != nil {
+		for _, path := range x.NewDirectories {
+			f.Reset()
+			f.Directory(convert.FromStringArray(path))
+			lines = append(lines, "create directory: "+f.String())
+		}
+		lines = append(lines, "prefix: not allocated, key excludes prefix")
+	} else {
+		lines = append(lines, "prefix: 0x"+hex.EncodeToString(x.Prefix))
+	}
+
+	lines = append(lines, "key: 0x"+hex.EncodeToString(x.Key))
+	if x.Kind != MutationClear {
+		lines = append(lines, "value: 0x"+hex.EncodeToString(x.Value))
+	}
+
+	if x.VStampOffset >= 0 {
+		target := "key"
+		if x.Kind == MutationSetVStampValue {
+			target = "value"
+		}
+		lines = append(lines, fmt.Sprintf("versionstamp offset: %d in %s", x.VStampOffset, target))
+	}
+	return lines
+}
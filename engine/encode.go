@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/keyval/values"
+)
+
+// EncodeKey converts a [keyval.Key] into the raw bytes of an FDB key. It's the
+// inverse of [Engine.DecodeKey]. The key's directory must exist & the key must
+// not contain a [keyval.Variable] or [keyval.MaybeMore].
+func (x *Engine) EncodeKey(key keyval.Key) (_ []byte, err error) {
+	_, span := x.startSpan(context.Background(), "EncodeKey", x.queryAttrs(key)...)
+	defer func() { endSpan(span, err) }()
+
+	space, err := newKeySpace(key.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert directory to string array")
+	}
+	tup, err := convert.ToFDBTuple(key.Tuple)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert tuple to FDB tuple")
+	}
+
+	out, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		dir, err := x.open(tr, space)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open directory")
+		}
+		return dir, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return out.(subspace.Subspace).Pack(tup), nil
+}
+
+// EncodeValue converts a [keyval.Value] into the raw bytes of an FDB
+// value using the Engine's byte order. It's the inverse of
+// [Engine.DecodeValue]. The value must not contain a [keyval.Variable].
+func (x *Engine) EncodeValue(value keyval.Value) ([]byte, error) {
+	out, err := values.Pack(value, x.order, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack value")
+	}
+	return out, nil
+}
@@ -4,19 +4,24 @@ package engine
 import (
 	"context"
 	"encoding/binary"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/janderland/fql/engine/facade"
 	"github.com/janderland/fql/engine/internal"
+	"github.com/janderland/fql/engine/metrics"
 	"github.com/janderland/fql/engine/stream"
+	"github.com/janderland/fql/engine/trace"
 	"github.com/janderland/fql/keyval"
 	"github.com/janderland/fql/keyval/class"
 	"github.com/janderland/fql/keyval/convert"
 	"github.com/janderland/fql/keyval/values"
+	"github.com/janderland/fql/parser/format"
 )
 
 // SingleOpts configures how an [Engine.ReadSingle] call is executed.
@@ -47,16 +52,25 @@ type Option func(*Engine)
 // will fail if a query of the wrong class in provided. Unless [Engine.Transact]
 // is used, each query is executed in its own transaction.
 type Engine struct {
-	tr    facade.Transactor
-	log   zerolog.Logger
-	order binary.ByteOrder
+	tr      facade.Transactor
+	log     zerolog.Logger
+	order   binary.ByteOrder
+	dryRun  func(Mutation)
+	metrics metrics.Collector
+	tracer  trace.Tracer
+
+	// span is the span of the transaction
+	// created by [Engine.Transact], if any.
+	span trace.Span
 }
 
 func New(tr facade.Transactor, opts ...Option) Engine {
 	eg := Engine{
-		tr:    tr,
-		log:   zerolog.Nop(),
-		order: binary.BigEndian,
+		tr:      tr,
+		log:     zerolog.Nop(),
+		order:   binary.BigEndian,
+		metrics: metrics.Nop(),
+		tracer:  trace.Nop(),
 	}
 	for _, option := range opts {
 		option(&eg)
@@ -80,22 +94,82 @@ func ByteOrder(order binary.ByteOrder) Option {
 	}
 }
 
+// Metrics configures the collector which receives the metrics of the
+// queries executed by the Engine. This includes the transactions &
+// their retries, the directories opened, the keys scanned & returned,
+// and the bytes read & written. Range-reads also report the time taken
+// by each stage of their pipeline. This method must not be called
+// concurrently with other methods.
+func Metrics(c metrics.Collector) Option {
+	return func(eg *Engine) {
+		eg.metrics = c
+	}
+}
+
+// Tracer configures the tracer which receives a span for each call to
+// the Engine's methods. Range-reads & directory queries also produce a
+// child span for each stage of their pipeline. If the context given to
+// a method contains a span, the method's span is its child. This method
+// must not be called concurrently with other methods.
+func Tracer(t trace.Tracer) Option {
+	return func(eg *Engine) {
+		eg.tracer = t
+	}
+}
+
+// TxOpts configures the transactions created by the Engine. This
+// method must not be called concurrently with other methods.
+func TxOpts(opts facade.TxOpts) Option {
+	return func(eg *Engine) {
+		eg.tr = eg.tr.WithTxOpts(opts)
+	}
+}
+
+// WithTxOpts returns a copy of the Engine whose transactions are configured
+// by the given options, replacing any options previously configured. This
+// allows options to be specified per query. If called on an Engine created
+// by [Engine.Transact], the options are applied to the ongoing transaction.
+func (x *Engine) WithTxOpts(opts facade.TxOpts) Engine {
+	return Engine{
+		tr:      x.tr.WithTxOpts(opts),
+		log:     x.log,
+		order:   x.order,
+		dryRun:  x.dryRun,
+		metrics: x.metrics,
+		tracer:  x.tracer,
+		span:    x.span,
+	}
+}
+
 // Transact wraps a group of Engine method calls under a single transaction. The newly
-// created Engine inherits the logger & byte order of the parent engine. Any changes to
-// the logger or byte order of the new Engine has no effect on the parent Engine.
-func (x *Engine) Transact(f func(Engine) (interface{}, error)) (interface{}, error) {
-	return x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+// created Engine inherits the logger, byte order, dry-run mode, metrics collector, & tracer
+// of the parent engine. Any changes to these properties of the new Engine has no effect on
+// the parent Engine. The spans of the new Engine's method calls are children of the
+// transaction's span.
+func (x *Engine) Transact(f func(Engine) (interface{}, error)) (_ interface{}, err error) {
+	_, span := x.startSpan(context.Background(), "Transact")
+	defer func() { endSpan(span, err) }()
+
+	return x.transact(func(tr facade.Transaction) (interface{}, error) {
 		return f(Engine{
-			tr:    tr,
-			log:   x.log,
-			order: x.order,
+			tr:      tr,
+			log:     x.log,
+			order:   x.order,
+			dryRun:  x.dryRun,
+			metrics: x.metrics,
+			tracer:  x.tracer,
+			span:    span,
 		})
 	})
 }
 
 // Set preforms a write operation for a single key-value. The given query must
-// belong to [class.Constant].
-func (x *Engine) Set(query keyval.KeyValue) error {
+// belong to [class.Constant], [class.VStampKey], or [class.VStampVal]. In
+// dry-run mode, the write is described instead of performed.
+func (x *Engine) Set(query keyval.KeyValue) (err error) {
+	_, span := x.startSpan(context.Background(), "Set", x.queryAttrs(query)...)
+	defer func() { endSpan(span, err) }()
+
 	queryClass := class.Classify(query)
 	switch queryClass {
 	case class.Constant, class.VStampKey, class.VStampVal:
@@ -104,7 +178,7 @@ func (x *Engine) Set(query keyval.KeyValue) error {
 		return errors.Errorf("invalid query class %s", queryClass)
 	}
 
-	path, err := convert.ToStringArray(query.Key.Directory)
+	space, err := newKeySpace(query.Key.Directory)
 	if err != nil {
 		return errors.Wrap(err, "failed to convert directory to string array")
 	}
@@ -114,10 +188,14 @@ func (x *Engine) Set(query keyval.KeyValue) error {
 		return errors.Wrap(err, "failed to pack value")
 	}
 
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	if x.dryRun != nil {
+		return x.drySet(query, queryClass, space, valueBytes)
+	}
+
+	keyLen, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("setting")
 
-		dir, err := tr.DirCreateOrOpen(path)
+		dir, err := x.createOrOpen(tr, space)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to open directory")
 		}
@@ -135,39 +213,53 @@ func (x *Engine) Set(query keyval.KeyValue) error {
 			}
 
 			tr.SetWithVStampKey(fdb.Key(keyBytes), valueBytes)
-			return nil, nil
+			return len(keyBytes), nil
 
 		case class.VStampVal:
-			tr.SetWithVStampValue(dir.Pack(tup), valueBytes)
-			return nil, nil
+			key := dir.Pack(tup)
+			tr.SetWithVStampValue(key, valueBytes)
+			return len(key), nil
 
 		case class.Constant:
-			tr.Set(dir.Pack(tup), valueBytes)
-			return nil, nil
+			key := dir.Pack(tup)
+			tr.Set(key, valueBytes)
+			return len(key), nil
 
 		default:
 			return nil, errors.Errorf("invalid query class %s", queryClass)
 		}
 	})
-	return errors.Wrap(err, "transaction failed")
+	if err != nil {
+		return errors.Wrap(err, "transaction failed")
+	}
+	x.metrics.Add(metrics.BytesWritten, float64(keyLen.(int)+len(valueBytes)))
+	return nil
 }
 
 // Clear performs a clear operation for a single key-value. The given query
-// must belong to [class.Clear].
-func (x *Engine) Clear(query keyval.KeyValue) error {
+// must belong to [class.Clear]. In dry-run mode, the clear is described
+// instead of performed.
+func (x *Engine) Clear(query keyval.KeyValue) (err error) {
+	_, span := x.startSpan(context.Background(), "Clear", x.queryAttrs(query)...)
+	defer func() { endSpan(span, err) }()
+
 	if class.Classify(query) != class.Clear {
 		return errors.New("query not clear class")
 	}
 
-	path, err := convert.ToStringArray(query.Key.Directory)
+	space, err := newKeySpace(query.Key.Directory)
 	if err != nil {
 		return errors.Wrap(err, "failed to convert directory to string array")
 	}
 
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	if x.dryRun != nil {
+		return x.dryClear(query, space)
+	}
+
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("clearing")
 
-		dir, err := tr.DirOpen(path)
+		dir, err := x.open(tr, space)
 		if err != nil {
 			if errors.Is(err, directory.ErrDirNotExists) {
 				return nil, nil
@@ -188,12 +280,22 @@ func (x *Engine) Clear(query keyval.KeyValue) error {
 
 // ReadSingle performs a read operation for a single key-value. The given query must
 // belong to [class.ReadSingle].
-func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.KeyValue, error) {
+func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (out *keyval.KeyValue, err error) {
+	_, span := x.startSpan(context.Background(), "ReadSingle", x.queryAttrs(query)...)
+	defer func() {
+		results := 0
+		if out != nil {
+			results = 1
+		}
+		span.SetAttributes(trace.Int("fql.results", results))
+		endSpan(span, err)
+	}()
+
 	if class.Classify(query) != class.ReadSingle {
 		return nil, errors.New("query not single-read class")
 	}
 
-	path, err := convert.ToStringArray(query.Key.Directory)
+	space, err := newKeySpace(query.Key.Directory)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert directory to string array")
 	}
@@ -203,11 +305,14 @@ func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.Key
 		return nil, errors.Wrap(err, "failed to init value handler")
 	}
 
-	var valBytes []byte
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	var (
+		keyBytes fdb.Key
+		valBytes []byte
+	)
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("single reading")
 
-		dir, err := tr.DirOpen(path)
+		dir, err := x.open(tr, space)
 		if err != nil {
 			if errors.Is(err, directory.ErrDirNotExists) {
 				return nil, nil
@@ -220,12 +325,17 @@ func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.Key
 			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
 		}
 
-		valBytes = tr.Get(dir.Pack(tup)).MustGet()
+		keyBytes = dir.Pack(tup)
+		valBytes = tr.Get(keyBytes).MustGet()
 		return nil, nil
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "transaction failed")
 	}
+	if valBytes != nil {
+		x.metrics.Add(metrics.KeysScanned, 1)
+		x.metrics.Add(metrics.BytesRead, float64(len(keyBytes)+len(valBytes)))
+	}
 
 	value, err := valHandler.Handle(valBytes)
 	if err != nil {
@@ -234,6 +344,7 @@ func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.Key
 	if value == nil {
 		return nil, nil
 	}
+	x.metrics.Add(metrics.KeysReturned, 1)
 	return &keyval.KeyValue{
 		Key:   query.Key,
 		Value: value,
@@ -252,24 +363,39 @@ func (x *Engine) ReadRange(ctx context.Context, query keyval.KeyValue, opts Rang
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order))
+		ctx, span := x.startSpan(ctx, "ReadRange", x.queryAttrs(query)...)
+		results := 0
+		var err error
+		defer func() {
+			span.SetAttributes(trace.Int("fql.results", results))
+			endSpan(span, err)
+		}()
+
+		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order), stream.Metrics(x.metrics), stream.Tracer(x.tracer))
 
 		if class.Classify(query) != class.ReadRange {
-			s.SendKV(out, stream.KeyValErr{Err: errors.New("query not range-read class")})
+			err = errors.New("query not range-read class")
+			s.SendKV(out, stream.KeyValErr{Err: err})
 			return
 		}
 
-		_, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		_, err = x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
 			stage1 := s.OpenDirectories(tr, query.Key.Directory)
 			stage2 := s.ReadRange(tr, query.Key.Tuple, opts.forStream(), stage1)
 			stage3 := s.UnpackKeys(query.Key.Tuple, opts.Filter, stage2)
 			for kve := range s.UnpackValues(query.Value, opts.Filter, stage3) {
+				if kve.Err != nil {
+					span.RecordError(kve.Err)
+				} else {
+					results++
+				}
 				s.SendKV(out, kve)
 			}
 			return nil, nil
 		})
 		if err != nil {
-			s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "transaction failed")})
+			err = errors.Wrap(err, "transaction failed")
+			s.SendKV(out, stream.KeyValErr{Err: err})
 		}
 	}()
 
@@ -290,16 +416,36 @@ func (x *Engine) Directories(ctx context.Context, query keyval.Directory) chan s
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		s := stream.New(ctx, stream.Logger(x.log))
+		ctx, span := x.startSpan(ctx, "Directories", x.queryAttrs(query)...)
+		results := 0
+		var err error
+		defer func() {
+			span.SetAttributes(trace.Int("fql.results", results))
+			endSpan(span, err)
+		}()
+
+		s := stream.New(ctx, stream.Logger(x.log), stream.Metrics(x.metrics), stream.Tracer(x.tracer))
+
+		if _, ok := convert.ToRawPrefix(query); ok {
+			err = errors.New("raw prefixes cannot be used as directory queries")
+			s.SendDir(out, stream.DirErr{Err: err})
+			return
+		}
 
-		_, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		_, err = x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
 			for dir := range s.OpenDirectories(tr, query) {
+				if dir.Err != nil {
+					span.RecordError(dir.Err)
+				} else {
+					results++
+				}
 				s.SendDir(out, dir)
 			}
 			return nil, nil
 		})
 		if err != nil {
-			s.SendDir(out, stream.DirErr{Err: errors.Wrap(err, "transaction failed")})
+			err = errors.Wrap(err, "transaction failed")
+			s.SendDir(out, stream.DirErr{Err: err})
 		}
 	}()
 
@@ -308,21 +454,24 @@ func (x *Engine) Directories(ctx context.Context, query keyval.Directory) chan s
 
 // Watch monitors a single key-value for changes. The given query must belong to [class.ReadSingle].
 // The method creates a watch and returns a FutureNil that will become ready when the key's value changes.
-func (x *Engine) Watch(query keyval.KeyValue) (fdb.FutureNil, error) {
+func (x *Engine) Watch(query keyval.KeyValue) (_ fdb.FutureNil, err error) {
+	_, span := x.startSpan(context.Background(), "Watch", x.queryAttrs(query)...)
+	defer func() { endSpan(span, err) }()
+
 	if class.Classify(query) != class.ReadSingle {
 		return nil, errors.New("query not single-read class")
 	}
 
-	path, err := convert.ToStringArray(query.Key.Directory)
+	space, err := newKeySpace(query.Key.Directory)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert directory to string array")
 	}
 
 	var watch fdb.FutureNil
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("watching")
 
-		dir, err := tr.DirOpen(path)
+		dir, err := x.open(tr, space)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to open directory")
 		}
@@ -341,3 +490,235 @@ func (x *Engine) Watch(query keyval.KeyValue) (fdb.FutureNil, error) {
 
 	return watch, nil
 }
+
+// CreateDirectory creates a directory tagged with the given layer. The given query must not
+// contain a [keyval.Variable] or raw prefix. If the directory already exists, an error is
+// returned. Partitions are created by passing [facade.PartitionLayer] as the layer, though
+// [Engine.CreatePartition] is more convenient. Directories cannot be created in dry-run mode.
+func (x *Engine) CreateDirectory(query keyval.Directory, layer []byte) (_ directory.DirectorySubspace, err error) {
+	_, span := x.startSpan(context.Background(), "CreateDirectory", append(x.queryAttrs(query), trace.String("fql.layer", string(layer)))...)
+	defer func() { endSpan(span, err) }()
+
+	if x.dryRun != nil {
+		return nil, errors.New("directories cannot be created in dry-run mode")
+	}
+
+	path, err := convert.ToStringArray(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	dir, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Strs("path", path).Bytes("layer", layer).Msg("creating directory")
+
+		x.metrics.Add(metrics.DirectoryOpens, 1, metrics.Label{Name: "op", Value: "create"})
+		dir, err := tr.DirCreate(path, layer)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create directory")
+		}
+		return dir, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+// CreatePartition creates a directory partition. Subdirectories of a partition have their
+// prefixes allocated within the partition's prefix. The root of a partition cannot contain
+// key-values. The given query must not contain a [keyval.Variable] or raw prefix.
+func (x *Engine) CreatePartition(query keyval.Directory) (directory.DirectorySubspace, error) {
+	return x.CreateDirectory(query, []byte(facade.PartitionLayer))
+}
+
+// Move moves a directory, along with its key-values & subdirectories, to a new path. Neither
+// path may contain a [keyval.Variable] or raw prefix. The destination must not exist, though
+// its parent directory must. Directories cannot be moved between partitions or in dry-run mode.
+func (x *Engine) Move(query keyval.Move) (_ directory.DirectorySubspace, err error) {
+	_, span := x.startSpan(context.Background(), "Move", x.queryAttrs(query)...)
+	defer func() { endSpan(span, err) }()
+
+	if x.dryRun != nil {
+		return nil, errors.New("directories cannot be moved in dry-run mode")
+	}
+
+	from, err := convert.ToStringArray(query.From)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert source directory to string array")
+	}
+	to, err := convert.ToStringArray(query.To)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert destination directory to string array")
+	}
+
+	dir, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Strs("from", from).Strs("to", to).Msg("moving directory")
+
+		dir, err := tr.DirMove(from, to)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to move directory")
+		}
+		return dir, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+// transact executes the given function within a write transaction &
+// records the transaction's metrics. If the Engine was created by
+// [Engine.Transact], the metrics are recorded by the parent Engine.
+func (x *Engine) transact(f func(facade.Transaction) (interface{}, error)) (interface{}, error) {
+	if _, ok := x.tr.(facade.Transaction); ok {
+		return x.tr.Transact(f)
+	}
+
+	start := time.Now()
+	attempts := 0
+	out, err := x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		attempts++
+		return f(tr)
+	})
+	x.observeTx("write", start, attempts)
+	return out, err
+}
+
+// readTransact executes the given function within a read transaction
+// & records the transaction's metrics. If the Engine was created by
+// [Engine.Transact], the metrics are recorded by the parent Engine.
+func (x *Engine) readTransact(f func(facade.ReadTransaction) (interface{}, error)) (interface{}, error) {
+	if _, ok := x.tr.(facade.ReadTransaction); ok {
+		return x.tr.ReadTransact(f)
+	}
+
+	start := time.Now()
+	attempts := 0
+	out, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		attempts++
+		return f(tr)
+	})
+	x.observeTx("read", start, attempts)
+	return out, err
+}
+
+func (x *Engine) observeTx(kind string, start time.Time, attempts int) {
+	label := metrics.Label{Name: "kind", Value: kind}
+	metrics.Since(x.metrics, metrics.TransactionSeconds, start, label)
+	x.metrics.Add(metrics.Transactions, 1, label)
+	if attempts > 1 {
+		x.metrics.Add(metrics.TransactionRetries, float64(attempts-1), label)
+	}
+}
+
+// startSpan begins a span describing a call to the given method. If the
+// given context doesn't contain a span & the Engine was created by
+// [Engine.Transact], the new span is a child of the transaction's span.
+func (x *Engine) startSpan(ctx context.Context, method string, attrs ...trace.Attr) (context.Context, trace.Span) {
+	if x.span != nil && trace.SpanFromContext(ctx) == nil {
+		ctx = trace.ContextWithSpan(ctx, x.span)
+	}
+	return x.tracer.Start(ctx, "engine."+method, attrs...)
+}
+
+// endSpan records the given error, if any, & ends the span.
+func endSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.End()
+}
+
+// queryAttrs returns the span attributes describing the given query:
+// its text, its class, & the path of its directory. If the Engine
+// has no tracer, the query isn't formatted & nil is returned.
+func (x *Engine) queryAttrs(query keyval.Query) []trace.Attr {
+	if trace.IsNop(x.tracer) {
+		return nil
+	}
+	attrs := []trace.Attr{trace.String("fql.query", format.Sprint(func(f *format.Format) { f.Query(query) }))}
+
+	var dir keyval.Directory
+	switch query := query.(type) {
+	case keyval.Directory:
+		dir = query
+	case keyval.Move:
+		dir = query.From
+		attrs = append(attrs, trace.String("fql.destination", format.Sprint(func(f *format.Format) { f.Directory(query.To) })))
+	case keyval.Key:
+		dir = query.Directory
+	case keyval.KeyValue:
+		dir = query.Key.Directory
+		attrs = append(attrs, trace.String("fql.class", string(class.Classify(query))))
+	}
+	return append(attrs, trace.String("fql.directory", format.Sprint(func(f *format.Format) { f.Directory(dir) })))
+}
+
+// open returns the subspace containing the keys of the given keySpace,
+// as described by [keySpace.open], & records the directory opened.
+func (x *Engine) open(tr facade.ReadTransactor, space keySpace) (subspace.Subspace, error) {
+	if !space.isRaw {
+		x.metrics.Add(metrics.DirectoryOpens, 1, metrics.Label{Name: "op", Value: "open"})
+	}
+	return space.open(tr)
+}
+
+// createOrOpen returns the subspace containing the keys of the given keySpace,
+// as described by [keySpace.createOrOpen], & records the directory opened.
+func (x *Engine) createOrOpen(tr facade.Transactor, space keySpace) (subspace.Subspace, error) {
+	if !space.isRaw {
+		x.metrics.Add(metrics.DirectoryOpens, 1, metrics.Label{Name: "op", Value: "create or open"})
+	}
+	return space.createOrOpen(tr)
+}
+
+// keySpace describes where the keys of a query are stored.
+// Keys are either stored under a directory or a raw prefix.
+type keySpace struct {
+	path  []string
+	raw   []byte
+	isRaw bool
+}
+
+func newKeySpace(dir keyval.Directory) (keySpace, error) {
+	if raw, ok := convert.ToRawPrefix(dir); ok {
+		return keySpace{raw: raw, isRaw: true}, nil
+	}
+	path, err := convert.ToStringArray(dir)
+	if err != nil {
+		return keySpace{}, err
+	}
+	return keySpace{path: path}, nil
+}
+
+// open returns the subspace containing the keys. If the keys
+// are stored under a directory which doesn't exist then
+// directory.ErrDirNotExists is returned.
+func (x keySpace) open(tr facade.ReadTransactor) (subspace.Subspace, error) {
+	if x.isRaw {
+		return subspace.FromBytes(x.raw), nil
+	}
+	return notPartition(tr.DirOpen(x.path))
+}
+
+// createOrOpen returns the subspace containing the keys. If
+// the keys are stored under a directory which doesn't exist
+// then the directory is created.
+func (x keySpace) createOrOpen(tr facade.Transactor) (subspace.Subspace, error) {
+	if x.isRaw {
+		return subspace.FromBytes(x.raw), nil
+	}
+	return notPartition(tr.DirCreateOrOpen(x.path))
+}
+
+// notPartition passes through the results of a directory
+// operation, returning an error if the directory is the
+// root of a partition. Attempting to pack keys using the
+// root of a partition causes the FDB bindings to panic.
+func notPartition(dir directory.DirectorySubspace, err error) (subspace.Subspace, error) {
+	if err != nil {
+		return nil, err
+	}
+	if facade.IsPartition(dir) {
+		return nil, errors.New("the root of a partition cannot contain key-values")
+	}
+	return dir, nil
+}
@@ -1,28 +1,34 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 
 	"github.com/janderland/fql/engine/facade"
 	"github.com/janderland/fql/engine/internal"
+	"github.com/janderland/fql/engine/metrics"
+	"github.com/janderland/fql/engine/trace"
 	q "github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/class"
+	"github.com/janderland/fql/parser/format"
 )
 
 var (
-	force bool
+	force  bool
+	useFDB bool
 )
 
 func init() {
-	fdb.MustAPIVersion(620)
 	flag.BoolVar(&force, "force", false, "remove test directory if it exists")
+	flag.BoolVar(&useFDB, "fdb", false, "run tests against an FDB cluster instead of in memory")
 }
 
 func TestEngine_SetReadSingle(t *testing.T) {
@@ -233,6 +239,36 @@ func TestEngine_ReadRange(t *testing.T) {
 		})
 	})
 
+	t.Run("raw prefix", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			// Raw prefixes aren't placed under the test's root
+			// directory, so the keys are cleared by the test.
+			prefix := q.Directory{q.Bytes("fql raw prefix test")}
+
+			var expected []q.KeyValue
+			for _, i := range []int64{1, 2, 3} {
+				query := q.KeyValue{Key: q.Key{Directory: prefix, Tuple: q.Tuple{q.Int(i)}}, Value: q.Bytes{}}
+				expected = append(expected, query)
+				err := e.Set(query)
+				require.NoError(t, err)
+			}
+			defer func() {
+				for _, kv := range expected {
+					kv.Value = q.Clear{}
+					require.NoError(t, e.Clear(kv))
+				}
+			}()
+
+			var results []q.KeyValue
+			query := q.KeyValue{Key: q.Key{Directory: prefix, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			for kve := range e.ReadRange(context.Background(), query, RangeOpts{}) {
+				require.NoError(t, kve.Err)
+				results = append(results, kve.KV)
+			}
+			require.Equal(t, expected, results)
+		})
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		testEnv(t, func(e Engine) {
 			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Clear{}}
@@ -248,7 +284,7 @@ func TestEngine_ReadRange(t *testing.T) {
 
 func TestEngine_Directories(t *testing.T) {
 	t.Run("created and open", func(t *testing.T) {
-		internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+		internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
 			query := q.Directory{q.String("my"), q.Variable{}}
 			paths := [][]string{
 				{"my", "path"},
@@ -272,6 +308,489 @@ func TestEngine_Directories(t *testing.T) {
 			require.Equal(t, expected, result)
 		})
 	})
+
+	t.Run("raw prefix", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			out := e.Directories(context.Background(), q.Directory{q.Bytes{0x01}})
+
+			msg := <-out
+			require.Error(t, msg.Err)
+			_, open := <-out
+			require.False(t, open)
+		})
+	})
+}
+
+func TestEngine_CreateDirectory(t *testing.T) {
+	t.Run("layer", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.Directory{q.String("my"), q.String("layer")}
+
+			dir, err := e.CreateDirectory(query, []byte("my_layer"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("my_layer"), dir.GetLayer())
+
+			_, err = e.CreateDirectory(query, []byte("my_layer"))
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.Directory{q.String("my"), q.String("partition")}
+
+			dir, err := e.CreatePartition(query)
+			require.NoError(t, err)
+			require.True(t, facade.IsPartition(dir))
+
+			err = e.Set(q.KeyValue{Key: q.Key{Directory: query, Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}})
+			require.Error(t, err)
+
+			kv := q.KeyValue{Key: q.Key{Directory: append(query, q.String("sub")), Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}}
+			err = e.Set(kv)
+			require.NoError(t, err)
+		})
+	})
+}
+
+func TestEngine_Move(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("old")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(2)}
+		err := e.Set(kv)
+		require.NoError(t, err)
+
+		_, err = e.Move(q.Move{From: q.Directory{q.String("old")}, To: q.Directory{q.String("new")}})
+		require.NoError(t, err)
+
+		kv.Value = q.Variable{}
+		result, err := e.ReadSingle(kv, SingleOpts{})
+		require.NoError(t, err)
+		require.Nil(t, result)
+
+		kv.Key.Directory = q.Directory{q.String("new")}
+		kv.Value = q.Variable{q.IntType}
+		result, err = e.ReadSingle(kv, SingleOpts{})
+		require.NoError(t, err)
+		require.Equal(t, q.Int(2), result.Value)
+	})
+}
+
+func TestEngine_Explain(t *testing.T) {
+	t.Run("range read", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(3392)}}, Value: q.Nil{}}
+			err := e.Set(kv)
+			require.NoError(t, err)
+
+			query := q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("people")},
+					Tuple:     q.Tuple{q.Int(3392), q.Variable{q.StringType, q.IntType}, q.Variable{}, q.MaybeMore{}},
+				},
+				Value: q.Variable{q.IntType},
+			}
+			exp, err := e.Explain(context.Background(), query, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			require.Equal(t, class.ReadRange, exp.Class)
+			require.Equal(t, []int{1, 2}, exp.Filtered)
+			require.Len(t, exp.Directories, 1)
+			require.True(t, exp.Directories[0].Exists)
+			require.NotEmpty(t, exp.Directories[0].Bytes)
+		})
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("missing")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(2)}
+			exp, err := e.Explain(context.Background(), query, RangeOpts{})
+			require.NoError(t, err)
+			require.Equal(t, class.Constant, exp.Class)
+			require.Len(t, exp.Directories, 1)
+			require.False(t, exp.Directories[0].Exists)
+			require.Nil(t, exp.Directories[0].Bytes)
+
+			// Explaining must not create the directory.
+			exp, err = e.Explain(context.Background(), query, RangeOpts{})
+			require.NoError(t, err)
+			require.False(t, exp.Directories[0].Exists)
+		})
+	})
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	t.Run("existing directory", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(3392)}}, Value: q.Int(42)}
+			err := e.Set(query)
+			require.NoError(t, err)
+
+			var mutations []Mutation
+			dry := e.WithDryRun(func(m Mutation) { mutations = append(mutations, m) })
+
+			query.Value = q.Int(43)
+			err = dry.Set(query)
+			require.NoError(t, err)
+			err = dry.Clear(q.KeyValue{Key: query.Key, Value: q.Clear{}})
+			require.NoError(t, err)
+
+			require.Len(t, mutations, 2)
+			require.Equal(t, MutationSet, mutations[0].Kind)
+			require.Nil(t, mutations[0].NewDirectories)
+			require.NotEmpty(t, mutations[0].Prefix)
+			require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 43}, mutations[0].Value)
+			require.Equal(t, -1, mutations[0].VStampOffset)
+			require.Equal(t, MutationClear, mutations[1].Kind)
+			require.Equal(t, mutations[0].Key, mutations[1].Key)
+
+			// The dry-run must not change the stored value.
+			kv, err := e.ReadSingle(q.KeyValue{Key: query.Key, Value: q.Variable{q.IntType}}, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, q.Int(42), kv.Value)
+		})
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var mutations []Mutation
+			dry := e.WithDryRun(func(m Mutation) { mutations = append(mutations, m) })
+
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("missing")}, Tuple: q.Tuple{q.VStampFuture{UserVersion: 1}}}, Value: q.Int(2)}
+			err := dry.Set(query)
+			require.NoError(t, err)
+			err = dry.Clear(q.KeyValue{Key: q.Key{Directory: query.Key.Directory, Tuple: q.Tuple{q.Int(1)}}, Value: q.Clear{}})
+			require.NoError(t, err)
+
+			require.Len(t, mutations, 1)
+			require.Equal(t, MutationSetVStampKey, mutations[0].Kind)
+			require.Equal(t, [][]string{{"missing"}}, mutations[0].NewDirectories)
+			require.Nil(t, mutations[0].Prefix)
+			require.Equal(t, 1, mutations[0].VStampOffset)
+
+			// The dry-run must not create the directory.
+			exp, err := e.Explain(context.Background(), query, RangeOpts{})
+			require.NoError(t, err)
+			require.False(t, exp.Directories[0].Exists)
+		})
+	})
+
+	t.Run("missing ancestors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			err := e.Set(q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}})
+			require.NoError(t, err)
+
+			var mutations []Mutation
+			dry := e.WithDryRun(func(m Mutation) { mutations = append(mutations, m) })
+
+			dir := q.Directory{q.String("a"), q.String("b"), q.String("c")}
+			err = dry.Set(q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}})
+			require.NoError(t, err)
+			dir = q.Directory{q.String("x"), q.String("y")}
+			err = dry.Set(q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}})
+			require.NoError(t, err)
+
+			require.Len(t, mutations, 2)
+			require.Equal(t, [][]string{{"a", "b"}, {"a", "b", "c"}}, mutations[0].NewDirectories)
+			require.Equal(t, [][]string{{"x"}, {"x", "y"}}, mutations[1].NewDirectories)
+			require.Equal(t, []string{
+				"create directory: /x",
+				"create directory: /x/y",
+				"prefix: not allocated, key excludes prefix",
+			}, mutations[1].Lines(format.New())[2:5])
+		})
+	})
+
+	t.Run("move", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			dry := e.WithDryRun(func(Mutation) {})
+			_, err := dry.Move(q.Move{From: q.Directory{q.String("a")}, To: q.Directory{q.String("b")}})
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestEngine_Decode(t *testing.T) {
+	t.Run("directory", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			kv := q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("people"), q.String("mark")}, Tuple: q.Tuple{q.Int(3392), q.String("hi")}},
+				Value: q.Int(42),
+			}
+			err := e.Set(kv)
+			require.NoError(t, err)
+
+			mutations := dryRunSet(t, e, kv)
+			key, err := e.DecodeKey(mutations[0].Key)
+			require.NoError(t, err)
+
+			// The first element of the dir path is dropped because it
+			// should be a random dir created by the test framework.
+			key.Directory = key.Directory[1:]
+			require.Equal(t, kv.Key, key)
+
+			value, err := e.DecodeValue(mutations[0].Value, q.Variable{q.IntType, q.StringType})
+			require.NoError(t, err)
+			require.Equal(t, kv.Value, value)
+		})
+	})
+
+	t.Run("raw prefix", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			kv := q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.Bytes{0x01, 0x02}}, Tuple: q.Tuple{q.Int(1)}},
+				Value: q.Nil{},
+			}
+			mutations := dryRunSet(t, e, kv)
+			key, err := e.DecodeKey(mutations[0].Key)
+			require.NoError(t, err)
+			require.Equal(t, kv.Key, key)
+		})
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			kv := q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(1), q.String("hi")}},
+				Value: q.Tuple{q.Float(1.5)},
+			}
+			_, err := e.EncodeKey(kv.Key)
+			require.ErrorIs(t, err, directory.ErrDirNotExists)
+
+			err = e.Set(kv)
+			require.NoError(t, err)
+
+			mutations := dryRunSet(t, e, kv)
+			key, err := e.EncodeKey(kv.Key)
+			require.NoError(t, err)
+			require.Equal(t, mutations[0].Key, key)
+
+			value, err := e.EncodeValue(kv.Value)
+			require.NoError(t, err)
+			require.Equal(t, mutations[0].Value, value)
+
+			_, err = e.EncodeKey(q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.MaybeMore{}}})
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			_, err := e.DecodeValue([]byte{0x01}, q.Variable{q.IntType})
+			require.Error(t, err)
+
+			value, err := e.DecodeValue([]byte{0x01}, q.Variable{})
+			require.NoError(t, err)
+			require.Equal(t, q.Bytes{0x01}, value)
+		})
+	})
+}
+
+func TestEngine_RecordReplay(t *testing.T) {
+	session := func(t *testing.T, e Engine) []q.KeyValue {
+		people := q.Directory{q.String("people")}
+		for i, name := range []string{"alice", "bob"} {
+			err := e.Set(q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String(name)}}, Value: q.Int(i)})
+			require.NoError(t, err)
+		}
+
+		var results []q.KeyValue
+		single, err := e.ReadSingle(q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String("bob")}}, Value: q.Variable{q.IntType}}, SingleOpts{})
+		require.NoError(t, err)
+		results = append(results, *single)
+
+		for msg := range e.ReadRange(context.Background(), q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{q.IntType}}, RangeOpts{}) {
+			require.NoError(t, msg.Err)
+			results = append(results, msg.KV)
+		}
+		return results
+	}
+
+	internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
+		var recording bytes.Buffer
+		expected := session(t, New(facade.NewRecorder(tr, &recording), Logger(log)))
+		require.Len(t, expected, 3)
+
+		t.Run("replay", func(t *testing.T) {
+			replayer, err := facade.NewReplayer(bytes.NewReader(recording.Bytes()))
+			require.NoError(t, err)
+			require.Equal(t, expected, session(t, New(replayer, Logger(log))))
+		})
+
+		t.Run("diverge", func(t *testing.T) {
+			replayer, err := facade.NewReplayer(bytes.NewReader(recording.Bytes()))
+			require.NoError(t, err)
+
+			e := New(replayer, Logger(log))
+			err = e.Set(q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.String("carol")}}, Value: q.Int(0)})
+			require.ErrorIs(t, err, facade.ErrDiverged)
+		})
+	})
+}
+
+func TestEngine_Faults(t *testing.T) {
+	people := q.Directory{q.String("people")}
+	person := func(name string, age int) q.KeyValue {
+		return q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String(name)}}, Value: q.Int(age)}
+	}
+
+	t.Run("retried commit", func(t *testing.T) {
+		internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
+			e := New(facade.NewFaultInjector(tr, facade.Fault{
+				Ops:   []facade.Op{facade.OpCommit},
+				Calls: []int{1},
+				Err:   facade.FaultNotCommitted,
+			}), Logger(log))
+			require.NoError(t, e.Set(person("alice", 30)))
+
+			query := person("alice", 0)
+			query.Value = q.Variable{q.IntType}
+			result, err := e.ReadSingle(query, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, person("alice", 30), *result)
+		})
+	})
+
+	t.Run("partial range", func(t *testing.T) {
+		internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
+			e := New(facade.NewFaultInjector(tr, facade.Fault{
+				Ops:        []facade.Op{facade.OpGetRange},
+				Err:        facade.FaultTimedOut,
+				PartialKVs: 1,
+			}), Logger(log))
+			require.NoError(t, e.Set(person("alice", 30)))
+			require.NoError(t, e.Set(person("bob", 40)))
+
+			query := q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{q.IntType}}
+			var (
+				results []q.KeyValue
+				errs    []error
+			)
+			for msg := range e.ReadRange(context.Background(), query, RangeOpts{}) {
+				if msg.Err != nil {
+					errs = append(errs, msg.Err)
+					continue
+				}
+				msg.KV.Key.Directory = msg.KV.Key.Directory[1:]
+				results = append(results, msg.KV)
+			}
+			require.Equal(t, []q.KeyValue{person("alice", 30)}, results)
+			require.Len(t, errs, 1)
+			require.ErrorIs(t, errs[0], facade.FaultTimedOut)
+		})
+	})
+}
+
+func TestEngine_Metrics(t *testing.T) {
+	internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
+		registry := metrics.NewRegistry()
+		e := New(facade.NewFaultInjector(tr, facade.Fault{
+			Ops:   []facade.Op{facade.OpCommit},
+			Calls: []int{1},
+			Err:   facade.FaultNotCommitted,
+		}), Logger(log), Metrics(registry))
+
+		people := q.Directory{q.String("people")}
+		require.NoError(t, e.Set(q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String("alice")}}, Value: q.Int(30)}))
+		require.NoError(t, e.Set(q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String("bob")}}, Value: q.String("40")}))
+
+		// Only one of the two key-values
+		// has a value of the queried type.
+		query := q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{q.IntType}}
+		for msg := range e.ReadRange(context.Background(), query, RangeOpts{Filter: true}) {
+			require.NoError(t, msg.Err)
+		}
+
+		write := metrics.Label{Name: "kind", Value: "write"}
+		read := metrics.Label{Name: "kind", Value: "read"}
+		require.Equal(t, float64(2), registry.Counter(metrics.Transactions, write))
+		require.Equal(t, float64(1), registry.Counter(metrics.TransactionRetries, write))
+		require.Equal(t, float64(1), registry.Counter(metrics.Transactions, read))
+		require.Equal(t, float64(0), registry.Counter(metrics.TransactionRetries, read))
+
+		// The first set is attempted twice.
+		require.Equal(t, float64(3), registry.Counter(metrics.DirectoryOpens, metrics.Label{Name: "op", Value: "create or open"}))
+		require.Equal(t, float64(1), registry.Counter(metrics.DirectoryOpens, metrics.Label{Name: "op", Value: "open"}))
+
+		require.Equal(t, float64(2), registry.Counter(metrics.KeysScanned))
+		require.Equal(t, float64(1), registry.Counter(metrics.KeysReturned))
+		require.Positive(t, registry.Counter(metrics.BytesRead))
+		require.Positive(t, registry.Counter(metrics.BytesWritten))
+
+		for _, stage := range []string{"open directories", "read range", "unpack keys", "unpack values"} {
+			require.Equal(t, uint64(1), registry.Count(metrics.StageSeconds, metrics.Label{Name: "stage", Value: stage}), stage)
+		}
+	})
+}
+
+type spanCollector struct {
+	mu    sync.Mutex
+	spans map[string]trace.SpanData
+}
+
+func (x *spanCollector) Export(data trace.SpanData) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.spans[data.Name] = data
+}
+
+func TestEngine_Trace(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		exp := spanCollector{spans: make(map[string]trace.SpanData)}
+		e = New(e.tr, Tracer(trace.NewTracer(&exp)))
+
+		people := q.Directory{q.String("people")}
+		_, err := e.Transact(func(e Engine) (interface{}, error) {
+			if err := e.Set(q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.String("alice")}}, Value: q.Int(30)}); err != nil {
+				return nil, err
+			}
+			query := q.KeyValue{Key: q.Key{Directory: people, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{q.IntType}}
+			for msg := range e.ReadRange(context.Background(), query, RangeOpts{}) {
+				if msg.Err != nil {
+					return nil, msg.Err
+				}
+			}
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		attr := func(span trace.SpanData, key string) interface{} {
+			for _, a := range span.Attrs {
+				if a.Key == key {
+					return a.Value
+				}
+			}
+			return nil
+		}
+
+		tx := exp.spans["engine.Transact"]
+		require.Equal(t, trace.SpanContext{}, tx.Parent)
+
+		set := exp.spans["engine.Set"]
+		require.Equal(t, tx.Context, set.Parent)
+		require.Equal(t, "/people(\"alice\")=30", attr(set, "fql.query"))
+		require.Equal(t, string(class.Constant), attr(set, "fql.class"))
+		require.Equal(t, "/people", attr(set, "fql.directory"))
+
+		read := exp.spans["engine.ReadRange"]
+		require.Equal(t, tx.Context, read.Parent)
+		require.Equal(t, string(class.ReadRange), attr(read, "fql.class"))
+		require.Equal(t, 1, attr(read, "fql.results"))
+		require.Empty(t, read.Err)
+
+		for _, name := range []string{"stream.OpenDirectories", "stream.ReadRange", "stream.UnpackKeys", "stream.UnpackValues"} {
+			stage := exp.spans[name]
+			require.Equal(t, read.Context, stage.Parent, name)
+			require.Equal(t, 1, attr(stage, "fql.results"), name)
+		}
+		require.Equal(t, 1, attr(exp.spans["stream.ReadRange"], "fql.directories"))
+	})
+}
+
+func dryRunSet(t *testing.T, e Engine, kv q.KeyValue) []Mutation {
+	var mutations []Mutation
+	dry := e.WithDryRun(func(m Mutation) { mutations = append(mutations, m) })
+	require.NoError(t, dry.Set(kv))
+	require.Len(t, mutations, 1)
+	return mutations
 }
 
 func TestEngine_Watch(t *testing.T) {
@@ -329,8 +848,41 @@ func TestEngine_Watch(t *testing.T) {
 	})
 }
 
+func TestEngine_TxOpts(t *testing.T) {
+	t.Run("valid options", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			e = e.WithTxOpts(facade.TxOpts{
+				Timeout:       5 * time.Second,
+				RetryLimit:    3,
+				MaxRetryDelay: 100 * time.Millisecond,
+				Priority:      facade.PriorityBatch,
+			})
+
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("opts")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(2)}
+			err := e.Set(query)
+			require.NoError(t, err)
+
+			expected := query
+			query.Value = q.Variable{q.IntType}
+			result, err := e.ReadSingle(query, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, &expected, result)
+		})
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			e = e.WithTxOpts(facade.TxOpts{RetryLimit: -2})
+
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("opts")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(2)}
+			err := e.Set(query)
+			require.Error(t, err)
+		})
+	})
+}
+
 func testEnv(t *testing.T, f func(Engine)) {
-	internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+	internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
 		f(New(tr, Logger(log)))
 	})
 }
@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/engine/stream"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/class"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/keyval/values"
+	"github.com/janderland/fql/parser/format"
+)
+
+// Explanation describes how an [Engine] would execute a query.
+// It's produced by [Engine.Explain].
+type Explanation struct {
+	// Query is the query being explained.
+	Query keyval.Query
+
+	// Class is the class of the query. Directory & move
+	// queries aren't classified, so Class is empty for
+	// these kinds of queries.
+	Class class.Class
+
+	// Directories contains the directories the query
+	// would operate on.
+	Directories []ExplainedDir
+
+	// Filtered contains the indexes of the key's tuple
+	// elements which aren't part of the range prefix.
+	// These elements are checked on the client after
+	// the key-values are read.
+	Filtered []int
+
+	// Value describes how the query's value would be
+	// encoded or how the values read would be decoded.
+	Value string
+
+	// Opts are the options used for range reads.
+	Opts RangeOpts
+}
+
+// ExplainedDir describes how a query would operate on a
+// single directory.
+type ExplainedDir struct {
+	// Directory is the path of the directory or the raw
+	// prefix used in place of a directory.
+	Directory keyval.Directory
+
+	// Exists is false if the directory doesn't exist.
+	// Write queries create the directory when executed.
+	// Read queries return no results.
+	Exists bool
+
+	// Partition is true if the directory is the root of a
+	// partition. Partitions are skipped by range reads.
+	Partition bool
+
+	// Bytes are the packed bytes the query would operate
+	// on. For single key queries, this is the exact key.
+	// For range reads, this is the prefix of the range.
+	// For directory queries, this is the prefix of the
+	// directory. Bytes is nil if the directory doesn't
+	// exist or is the root of a partition.
+	Bytes []byte
+}
+
+// Explain describes how the given query would be executed without executing
+// it. The directory layer is read in order to expand the query's directory,
+// but no key-values are read or written. The given options describe how range
+// reads would be executed.
+func (x *Engine) Explain(ctx context.Context, query keyval.Query, opts RangeOpts) (_ *Explanation, err error) {
+	ctx, span := x.startSpan(ctx, "Explain", x.queryAttrs(query)...)
+	defer func() { endSpan(span, err) }()
+
+	exp := Explanation{Query: query, Opts: opts}
+
+	var kv *keyval.KeyValue
+	var dir keyval.Directory
+	switch query := query.(type) {
+	case keyval.Directory:
+		dir = query
+	case keyval.Move:
+		dir = query.From
+	case keyval.Key:
+		kv = &keyval.KeyValue{Key: query, Value: keyval.Variable{}}
+		dir = query.Directory
+	case keyval.KeyValue:
+		kv = &query
+		dir = query.Key.Directory
+	default:
+		return nil, errors.Errorf("unexpected query type %T", query)
+	}
+
+	if kv != nil {
+		exp.Class = class.Classify(*kv)
+		switch exp.Class {
+		case class.Constant, class.VStampKey, class.VStampVal, class.Clear, class.ReadSingle, class.ReadRange:
+			break
+		default:
+			return nil, errors.Errorf("invalid query class %s", exp.Class)
+		}
+
+		value, err := x.explainValue(*kv, exp.Class, opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		exp.Value = value
+
+		if exp.Class == class.ReadRange {
+			prefix := stream.TuplePrefix(kv.Key.Tuple)
+			for i := len(prefix); i < len(kv.Key.Tuple); i++ {
+				if _, ok := kv.Key.Tuple[i].(keyval.MaybeMore); ok {
+					continue
+				}
+				exp.Filtered = append(exp.Filtered, i)
+			}
+		}
+	}
+
+	dirs, err := x.expandDirectory(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 && !hasVariable(dir) {
+		exp.Directories = append(exp.Directories, ExplainedDir{Directory: dir})
+	}
+
+	for _, d := range dirs {
+		exp.Directories = append(exp.Directories, ExplainedDir{
+			Directory: d.directory,
+			Exists:    true,
+			Partition: facade.IsPartition(d.subspace),
+		})
+		explained := &exp.Directories[len(exp.Directories)-1]
+		if explained.Partition {
+			continue
+		}
+
+		if kv == nil {
+			explained.Bytes = d.subspace.Bytes()
+			continue
+		}
+
+		switch exp.Class {
+		case class.ReadRange:
+			prefix, err := convert.ToFDBTuple(stream.TuplePrefix(kv.Key.Tuple))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert prefix to FDB tuple")
+			}
+			explained.Bytes = d.subspace.Pack(prefix)
+
+		case class.VStampKey:
+			tup, err := convert.ToFDBTuple(kv.Key.Tuple)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+			}
+			explained.Bytes, err = tup.PackWithVersionstamp(d.subspace.Bytes())
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to pack key")
+			}
+
+		default:
+			tup, err := convert.ToFDBTuple(kv.Key.Tuple)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+			}
+			explained.Bytes = d.subspace.Pack(tup)
+		}
+	}
+
+	return &exp, nil
+}
+
+type expandedDir struct {
+	directory keyval.Directory
+	subspace  directory.DirectorySubspace
+}
+
+// expandDirectory returns the existing directories matching the
+// given directory schema. Only the directory layer is read.
+func (x *Engine) expandDirectory(ctx context.Context, query keyval.Directory) ([]expandedDir, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := stream.New(ctx, stream.Logger(x.log), stream.Metrics(x.metrics), stream.Tracer(x.tracer))
+
+	var dirs []expandedDir
+	_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		dirs = nil
+		for msg := range s.OpenDirectories(tr, query) {
+			if msg.Err != nil {
+				return nil, msg.Err
+			}
+			dirs = append(dirs, expandedDir{
+				directory: stream.ToDirectory(msg.Dir),
+				subspace:  msg.Dir,
+			})
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to expand directory")
+	}
+	return dirs, nil
+}
+
+func (x *Engine) explainValue(kv keyval.KeyValue, queryClass class.Class, filter bool) (string, error) {
+	mismatch := "cause an error"
+	if filter {
+		mismatch = "are skipped"
+	}
+
+	switch queryClass {
+	case class.Clear:
+		return "the key is cleared", nil
+
+	case class.Constant, class.VStampKey, class.VStampVal:
+		packed, err := values.Pack(kv.Value, x.order, queryClass == class.VStampVal)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to pack value")
+		}
+		return fmt.Sprintf("written as 0x%s", hex.EncodeToString(packed)), nil
+
+	default:
+		variable, ok := kv.Value.(keyval.Variable)
+		if !ok {
+			packed, err := values.Pack(kv.Value, x.order, false)
+			if err != nil {
+				return "", errors.Wrap(err, "failed to pack value")
+			}
+			return fmt.Sprintf("compared against 0x%s, mismatches %s", hex.EncodeToString(packed), mismatch), nil
+		}
+		if len(variable) == 0 {
+			return "returned as raw bytes", nil
+		}
+		var types []string
+		for _, typ := range variable {
+			if typ == keyval.AnyType {
+				types = append(types, "any")
+				continue
+			}
+			types = append(types, string(typ))
+		}
+		return fmt.Sprintf("decoded as the first of %s which succeeds, failures %s",
+			strings.Join(types, ", "), mismatch), nil
+	}
+}
+
+func hasVariable(dir keyval.Directory) bool {
+	for _, element := range dir {
+		if _, ok := element.(keyval.Variable); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Lines formats the Explanation as human-readable lines of text.
+// The given format.Format is used to format the query & directories.
+func (x *Explanation) Lines(f format.Format) []string {
+	var lines []string
+
+	f.Reset()
+	f.Query(x.Query)
+	lines = append(lines, "query: "+f.String())
+
+	if x.Class != "" {
+		lines = append(lines, "class: "+string(x.Class))
+	}
+
+	for _, dir := range x.Directories {
+		f.Reset()
+		f.Directory(dir.Directory)
+		line := "directory: " + f.String()
+
+		switch {
+		case !dir.Exists:
+			line += " (doesn't exist)"
+		case dir.Partition:
+			line += " (partition, skipped)"
+		case x.Class == class.ReadRange:
+			line += " range prefix 0x" + hex.EncodeToString(dir.Bytes)
+		case x.Class == "":
+			line += " prefix 0x" + hex.EncodeToString(dir.Bytes)
+		default:
+			line += " key 0x" + hex.EncodeToString(dir.Bytes)
+		}
+		lines = append(lines, line)
+	}
+
+	if x.Class == class.ReadRange {
+		if len(x.Filtered) == 0 {
+			lines = append(lines, "filtered on client: none")
+		} else {
+			var indexes []string
+			for _, i := range x.Filtered {
+				indexes = append(indexes, fmt.Sprint(i))
+			}
+			lines = append(lines, "filtered on client: tuple indexes "+strings.Join(indexes, ", "))
+		}
+
+		lines = append(lines, fmt.Sprintf("reverse: %v", x.Opts.Reverse))
+		if x.Opts.Limit > 0 {
+			lines = append(lines, fmt.Sprintf("limit: %d", x.Opts.Limit))
+		}
+	}
+
+	if x.Value != "" {
+		lines = append(lines, "value: "+x.Value)
+	}
+	return lines
+}
@@ -1,11 +1,34 @@
 package facade
 
 import (
+	"bytes"
+
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 )
 
+// PartitionLayer is the layer assigned to directory partitions. Passing
+// this as the layer to Transactor.DirCreate creates a partition.
+const PartitionLayer = "partition"
+
+// IsPartition returns true if the given directory is the root of a
+// directory partition. The root of a partition cannot contain
+// key-values, only subdirectories.
+func IsPartition(dir directory.DirectorySubspace) bool {
+	return bytes.Equal(dir.GetLayer(), []byte(PartitionLayer))
+}
+
+// DirPrefix returns the prefix allocated to the given directory. If the
+// directory is the root of a partition, nil is returned because the FDB
+// bindings don't expose a partition's prefix.
+func DirPrefix(dir directory.DirectorySubspace) []byte {
+	if IsPartition(dir) {
+		return nil
+	}
+	return dir.Bytes()
+}
+
 type (
 	nilDirectory struct{}
 
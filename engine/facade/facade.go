@@ -31,7 +31,35 @@ type (
 		Get(key fdb.KeyConvertible) fdb.FutureByteSlice
 
 		// GetRange performs a range-read over the given range.
-		GetRange(r fdb.Range, options fdb.RangeOptions) fdb.RangeResult
+		GetRange(r fdb.Range, options fdb.RangeOptions) RangeResult
+
+		// DirFind returns the directory, under the root directory specified by
+		// the implementation, whose prefix begins the given key. Partitions are
+		// never returned, though their subdirectories may be. If no directory
+		// contains the key, nil is returned.
+		DirFind(key []byte) (directory.DirectorySubspace, error)
+	}
+
+	// RangeResult provides access to the key-values of a range-read. It
+	// mirrors fdb.RangeResult, which can only be created by the FDB client.
+	RangeResult interface {
+		// GetSliceWithError returns all the key-values in the range.
+		GetSliceWithError() ([]fdb.KeyValue, error)
+
+		// Iterator returns an iterator over the key-values in the range.
+		Iterator() RangeIterator
+	}
+
+	// RangeIterator iterates over the key-values of a range-read. It
+	// mirrors fdb.RangeIterator.
+	RangeIterator interface {
+		// Advance attempts to advance the iterator to the next key-value.
+		// It returns false if there are no more key-values or an error
+		// occurred, in which case the error is returned by Get.
+		Advance() bool
+
+		// Get returns the key-value at the iterator's position.
+		Get() (fdb.KeyValue, error)
 	}
 
 	// Transactor provides methods for performing read or write transactions and for
@@ -46,6 +74,24 @@ type (
 		// DirCreateOrOpen opens a directory (or creates it if it doesn't exist)
 		// under the root directory specified by the implementation.
 		DirCreateOrOpen(path []string) (directory.DirectorySubspace, error)
+
+		// DirCreate creates a directory with the given layer under the root
+		// directory specified by the implementation. If the directory already
+		// exists, an error is returned. If the layer is PartitionLayer then
+		// a directory partition is created.
+		DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error)
+
+		// DirMove moves the directory at oldPath to newPath. Both paths are
+		// relative to the root directory specified by the implementation.
+		// The directory's contents, including subdirectories, are moved
+		// with it. Directories cannot be moved between partitions.
+		DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error)
+
+		// WithTxOpts returns a Transactor which configures its transactions
+		// using the given TxOpts. Any options previously configured on this
+		// Transactor are replaced. If this Transactor is backed by a
+		// transaction then the options are applied to that transaction.
+		WithTxOpts(TxOpts) Transactor
 	}
 
 	// Transaction provides methods for reading or writing key-values from an open
@@ -79,23 +125,31 @@ type (
 	readTransactor struct {
 		tr   fdb.ReadTransactor
 		root directory.Directory
+		opts TxOpts
 	}
 
 	readTransaction struct {
 		tr   fdb.ReadTransaction
 		root directory.Directory
+		opts TxOpts
 	}
 
 	transactor struct {
 		ReadTransactor
 		tr   fdb.Transactor
 		root directory.Directory
+		opts TxOpts
 	}
 
 	transaction struct {
 		ReadTransaction
 		tr   fdb.Transaction
 		root directory.Directory
+		opts TxOpts
+	}
+
+	rangeResult struct {
+		fdb.RangeResult
 	}
 )
 
@@ -110,32 +164,40 @@ var (
 // Any directory operations performed by the returned ReadTransactor will use the given
 // directory.Directory as the root.
 func NewReadTransactor(tr fdb.ReadTransactor, root directory.Directory) ReadTransactor {
-	return &readTransactor{tr, root}
+	return &readTransactor{tr: tr, root: root}
 }
 
 // NewReadTransaction creates a new instance of a ReadTransaction backed by a fdb.ReadTransaction.
 // Any directory operations performed by the returned ReadTransaction will use the given
 // directory.Directory as the root.
 func NewReadTransaction(tr fdb.ReadTransaction, root directory.Directory) ReadTransaction {
-	return &readTransaction{tr, root}
+	return &readTransaction{tr: tr, root: root}
 }
 
 // NewTransactor creates a new instance of a Transactor backed by a fdb.Transactor.
 // Any directory operations performed by the returned Transactor will use the given
 // directory.Directory as the root.
 func NewTransactor(tr fdb.Transactor, root directory.Directory) Transactor {
-	return &transactor{NewReadTransactor(tr, root), tr, root}
+	return &transactor{ReadTransactor: NewReadTransactor(tr, root), tr: tr, root: root}
 }
 
 // NewTransaction creates a new instance of a Transaction backed by a fdb.Transaction.
 // Any directory operations performed by the returned Transaction will use the given
 // directory.Directory as the root.
 func NewTransaction(tr fdb.Transaction, root directory.Directory) Transaction {
-	return &transaction{NewReadTransaction(tr, root), tr, root}
+	return &transaction{ReadTransaction: NewReadTransaction(tr, root), tr: tr, root: root}
 }
 
 func (x *readTransactor) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		// Snapshots share the options of their parent
+		// transaction, so options are only applied when
+		// we're given the transaction itself.
+		if tr, ok := tr.(fdb.Transaction); ok {
+			if err := x.opts.apply(tr); err != nil {
+				return nil, err
+			}
+		}
 		return f(NewReadTransaction(tr, x.root))
 	})
 }
@@ -150,6 +212,11 @@ func (x *readTransactor) DirList(path []string) ([]string, error) {
 
 func (x *readTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		if tr, ok := tr.(fdb.Transaction); ok {
+			if err := x.opts.apply(tr); err != nil {
+				return nil, err
+			}
+		}
 		return f(NewReadTransaction(tr, x.root))
 	})
 }
@@ -166,12 +233,19 @@ func (x *readTransaction) Get(key fdb.KeyConvertible) fdb.FutureByteSlice {
 	return x.tr.Get(key)
 }
 
-func (x *readTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) fdb.RangeResult {
-	return x.tr.GetRange(rng, options)
+func (x *readTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) RangeResult {
+	return &rangeResult{x.tr.GetRange(rng, options)}
+}
+
+func (x *rangeResult) Iterator() RangeIterator {
+	return x.RangeResult.Iterator()
 }
 
 func (x *transactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if err := x.opts.apply(tr); err != nil {
+			return nil, err
+		}
 		return f(NewTransaction(tr, x.root))
 	})
 }
@@ -180,8 +254,28 @@ func (x *transactor) DirCreateOrOpen(path []string) (directory.DirectorySubspace
 	return x.root.CreateOrOpen(x.tr, path, nil)
 }
 
+func (x *transactor) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.root.Create(x.tr, path, layer)
+}
+
+func (x *transactor) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.root.Move(x.tr, oldPath, newPath)
+}
+
+func (x *transactor) WithTxOpts(opts TxOpts) Transactor {
+	return &transactor{
+		ReadTransactor: &readTransactor{tr: x.tr, root: x.root, opts: opts},
+		tr:             x.tr,
+		root:           x.root,
+		opts:           opts,
+	}
+}
+
 func (x *transaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if err := x.opts.apply(tr); err != nil {
+			return nil, err
+		}
 		return f(NewTransaction(tr, x.root))
 	})
 }
@@ -190,6 +284,23 @@ func (x *transaction) DirCreateOrOpen(path []string) (directory.DirectorySubspac
 	return x.root.CreateOrOpen(x.tr, path, nil)
 }
 
+func (x *transaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.root.Create(x.tr, path, layer)
+}
+
+func (x *transaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.root.Move(x.tr, oldPath, newPath)
+}
+
+func (x *transaction) WithTxOpts(opts TxOpts) Transactor {
+	return &transaction{
+		ReadTransaction: &readTransaction{tr: x.tr, root: x.root, opts: opts},
+		tr:              x.tr,
+		root:            x.root,
+		opts:            opts,
+	}
+}
+
 func (x *transaction) Set(key fdb.KeyConvertible, val []byte) {
 	x.tr.Set(key, val)
 }
@@ -0,0 +1,564 @@
+package facade
+
+import (
+	"sync"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+)
+
+// Op identifies a kind of call made to a Transactor or Transaction.
+type Op string
+
+const (
+	OpTransact        Op = "transact"
+	OpReadTransact    Op = "readTransact"
+	OpDirOpen         Op = "dirOpen"
+	OpDirList         Op = "dirList"
+	OpDirFind         Op = "dirFind"
+	OpDirCreateOrOpen Op = "dirCreateOrOpen"
+	OpDirCreate       Op = "dirCreate"
+	OpDirMove         Op = "dirMove"
+	OpGet             Op = "get"
+	OpGetRange        Op = "getRange"
+	OpSet             Op = "set"
+	OpSetVStampKey    Op = "setVStampKey"
+	OpSetVStampValue  Op = "setVStampValue"
+	OpClear           Op = "clear"
+	OpWatch           Op = "watch"
+
+	// OpCommit identifies the commit of a transaction. A
+	// Fault for this Op affects a transaction attempt after
+	// the transactional function returns successfully.
+	OpCommit Op = "commit"
+)
+
+// The codes of the FDB errors which are
+// commonly used when injecting faults.
+const (
+	codeTransactionTooOld   = 1007
+	codeNotCommitted        = 1020
+	codeCommitUnknownResult = 1021
+	codeTimedOut            = 1031
+)
+
+var (
+	// FaultNotCommitted is the FDB error returned when a transaction
+	// conflicts with another transaction. It's retried by FDB.
+	FaultNotCommitted = fdb.Error{Code: codeNotCommitted}
+
+	// FaultTransactionTooOld is the FDB error returned when a
+	// transaction runs for more than 5 seconds. It's retried by FDB.
+	FaultTransactionTooOld = fdb.Error{Code: codeTransactionTooOld}
+
+	// FaultTimedOut is the FDB error returned when a transaction
+	// exceeds its timeout. It isn't retried by FDB.
+	FaultTimedOut = fdb.Error{Code: codeTimedOut}
+)
+
+// Fault describes an error or delay injected into the calls made to the
+// Transactor returned by NewFaultInjector.
+type Fault struct {
+	// Ops limits the fault to calls of the given kinds.
+	// If empty, calls of every kind are affected.
+	Ops []Op
+
+	// Keys limits the fault to calls which access keys within
+	// the given range. Calls which don't access keys, like the
+	// directory operations, aren't affected. If nil, keys aren't
+	// considered. A directory may be used as the range.
+	Keys fdb.ExactRange
+
+	// Calls limits the fault to the given calls, numbered from 1
+	// in the order they're made. Only the calls matching Ops & Keys
+	// are counted. If empty, every matching call is affected.
+	Calls []int
+
+	// Delay pauses the affected calls. For Get & Watch, the returned
+	// future is delayed instead. For GetRange, the first read of the
+	// range is delayed.
+	Delay time.Duration
+
+	// Err is returned by the affected calls. Calls which don't return
+	// an error, like Set, fail their transaction attempt instead. For
+	// GetRange, the error is returned after PartialKVs key-values
+	// are read. Retryable FDB errors, like FaultNotCommitted, cause
+	// the transaction attempt to be retried.
+	Err error
+
+	// PartialKVs is the number of key-values read by a
+	// GetRange before Err is returned.
+	PartialKVs int
+}
+
+type (
+	// faultState counts the calls matching each Fault.
+	faultState struct {
+		mu     sync.Mutex
+		faults []Fault
+		counts []int
+	}
+
+	// faultEffect is the combined effect of the
+	// faults which match a particular call.
+	faultEffect struct {
+		delay   time.Duration
+		err     error
+		partial int
+	}
+
+	faultInjector struct {
+		tr    Transactor
+		state *faultState
+	}
+
+	// faultTransaction injects faults into the calls made to a
+	// transaction. If the transaction is read-only, tr is nil.
+	faultTransaction struct {
+		rtr   ReadTransaction
+		tr    Transaction
+		state *faultState
+		fail  *faultFailure
+	}
+
+	// faultFailure holds the error of the first faulted call which
+	// couldn't return it. It's shared by a transaction & the
+	// transactions nested within it.
+	faultFailure struct {
+		mu  sync.Mutex
+		err error
+	}
+
+	faultRangeResult struct {
+		result RangeResult
+		effect faultEffect
+	}
+
+	faultRangeIterator struct {
+		iter   RangeIterator
+		effect faultEffect
+		read   int
+		failed bool
+	}
+
+	faultFutureByteSlice struct {
+		fdb.FutureByteSlice
+		readyAt time.Time
+	}
+
+	faultWatch struct {
+		fdb.FutureNil
+		readyAt time.Time
+		err     error
+	}
+)
+
+var (
+	_ Transactor          = &faultInjector{}
+	_ Transaction         = &faultTransaction{}
+	_ RangeResult         = &faultRangeResult{}
+	_ RangeIterator       = &faultRangeIterator{}
+	_ fdb.FutureByteSlice = &faultFutureByteSlice{}
+	_ fdb.FutureNil       = &faultWatch{}
+)
+
+// NewFaultInjector returns a Transactor which injects the given faults into
+// the calls made to the given Transactor. When a call matches several faults,
+// their delays are summed & the first matching fault's error is used. Calls
+// are counted across all the transactions created by the returned Transactor,
+// including the Transactors returned by its WithTxOpts method.
+func NewFaultInjector(tr Transactor, faults ...Fault) Transactor {
+	return &faultInjector{
+		tr: tr,
+		state: &faultState{
+			faults: faults,
+			counts: make([]int, len(faults)),
+		},
+	}
+}
+
+func (x *faultInjector) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		if err := x.state.apply(OpReadTransact, nil); err != nil {
+			return nil, err
+		}
+		return (&faultTransaction{rtr: tr, state: x.state, fail: &faultFailure{}}).run(func(tr *faultTransaction) (interface{}, error) {
+			return f(tr)
+		})
+	})
+}
+
+func (x *faultInjector) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.Transact(func(tr Transaction) (interface{}, error) {
+		if err := x.state.apply(OpTransact, nil); err != nil {
+			return nil, err
+		}
+		out, err := (&faultTransaction{rtr: tr, tr: tr, state: x.state, fail: &faultFailure{}}).run(func(tr *faultTransaction) (interface{}, error) {
+			return f(tr)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := x.state.apply(OpCommit, nil); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+}
+
+func (x *faultInjector) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirOpen, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirOpen(path)
+}
+
+func (x *faultInjector) DirList(path []string) ([]string, error) {
+	if err := x.state.apply(OpDirList, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirList(path)
+}
+
+func (x *faultInjector) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirCreateOrOpen, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirCreateOrOpen(path)
+}
+
+func (x *faultInjector) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirCreate, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirCreate(path, layer)
+}
+
+func (x *faultInjector) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirMove, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirMove(oldPath, newPath)
+}
+
+func (x *faultInjector) WithTxOpts(opts TxOpts) Transactor {
+	return &faultInjector{tr: x.tr.WithTxOpts(opts), state: x.state}
+}
+
+// run calls the given function with the transaction. If a call which
+// cannot return an error was faulted, the fault's error is returned.
+func (x *faultTransaction) run(f func(*faultTransaction) (interface{}, error)) (interface{}, error) {
+	out, err := f(x)
+	if err != nil {
+		return nil, err
+	}
+
+	x.fail.mu.Lock()
+	defer x.fail.mu.Unlock()
+	if x.fail.err != nil {
+		return nil, x.fail.err
+	}
+	return out, nil
+}
+
+func (x *faultTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.rtr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		return x.with(tr, nil).run(func(tr *faultTransaction) (interface{}, error) {
+			return f(tr)
+		})
+	})
+}
+
+func (x *faultTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.Transact(func(tr Transaction) (interface{}, error) {
+		return x.with(tr, tr).run(func(tr *faultTransaction) (interface{}, error) {
+			return f(tr)
+		})
+	})
+}
+
+func (x *faultTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirOpen, nil); err != nil {
+		return nil, err
+	}
+	return x.rtr.DirOpen(path)
+}
+
+func (x *faultTransaction) DirList(path []string) ([]string, error) {
+	if err := x.state.apply(OpDirList, nil); err != nil {
+		return nil, err
+	}
+	return x.rtr.DirList(path)
+}
+
+func (x *faultTransaction) DirFind(key []byte) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirFind, nil); err != nil {
+		return nil, err
+	}
+	return x.rtr.DirFind(key)
+}
+
+func (x *faultTransaction) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirCreateOrOpen, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirCreateOrOpen(path)
+}
+
+func (x *faultTransaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirCreate, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirCreate(path, layer)
+}
+
+func (x *faultTransaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	if err := x.state.apply(OpDirMove, nil); err != nil {
+		return nil, err
+	}
+	return x.tr.DirMove(oldPath, newPath)
+}
+
+func (x *faultTransaction) WithTxOpts(opts TxOpts) Transactor {
+	tr := x.tr.WithTxOpts(opts).(Transaction)
+	return x.with(tr, tr)
+}
+
+func (x *faultTransaction) Get(key fdb.KeyConvertible) fdb.FutureByteSlice {
+	effect := x.state.match(OpGet, faultKeys(key))
+	if effect.err != nil {
+		return &faultFutureByteSlice{
+			FutureByteSlice: &resolvedFutureByteSlice{err: effect.err},
+			readyAt:         time.Now().Add(effect.delay),
+		}
+	}
+	return &faultFutureByteSlice{
+		FutureByteSlice: x.rtr.Get(key),
+		readyAt:         time.Now().Add(effect.delay),
+	}
+}
+
+func (x *faultTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) RangeResult {
+	begin, end := rng.FDBRangeKeySelectors()
+	keys := fdb.KeyRange{
+		Begin: begin.FDBKeySelector().Key,
+		End:   end.FDBKeySelector().Key,
+	}
+	return &faultRangeResult{
+		result: x.rtr.GetRange(rng, options),
+		effect: x.state.match(OpGetRange, &keys),
+	}
+}
+
+func (x *faultTransaction) Set(key fdb.KeyConvertible, value []byte) {
+	if x.write(OpSet, key) {
+		x.tr.Set(key, value)
+	}
+}
+
+func (x *faultTransaction) SetWithVStampKey(key fdb.KeyConvertible, value []byte) {
+	if x.write(OpSetVStampKey, key) {
+		x.tr.SetWithVStampKey(key, value)
+	}
+}
+
+func (x *faultTransaction) SetWithVStampValue(key fdb.KeyConvertible, value []byte) {
+	if x.write(OpSetVStampValue, key) {
+		x.tr.SetWithVStampValue(key, value)
+	}
+}
+
+func (x *faultTransaction) Clear(key fdb.KeyConvertible) {
+	if x.write(OpClear, key) {
+		x.tr.Clear(key)
+	}
+}
+
+func (x *faultTransaction) Watch(key fdb.KeyConvertible) fdb.FutureNil {
+	effect := x.state.match(OpWatch, faultKeys(key))
+	return &faultWatch{
+		FutureNil: x.tr.Watch(key),
+		readyAt:   time.Now().Add(effect.delay),
+		err:       effect.err,
+	}
+}
+
+// write applies the faults for a call which cannot return an error.
+// If the call is faulted, the transaction fails & false is returned.
+func (x *faultTransaction) write(op Op, key fdb.KeyConvertible) bool {
+	if err := x.state.apply(op, faultKeys(key)); err != nil {
+		x.fail.mu.Lock()
+		defer x.fail.mu.Unlock()
+		if x.fail.err == nil {
+			x.fail.err = err
+		}
+		return false
+	}
+	return true
+}
+
+// with returns a faultTransaction for the given transaction which
+// shares its failure with this transaction, so a call faulted by
+// either one fails both.
+func (x *faultTransaction) with(rtr ReadTransaction, tr Transaction) *faultTransaction {
+	return &faultTransaction{rtr: rtr, tr: tr, state: x.state, fail: x.fail}
+}
+
+func (x *faultRangeResult) GetSliceWithError() ([]fdb.KeyValue, error) {
+	time.Sleep(x.effect.delay)
+	if x.effect.err != nil {
+		return nil, x.effect.err
+	}
+	return x.result.GetSliceWithError()
+}
+
+func (x *faultRangeResult) Iterator() RangeIterator {
+	return &faultRangeIterator{iter: x.result.Iterator(), effect: x.effect}
+}
+
+func (x *faultRangeIterator) Advance() bool {
+	if x.read == 0 && !x.failed {
+		time.Sleep(x.effect.delay)
+		x.effect.delay = 0
+	}
+	if x.effect.err != nil && x.read >= x.effect.partial {
+		return true
+	}
+	return x.iter.Advance()
+}
+
+func (x *faultRangeIterator) Get() (fdb.KeyValue, error) {
+	if x.effect.err != nil && x.read >= x.effect.partial {
+		x.failed = true
+		return fdb.KeyValue{}, x.effect.err
+	}
+	kv, err := x.iter.Get()
+	if err == nil {
+		x.read++
+	}
+	return kv, err
+}
+
+func (x *faultFutureByteSlice) Get() ([]byte, error) {
+	x.BlockUntilReady()
+	return x.FutureByteSlice.Get()
+}
+
+func (x *faultFutureByteSlice) MustGet() []byte {
+	x.BlockUntilReady()
+	return x.FutureByteSlice.MustGet()
+}
+
+func (x *faultFutureByteSlice) BlockUntilReady() {
+	time.Sleep(time.Until(x.readyAt))
+	x.FutureByteSlice.BlockUntilReady()
+}
+
+func (x *faultFutureByteSlice) IsReady() bool {
+	return !time.Now().Before(x.readyAt) && x.FutureByteSlice.IsReady()
+}
+
+func (x *faultWatch) Get() error {
+	x.BlockUntilReady()
+	if x.err != nil {
+		return x.err
+	}
+	return x.FutureNil.Get()
+}
+
+func (x *faultWatch) MustGet() {
+	if err := x.Get(); err != nil {
+		panic(err)
+	}
+}
+
+// BlockUntilReady waits for the delay to pass. If the watch is faulted
+// with an error, the underlying watch is cancelled instead of waited on.
+func (x *faultWatch) BlockUntilReady() {
+	time.Sleep(time.Until(x.readyAt))
+	if x.err != nil {
+		x.FutureNil.Cancel()
+		return
+	}
+	x.FutureNil.BlockUntilReady()
+}
+
+func (x *faultWatch) IsReady() bool {
+	if time.Now().Before(x.readyAt) {
+		return false
+	}
+	return x.err != nil || x.FutureNil.IsReady()
+}
+
+// apply sleeps for the delay of the faults matching the
+// given call and returns the error of the faults, if any.
+func (x *faultState) apply(op Op, keys *fdb.KeyRange) error {
+	effect := x.match(op, keys)
+	time.Sleep(effect.delay)
+	return effect.err
+}
+
+// match counts the call against each matching fault and returns the
+// combined effect of the faults. The given keys are nil if the call
+// doesn't access keys.
+func (x *faultState) match(op Op, keys *fdb.KeyRange) faultEffect {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var effect faultEffect
+	for i, fault := range x.faults {
+		if !fault.matches(op, keys) {
+			continue
+		}
+		x.counts[i]++
+		if len(fault.Calls) > 0 && !containsInt(fault.Calls, x.counts[i]) {
+			continue
+		}
+
+		effect.delay += fault.Delay
+		if effect.err == nil && fault.Err != nil {
+			effect.err = fault.Err
+			effect.partial = fault.PartialKVs
+		}
+	}
+	return effect
+}
+
+func (x *Fault) matches(op Op, keys *fdb.KeyRange) bool {
+	if len(x.Ops) > 0 {
+		found := false
+		for _, o := range x.Ops {
+			if o == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if x.Keys == nil {
+		return true
+	}
+	if keys == nil {
+		return false
+	}
+	begin, end := x.Keys.FDBRangeKeys()
+	return memOverlap(*keys, fdb.KeyRange{Begin: begin, End: end})
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// faultKeys returns the range containing only the given key.
+func faultKeys(key fdb.KeyConvertible) *fdb.KeyRange {
+	rng := pointRange(key.FDBKey())
+	return &rng
+}
@@ -0,0 +1,170 @@
+package facade_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+)
+
+func TestFault_Retry(t *testing.T) {
+	t.Run("retry", func(t *testing.T) {
+		tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+			Ops:   []facade.Op{facade.OpCommit},
+			Calls: []int{1},
+			Err:   facade.FaultNotCommitted,
+		})
+
+		attempts := 0
+		_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+			attempts++
+			tr.Set(fdb.Key("a"), []byte("1"))
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+			Ops:   []facade.Op{facade.OpCommit},
+			Calls: []int{1},
+			Err:   facade.FaultNotCommitted,
+		})
+
+		_, err := tr.WithTxOpts(facade.TxOpts{RetryLimit: facade.NoRetries}).Transact(func(tr facade.Transaction) (interface{}, error) {
+			tr.Set(fdb.Key("a"), []byte("1"))
+			return nil, nil
+		})
+		require.ErrorIs(t, err, facade.FaultNotCommitted)
+
+		_, err = tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			require.Nil(t, tr.Get(fdb.Key("a")).MustGet())
+			return nil, nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+			Ops: []facade.Op{facade.OpSet},
+			Err: facade.FaultTimedOut,
+		})
+
+		_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+			tr.Set(fdb.Key("a"), []byte("1"))
+			return nil, nil
+		})
+		require.ErrorIs(t, err, facade.FaultTimedOut)
+	})
+
+	t.Run("nested write", func(t *testing.T) {
+		fdb.MustAPIVersion(620)
+
+		db := facade.NewMemTransactor(nil)
+		eg := engine.New(facade.NewFaultInjector(db, facade.Fault{
+			Ops: []facade.Op{facade.OpSet},
+			Err: facade.FaultTimedOut,
+		}))
+
+		// Engine.Set runs within a transaction nested in the one started by Engine.Transact.
+		_, err := eg.Transact(func(eg engine.Engine) (interface{}, error) {
+			return nil, eg.Set(keyval.KeyValue{
+				Key: keyval.Key{
+					Directory: keyval.Directory{keyval.String("dir")},
+					Tuple:     keyval.Tuple{keyval.Int(1)},
+				},
+				Value: keyval.Nil{},
+			})
+		})
+		require.ErrorIs(t, err, facade.FaultTimedOut)
+
+		_, err = db.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			kvs, err := tr.GetRange(fdb.KeyRange{Begin: fdb.Key{}, End: fdb.Key{0xFF}}, fdb.RangeOptions{}).GetSliceWithError()
+			require.NoError(t, err)
+			require.Empty(t, kvs)
+			return nil, nil
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestFault_Keys(t *testing.T) {
+	tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+		Keys: fdb.KeyRange{Begin: fdb.Key("b"), End: fdb.Key("c")},
+		Err:  facade.FaultTimedOut,
+	})
+
+	_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		tr.Set(fdb.Key("a"), []byte("1"))
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	_, err = tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		require.Equal(t, []byte("1"), tr.Get(fdb.Key("a")).MustGet())
+		return tr.Get(fdb.Key("b")).Get()
+	})
+	require.ErrorIs(t, err, facade.FaultTimedOut)
+
+	// The MustGet panic is recovered by the transaction.
+	_, err = tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		return tr.Get(fdb.Key("b")).MustGet(), nil
+	})
+	require.ErrorIs(t, err, facade.FaultTimedOut)
+}
+
+func TestFault_Delay(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+		Ops:   []facade.Op{facade.OpGet},
+		Delay: delay,
+	})
+
+	_, err := tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		start := time.Now()
+		future := tr.Get(fdb.Key("a"))
+		require.False(t, future.IsReady())
+		future.MustGet()
+		require.GreaterOrEqual(t, time.Since(start), delay)
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestFault_PartialRange(t *testing.T) {
+	tr := facade.NewFaultInjector(facade.NewMemTransactor(nil), facade.Fault{
+		Ops:        []facade.Op{facade.OpGetRange},
+		Err:        facade.FaultTimedOut,
+		PartialKVs: 2,
+	})
+
+	_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		for _, k := range []string{"a", "b", "c", "d"} {
+			tr.Set(fdb.Key(k), []byte(k))
+		}
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	_, err = tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		var keys []string
+		iter := tr.GetRange(fdb.KeyRange{Begin: fdb.Key("a"), End: fdb.Key("z")}, fdb.RangeOptions{}).Iterator()
+		for iter.Advance() {
+			kv, err := iter.Get()
+			if err != nil {
+				require.Equal(t, []string{"a", "b"}, keys)
+				return nil, err
+			}
+			keys = append(keys, string(kv.Key))
+		}
+		return nil, nil
+	})
+	require.ErrorIs(t, err, facade.FaultTimedOut)
+}
@@ -24,6 +24,10 @@ type (
 	nilFutureNil struct {
 		fdb.Future
 	}
+
+	nilRangeResult struct{}
+
+	nilRangeIterator struct{}
 )
 
 var (
@@ -35,6 +39,9 @@ var (
 	_ fdb.Future          = &nilFuture{}
 	_ fdb.FutureByteSlice = &nilFutureByteSlice{}
 	_ fdb.FutureNil       = &nilFutureNil{}
+
+	_ RangeResult   = &nilRangeResult{}
+	_ RangeIterator = &nilRangeIterator{}
 )
 
 // NewNilRange returns a nil implementation of fdb.Range
@@ -79,6 +86,12 @@ func NewNilFutureNil() fdb.FutureNil {
 	return &nilFutureNil{NewNilFuture()}
 }
 
+// NewNilRangeResult returns a nil implementation of RangeResult
+// which contains no key-values.
+func NewNilRangeResult() RangeResult {
+	return &nilRangeResult{}
+}
+
 func (x *nilFuture) BlockUntilReady() {}
 
 func (x *nilFuture) IsReady() bool {
@@ -117,3 +130,19 @@ func (x *nilFutureNil) Get() error {
 
 func (x *nilFutureNil) MustGet() {
 }
+
+func (x *nilRangeResult) GetSliceWithError() ([]fdb.KeyValue, error) {
+	return nil, nil
+}
+
+func (x *nilRangeResult) Iterator() RangeIterator {
+	return &nilRangeIterator{}
+}
+
+func (x *nilRangeIterator) Advance() bool {
+	return false
+}
+
+func (x *nilRangeIterator) Get() (fdb.KeyValue, error) {
+	return fdb.KeyValue{}, nil
+}
@@ -0,0 +1,141 @@
+package facade
+
+import (
+	"bytes"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
+)
+
+// The FDB directory layer stores its metadata beneath a node subspace.
+// Each directory has a node, which is the node subspace followed by the
+// directory's packed prefix. A node contains the directory's layer &
+// a key-value for each subdirectory. The subdirectory's key is the
+// node followed by dirSubdirs & the packed name of the subdirectory.
+// The value is the prefix of the subdirectory. The root node is the
+// node subspace followed by its own packed prefix. Partitions have
+// their own node subspace, which is the partition's prefix followed
+// by dirNodes.
+var (
+	dirNodes  = []byte{0xfe}
+	dirLayer  = []byte("layer")
+	dirSubdir = int64(0)
+)
+
+func (x *readTransaction) DirFind(key []byte) (directory.DirectorySubspace, error) {
+	path, err := dirFind(x.tr, subspace.FromBytes(dirNodes), nil, key)
+	if err != nil || path == nil {
+		return nil, err
+	}
+
+	// The path is relative to the root of the directory
+	// layer, so it's made relative to the facade's root.
+	root := x.root.GetPath()
+	if len(path) <= len(root) || !pathsEqual(path[:len(root)], root) {
+		return nil, nil
+	}
+	return x.root.Open(x.tr, path[len(root):], nil)
+}
+
+// dirFind returns the path of the directory, beneath the given node
+// subspace, whose prefix begins the given key. Like the FDB directory
+// layer, the node containing the key is found by reading the last node
+// at or before the key. The node's path is then found by scanning the
+// node subspace for the chain of parents leading back to the root.
+// If no directory contains the key, nil is returned.
+func dirFind(tr fdb.ReadTransaction, nodes subspace.Subspace, path []string, key []byte) ([]string, error) {
+	// The node subspace isn't within any directory.
+	if bytes.HasPrefix(key, nodes.Bytes()) {
+		return nil, nil
+	}
+
+	begin, _ := nodes.FDBRangeKeys()
+	end := append(nodes.Pack(tuple.Tuple{key}), 0x00)
+	kvs, err := tr.GetRange(fdb.KeyRange{Begin: begin, End: fdb.Key(end)}, fdb.RangeOptions{Reverse: true, Limit: 1}).GetSliceWithError()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read directory node")
+	}
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	tup, err := nodes.Unpack(kvs[0].Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack directory node")
+	}
+	prefix, ok := tup[0].([]byte)
+	if !ok || !bytes.HasPrefix(key, prefix) {
+		return nil, nil
+	}
+
+	names, err := dirNames(tr, nodes, prefix)
+	if err != nil || names == nil {
+		return nil, err
+	}
+	path = append(append([]string(nil), path...), names...)
+
+	layer, err := tr.Get(nodes.Pack(tuple.Tuple{prefix, dirLayer})).Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read directory layer")
+	}
+	if string(layer) != PartitionLayer {
+		return path, nil
+	}
+
+	// Partitions can't contain key-values, so the
+	// key must be within one of their subdirectories.
+	partNodes := subspace.FromBytes(append(append([]byte(nil), prefix...), dirNodes...))
+	return dirFind(tr, partNodes, path, key)
+}
+
+// dirNames returns the names leading from the root of the given node
+// subspace to the node with the given prefix. If the node isn't
+// connected to the root, nil is returned. Nodes don't reference their
+// parent, so the path is found by reading the subdirectories of each
+// node, level by level, starting at the root. Only the subdirectory
+// entries of the nodes are read & the search stops once the node
+// with the given prefix is reached.
+func dirNames(tr fdb.ReadTransaction, nodes subspace.Subspace, prefix []byte) ([]string, error) {
+	type dirNode struct {
+		prefix []byte
+		names  []string
+	}
+
+	level := []dirNode{{prefix: nodes.Bytes()}}
+	for len(level) > 0 {
+		// The subdirectory reads of a level are issued
+		// together so they're performed concurrently.
+		results := make([]fdb.RangeResult, len(level))
+		for i, node := range level {
+			results[i] = tr.GetRange(nodes.Sub(node.prefix, dirSubdir), fdb.RangeOptions{})
+		}
+
+		var next []dirNode
+		for i, node := range level {
+			kvs, err := results[i].GetSliceWithError()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read subdirectories")
+			}
+			subdirs := nodes.Sub(node.prefix, dirSubdir)
+			for _, kv := range kvs {
+				tup, err := subdirs.Unpack(kv.Key)
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to unpack subdirectory")
+				}
+				name, ok := tup[0].(string)
+				if len(tup) != 1 || !ok {
+					continue
+				}
+				names := append(append([]string(nil), node.names...), name)
+				if bytes.Equal(kv.Value, prefix) {
+					return names, nil
+				}
+				next = append(next, dirNode{prefix: kv.Value, names: names})
+			}
+		}
+		level = next
+	}
+	return nil, nil
+}
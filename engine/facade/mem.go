@@ -0,0 +1,776 @@
+package facade
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotCommitted is returned by an in-memory transaction which
+	// conflicted with another transaction. Transactions are retried
+	// after this error, as limited by TxOpts.RetryLimit.
+	ErrNotCommitted = errors.New("transaction not committed due to conflict with another transaction")
+
+	// ErrTimedOut is returned by an in-memory transaction which took
+	// longer than the duration specified by TxOpts.Timeout. Reads
+	// performed after the timeout expires also fail with this error.
+	ErrTimedOut = errors.New("operation aborted because the transaction timed out")
+
+	// ErrCancelled is returned by an in-memory watch which was
+	// cancelled or whose transaction failed to commit.
+	ErrCancelled = errors.New("operation was cancelled")
+)
+
+const (
+	memInitialRetryDelay = 10 * time.Millisecond
+	memMaxRetryDelay     = time.Second
+)
+
+type (
+	// memStore is the state shared by all the transactions of
+	// an in-memory database. Committed key-values are stored in
+	// a sorted slice which is never modified after it's stored.
+	// Each commit replaces the slice with an updated copy, which
+	// allows transactions to read from a consistent snapshot.
+	memStore struct {
+		mu      sync.Mutex
+		data    []fdb.KeyValue
+		version int64
+
+		// commits contains the keys written by recent commits.
+		// When a transaction commits, the commits performed
+		// after its read version are checked for conflicts.
+		commits []memCommit
+
+		// active counts the ongoing transactions by read
+		// version. Commits which aren't newer than every
+		// active read version are discarded.
+		active map[int64]int
+
+		watches map[*memWatch]struct{}
+	}
+
+	memCommit struct {
+		version int64
+		writes  []fdb.KeyRange
+	}
+
+	memOpKind int
+
+	memOp struct {
+		kind  memOpKind
+		key   []byte
+		value []byte
+	}
+
+	memTransactor struct {
+		store *memStore
+		opts  TxOpts
+		root  []string
+	}
+
+	memTransaction struct {
+		mu          sync.Mutex
+		store       *memStore
+		opts        TxOpts
+		root        []string
+		readVersion int64
+
+		// deadline is when the transaction times out.
+		// It's zero if the transaction has no timeout.
+		deadline time.Time
+
+		// view contains the snapshot read by the transaction
+		// with the transaction's own writes applied. It's
+		// copied before the first write so the snapshot,
+		// which is shared, isn't modified.
+		view  []fdb.KeyValue
+		owned bool
+
+		reads   []fdb.KeyRange
+		ops     []memOp
+		watches []*memWatch
+	}
+
+	memRangeResult struct {
+		kvs []fdb.KeyValue
+		err error
+	}
+
+	memRangeIterator struct {
+		kvs []fdb.KeyValue
+		err error
+		i   int
+	}
+
+	memFutureByteSlice struct {
+		value []byte
+		err   error
+	}
+
+	memWatch struct {
+		store *memStore
+		key   []byte
+		value []byte
+		done  chan struct{}
+		once  sync.Once
+		err   error
+	}
+)
+
+const (
+	memOpSet memOpKind = iota
+	memOpClear
+	memOpSetVStampKey
+	memOpSetVStampValue
+)
+
+var (
+	_ Transactor          = &memTransactor{}
+	_ Transaction         = &memTransaction{}
+	_ RangeResult         = &memRangeResult{}
+	_ RangeIterator       = &memRangeIterator{}
+	_ fdb.FutureNil       = &memWatch{}
+	_ fdb.FutureByteSlice = &memFutureByteSlice{}
+)
+
+// NewMemTransactor returns a Transactor backed by an in-memory database. The
+// database starts empty & is discarded once the Transactor is no longer used.
+// It's intended for tests & demos which can't access an FDB cluster. Like
+// the Transactor returned by NewTransactor, directories are opened relative
+// to the given root path, which may be nil.
+//
+// Transactions read from a consistent snapshot & observe their own writes.
+// When a transaction commits, it fails with ErrNotCommitted if another
+// transaction committed a write to a key it read after its snapshot was
+// taken. Like FDB, failed transactions are retried. Directories are stored
+// in the same keyspace as other key-values, beneath the 0xfe prefix, and
+// have the same semantics as the FDB directory layer. Versionstamps are
+// derived from the commit version. Versionstamped writes aren't visible to
+// the transaction which performed them. Watches become active once their
+// transaction commits. Transaction priorities & tags have no effect.
+func NewMemTransactor(root []string) Transactor {
+	return &memTransactor{
+		store: &memStore{
+			active:  make(map[int64]int),
+			watches: make(map[*memWatch]struct{}),
+		},
+		root: root,
+	}
+}
+
+func (x *memTransactor) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.retry(false, func(tr *memTransaction) (interface{}, error) {
+		return f(tr)
+	})
+}
+
+func (x *memTransactor) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		return tr.DirOpen(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+func (x *memTransactor) DirList(path []string) ([]string, error) {
+	names, err := x.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		return tr.DirList(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names.([]string), nil
+}
+
+func (x *memTransactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return x.retry(true, func(tr *memTransaction) (interface{}, error) {
+		return f(tr)
+	})
+}
+
+// retry calls the given function with a new transaction until the function
+// succeeds or fails with a non-retryable error. If commit is true, the
+// transaction's writes are committed after the function succeeds.
+func (x *memTransactor) retry(commit bool, f func(*memTransaction) (interface{}, error)) (interface{}, error) {
+	if err := x.opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var deadline time.Time
+	if x.opts.Timeout != 0 {
+		deadline = time.Now().Add(x.opts.Timeout)
+	}
+
+	maxDelay := memMaxRetryDelay
+	if x.opts.MaxRetryDelay != 0 {
+		maxDelay = x.opts.MaxRetryDelay
+	}
+	delay := memInitialRetryDelay
+
+	for retries := 0; ; retries++ {
+		tr := x.store.begin(x.opts, x.root, deadline)
+		out, err := memAttempt(tr, f)
+		if err == nil && commit {
+			err = x.store.commit(tr)
+		}
+		x.store.end(tr, err)
+
+		if !memRetryable(err) {
+			if err != nil {
+				return nil, err
+			}
+			return out, nil
+		}
+		if x.opts.RetryLimit == NoRetries || (x.opts.RetryLimit > 0 && retries >= x.opts.RetryLimit) {
+			return nil, err
+		}
+
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (x *memTransactor) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.transactDir(func(tr Transaction) (directory.DirectorySubspace, error) {
+		return tr.DirCreateOrOpen(path)
+	})
+}
+
+func (x *memTransactor) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.transactDir(func(tr Transaction) (directory.DirectorySubspace, error) {
+		return tr.DirCreate(path, layer)
+	})
+}
+
+func (x *memTransactor) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.transactDir(func(tr Transaction) (directory.DirectorySubspace, error) {
+		return tr.DirMove(oldPath, newPath)
+	})
+}
+
+func (x *memTransactor) transactDir(f func(Transaction) (directory.DirectorySubspace, error)) (directory.DirectorySubspace, error) {
+	dir, err := x.Transact(func(tr Transaction) (interface{}, error) {
+		return f(tr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+func (x *memTransactor) WithTxOpts(opts TxOpts) Transactor {
+	return &memTransactor{store: x.store, opts: opts, root: x.root}
+}
+
+func (x *memTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	if err := x.validate(); err != nil {
+		return nil, err
+	}
+	return f(x)
+}
+
+func (x *memTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	if err := x.validate(); err != nil {
+		return nil, err
+	}
+	return f(x)
+}
+
+// WithTxOpts applies the given options to the ongoing transaction. The
+// timeout & retry options only affect a transaction when it's created,
+// so they have no effect on the ongoing transaction.
+func (x *memTransaction) WithTxOpts(opts TxOpts) Transactor {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.opts = opts
+	return x
+}
+
+func (x *memTransaction) validate() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.opts.validate()
+}
+
+func (x *memTransaction) Get(key fdb.KeyConvertible) fdb.FutureByteSlice {
+	k := key.FDBKey()
+
+	if x.expired() {
+		return &memFutureByteSlice{err: ErrTimedOut}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.reads = append(x.reads, pointRange(k))
+	value, _ := memGet(x.view, k)
+	return &memFutureByteSlice{value: value}
+}
+
+func (x *memTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) RangeResult {
+	beginSel, endSel := rng.FDBRangeKeySelectors()
+	begin := beginSel.FDBKeySelector()
+	end := endSel.FDBKeySelector()
+
+	if x.expired() {
+		return &memRangeResult{err: ErrTimedOut}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	i := memResolve(x.view, begin)
+	j := memResolve(x.view, end)
+	if j < i {
+		j = i
+	}
+
+	// Key selectors with offsets may resolve to keys outside of
+	// the keys they reference, so the conflict range includes
+	// both the referenced & the resolved keys.
+	conflict := fdb.KeyRange{Begin: begin.Key.FDBKey(), End: end.Key.FDBKey()}
+	if i < len(x.view) && bytes.Compare(x.view[i].Key, conflict.Begin.FDBKey()) < 0 {
+		conflict.Begin = x.view[i].Key
+	}
+	if j > 0 && bytes.Compare(x.view[j-1].Key, conflict.End.FDBKey()) >= 0 {
+		conflict.End = append(append(fdb.Key(nil), x.view[j-1].Key...), 0x00)
+	}
+	x.reads = append(x.reads, conflict)
+
+	kvs := make([]fdb.KeyValue, 0, j-i)
+	kvs = append(kvs, x.view[i:j]...)
+	if options.Reverse {
+		for a, b := 0, len(kvs)-1; a < b; a, b = a+1, b-1 {
+			kvs[a], kvs[b] = kvs[b], kvs[a]
+		}
+	}
+	if options.Limit > 0 && len(kvs) > options.Limit {
+		kvs = kvs[:options.Limit]
+	}
+	return &memRangeResult{kvs: kvs}
+}
+
+// expired returns true if the transaction's deadline has passed.
+func (x *memTransaction) expired() bool {
+	return !x.deadline.IsZero() && time.Now().After(x.deadline)
+}
+
+func (x *memTransaction) Set(key fdb.KeyConvertible, value []byte) {
+	x.write(memOp{kind: memOpSet, key: key.FDBKey(), value: value})
+}
+
+func (x *memTransaction) SetWithVStampKey(key fdb.KeyConvertible, value []byte) {
+	x.write(memOp{kind: memOpSetVStampKey, key: key.FDBKey(), value: value})
+}
+
+func (x *memTransaction) SetWithVStampValue(key fdb.KeyConvertible, value []byte) {
+	x.write(memOp{kind: memOpSetVStampValue, key: key.FDBKey(), value: value})
+}
+
+func (x *memTransaction) Clear(key fdb.KeyConvertible) {
+	x.write(memOp{kind: memOpClear, key: key.FDBKey()})
+}
+
+func (x *memTransaction) write(op memOp) {
+	op.key = append([]byte(nil), op.key...)
+	if op.value != nil {
+		op.value = append([]byte(nil), op.value...)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.ops = append(x.ops, op)
+
+	// Versionstamped writes aren't visible until they're
+	// committed because their bytes aren't known until then.
+	switch op.kind {
+	case memOpSet, memOpClear:
+		if !x.owned {
+			x.view = append([]fdb.KeyValue(nil), x.view...)
+			x.owned = true
+		}
+		x.view = memApply(x.view, op)
+	}
+}
+
+func (x *memTransaction) Watch(key fdb.KeyConvertible) fdb.FutureNil {
+	k := append([]byte(nil), key.FDBKey()...)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	value, _ := memGet(x.view, k)
+	watch := &memWatch{store: x.store, key: k, value: value, done: make(chan struct{})}
+	x.watches = append(x.watches, watch)
+	return watch
+}
+
+func (x *memStore) begin(opts TxOpts, root []string, deadline time.Time) *memTransaction {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.active[x.version]++
+	return &memTransaction{
+		store:       x,
+		opts:        opts,
+		root:        root,
+		readVersion: x.version,
+		deadline:    deadline,
+		view:        x.data,
+	}
+}
+
+// end deregisters the given transaction. If the transaction
+// failed, its watches are cancelled.
+func (x *memStore) end(tr *memTransaction, err error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.active[tr.readVersion]--
+	if x.active[tr.readVersion] == 0 {
+		delete(x.active, tr.readVersion)
+	}
+
+	oldest := x.version
+	for version := range x.active {
+		if version < oldest {
+			oldest = version
+		}
+	}
+	i := 0
+	for i < len(x.commits) && x.commits[i].version <= oldest {
+		i++
+	}
+	x.commits = x.commits[i:]
+
+	if err != nil {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		for _, watch := range tr.watches {
+			watch.fire(ErrCancelled)
+		}
+	}
+}
+
+// commit applies the writes of the given transaction to the
+// store, unless the transaction conflicts with a commit made
+// after its read version or its deadline has passed.
+func (x *memStore) commit(tr *memTransaction) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.expired() {
+		return ErrTimedOut
+	}
+
+	for _, commit := range x.commits {
+		if commit.version <= tr.readVersion {
+			continue
+		}
+		for _, write := range commit.writes {
+			for _, read := range tr.reads {
+				if memOverlap(write, read) {
+					return ErrNotCommitted
+				}
+			}
+		}
+	}
+
+	if len(tr.ops) > 0 {
+		version := x.version + 1
+		data := append([]fdb.KeyValue(nil), x.data...)
+		commit := memCommit{version: version}
+
+		for _, op := range tr.ops {
+			var err error
+			op, err = memStamp(op, version)
+			if err != nil {
+				return err
+			}
+			data = memApply(data, op)
+			commit.writes = append(commit.writes, pointRange(op.key))
+		}
+
+		x.data = data
+		x.version = version
+		x.commits = append(x.commits, commit)
+
+		for watch := range x.watches {
+			if value, _ := memGet(x.data, watch.key); !bytes.Equal(value, watch.value) {
+				delete(x.watches, watch)
+				watch.fire(nil)
+			}
+		}
+	}
+
+	for _, watch := range tr.watches {
+		if value, _ := memGet(x.data, watch.key); !bytes.Equal(value, watch.value) {
+			watch.fire(nil)
+			continue
+		}
+		x.watches[watch] = struct{}{}
+	}
+	return nil
+}
+
+func (x *memStore) cancelWatch(watch *memWatch) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.watches, watch)
+}
+
+// memAttempt calls the given function with the given transaction. Like
+// the FDB bindings, a panicked fdb.Error is recovered & returned. This
+// allows futures to be resolved via MustGet.
+func memAttempt(tr *memTransaction, f func(*memTransaction) (interface{}, error)) (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(fdb.Error); ok {
+				out, err = nil, e
+				return
+			}
+			// MustGet panics if a read timed out.
+			if r == ErrTimedOut {
+				out, err = nil, ErrTimedOut
+				return
+			}
+			panic(r)
+		}
+	}()
+	return f(tr)
+}
+
+// memRetryable returns true if a transaction which failed with the
+// given error should be retried. Besides ErrNotCommitted, the FDB
+// errors which are retried are the ones usually caused by conflicts
+// or by transactions running too long. Like the FDB bindings, wrapped
+// fdb.Errors aren't retried.
+func memRetryable(err error) bool {
+	if errors.Is(err, ErrNotCommitted) {
+		return true
+	}
+	if e, ok := err.(fdb.Error); ok {
+		switch e.Code {
+		case codeTransactionTooOld, codeNotCommitted, codeCommitUnknownResult:
+			return true
+		}
+	}
+	return false
+}
+
+// memStamp replaces the versionstamp placeholder of the given
+// operation with the versionstamp of the given commit version.
+// The placeholder's offset is given by the last 4 bytes of the
+// key or value, as required by FDB.
+func memStamp(op memOp, version int64) (memOp, error) {
+	var target *[]byte
+	switch op.kind {
+	case memOpSetVStampKey:
+		target = &op.key
+	case memOpSetVStampValue:
+		target = &op.value
+	default:
+		return op, nil
+	}
+
+	packed := *target
+	if len(packed) < 4 {
+		return op, errors.New("versionstamp offset is missing")
+	}
+	offset := int(binary.LittleEndian.Uint32(packed[len(packed)-4:]))
+	packed = packed[:len(packed)-4]
+	if offset+10 > len(packed) {
+		return op, errors.Errorf("versionstamp offset %d is out of bounds", offset)
+	}
+
+	// The versionstamp is the 8-byte commit version followed
+	// by the 2-byte batch order. Each commit is its own batch.
+	stamped := append([]byte(nil), packed...)
+	binary.BigEndian.PutUint64(stamped[offset:], uint64(version))
+	binary.BigEndian.PutUint16(stamped[offset+8:], 0)
+	*target = stamped
+
+	op.kind = memOpSet
+	return op, nil
+}
+
+// memApply applies the given set or clear operation to the given
+// sorted key-values, modifying the slice in place.
+func memApply(kvs []fdb.KeyValue, op memOp) []fdb.KeyValue {
+	i := memSearch(kvs, op.key)
+	exists := i < len(kvs) && bytes.Equal(kvs[i].Key, op.key)
+
+	switch op.kind {
+	case memOpSet:
+		kv := fdb.KeyValue{Key: op.key, Value: op.value}
+		if kv.Value == nil {
+			kv.Value = []byte{}
+		}
+		if exists {
+			kvs[i] = kv
+			return kvs
+		}
+		kvs = append(kvs, fdb.KeyValue{})
+		copy(kvs[i+1:], kvs[i:])
+		kvs[i] = kv
+		return kvs
+
+	case memOpClear:
+		if !exists {
+			return kvs
+		}
+		return append(kvs[:i], kvs[i+1:]...)
+
+	default:
+		return kvs
+	}
+}
+
+// memSearch returns the index of the first key-value
+// whose key is greater than or equal to the given key.
+func memSearch(kvs []fdb.KeyValue, key []byte) int {
+	return sort.Search(len(kvs), func(i int) bool {
+		return bytes.Compare(kvs[i].Key, key) >= 0
+	})
+}
+
+func memGet(kvs []fdb.KeyValue, key []byte) ([]byte, bool) {
+	i := memSearch(kvs, key)
+	if i < len(kvs) && bytes.Equal(kvs[i].Key, key) {
+		return kvs[i].Value, true
+	}
+	return nil, false
+}
+
+// memResolve returns the index of the key-value the given key selector
+// refers to. The returned index may equal the length of the slice.
+func memResolve(kvs []fdb.KeyValue, sel fdb.KeySelector) int {
+	key := sel.Key.FDBKey()
+
+	// Find the index of the last key which is less than
+	// the selector's key, or equal to it if OrEqual is set.
+	i := sort.Search(len(kvs), func(i int) bool {
+		c := bytes.Compare(kvs[i].Key, key)
+		if sel.OrEqual {
+			return c > 0
+		}
+		return c >= 0
+	}) - 1
+
+	i += sel.Offset
+	if i < 0 {
+		return 0
+	}
+	if i > len(kvs) {
+		return len(kvs)
+	}
+	return i
+}
+
+func pointRange(key []byte) fdb.KeyRange {
+	end := append(append(fdb.Key(nil), key...), 0x00)
+	return fdb.KeyRange{Begin: fdb.Key(key), End: end}
+}
+
+func memOverlap(a, b fdb.KeyRange) bool {
+	return bytes.Compare(a.Begin.FDBKey(), b.End.FDBKey()) < 0 &&
+		bytes.Compare(b.Begin.FDBKey(), a.End.FDBKey()) < 0
+}
+
+func (x *memRangeResult) GetSliceWithError() ([]fdb.KeyValue, error) {
+	return x.kvs, x.err
+}
+
+func (x *memRangeResult) Iterator() RangeIterator {
+	return &memRangeIterator{kvs: x.kvs, err: x.err, i: -1}
+}
+
+func (x *memRangeIterator) Advance() bool {
+	if x.err != nil || x.i+1 >= len(x.kvs) {
+		return false
+	}
+	x.i++
+	return true
+}
+
+func (x *memRangeIterator) Get() (fdb.KeyValue, error) {
+	if x.err != nil {
+		return fdb.KeyValue{}, x.err
+	}
+	if x.i < 0 || x.i >= len(x.kvs) {
+		return fdb.KeyValue{}, errors.New("iterator isn't at a key-value")
+	}
+	return x.kvs[x.i], nil
+}
+
+func (x *memFutureByteSlice) Get() ([]byte, error) {
+	return x.value, x.err
+}
+
+func (x *memFutureByteSlice) MustGet() []byte {
+	if x.err != nil {
+		panic(x.err)
+	}
+	return x.value
+}
+
+func (x *memFutureByteSlice) BlockUntilReady() {}
+
+func (x *memFutureByteSlice) IsReady() bool {
+	return true
+}
+
+func (x *memFutureByteSlice) Cancel() {}
+
+func (x *memWatch) fire(err error) {
+	x.once.Do(func() {
+		x.err = err
+		close(x.done)
+	})
+}
+
+func (x *memWatch) Get() error {
+	<-x.done
+	return x.err
+}
+
+func (x *memWatch) MustGet() {
+	if err := x.Get(); err != nil {
+		panic(err)
+	}
+}
+
+func (x *memWatch) BlockUntilReady() {
+	<-x.done
+}
+
+func (x *memWatch) IsReady() bool {
+	select {
+	case <-x.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (x *memWatch) Cancel() {
+	x.store.cancelWatch(x)
+	x.fire(ErrCancelled)
+}
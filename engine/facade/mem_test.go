@@ -0,0 +1,371 @@
+package facade
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// The tuple layer requires an API version
+	// when packing versionstamps.
+	fdb.MustAPIVersion(620)
+}
+
+func TestMem_ReadWrite(t *testing.T) {
+	tr := NewMemTransactor(nil)
+
+	_, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+		tr.Set(fdb.Key("a"), []byte("1"))
+		tr.Set(fdb.Key("b"), []byte("2"))
+		tr.Set(fdb.Key("c"), []byte("3"))
+
+		// Transactions observe their own writes.
+		require.Equal(t, []byte("2"), tr.Get(fdb.Key("b")).MustGet())
+		tr.Clear(fdb.Key("b"))
+		require.Nil(t, tr.Get(fdb.Key("b")).MustGet())
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	_, err = tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		require.Equal(t, []byte("1"), tr.Get(fdb.Key("a")).MustGet())
+		require.Nil(t, tr.Get(fdb.Key("b")).MustGet())
+		require.Equal(t, []byte("3"), tr.Get(fdb.Key("c")).MustGet())
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	// Failed transactions don't write.
+	_, err = tr.Transact(func(tr Transaction) (interface{}, error) {
+		tr.Set(fdb.Key("d"), []byte("4"))
+		return nil, ErrTimedOut
+	})
+	require.ErrorIs(t, err, ErrTimedOut)
+
+	_, err = tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		require.Nil(t, tr.Get(fdb.Key("d")).MustGet())
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMem_Timeout(t *testing.T) {
+	tr := NewMemTransactor(nil).WithTxOpts(TxOpts{Timeout: 10 * time.Millisecond})
+
+	// Reads made after the timeout expires fail,
+	// even if the transaction doesn't commit.
+	_, err := tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		_, err := tr.Get(fdb.Key("a")).Get()
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = tr.Get(fdb.Key("a")).Get()
+		require.ErrorIs(t, err, ErrTimedOut)
+		_, err = tr.GetRange(fdb.KeyRange{Begin: fdb.Key("a"), End: fdb.Key("z")}, fdb.RangeOptions{}).GetSliceWithError()
+		require.ErrorIs(t, err, ErrTimedOut)
+
+		iter := tr.GetRange(fdb.KeyRange{Begin: fdb.Key("a"), End: fdb.Key("z")}, fdb.RangeOptions{}).Iterator()
+		require.False(t, iter.Advance())
+		_, err = iter.Get()
+		require.ErrorIs(t, err, ErrTimedOut)
+
+		// MustGet panics, failing the transaction.
+		return tr.Get(fdb.Key("a")).MustGet(), nil
+	})
+	require.ErrorIs(t, err, ErrTimedOut)
+
+	_, err = tr.Transact(func(tr Transaction) (interface{}, error) {
+		tr.Set(fdb.Key("a"), []byte("1"))
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	})
+	require.ErrorIs(t, err, ErrTimedOut)
+}
+
+func TestMem_GetRange(t *testing.T) {
+	tr := NewMemTransactor(nil)
+
+	_, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+		for _, k := range []string{"a", "b", "c", "d", "e"} {
+			tr.Set(fdb.Key(k), []byte(k))
+		}
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		rng      fdb.Range
+		opts     fdb.RangeOptions
+		expected []string
+	}{
+		{
+			name:     "key range",
+			rng:      fdb.KeyRange{Begin: fdb.Key("b"), End: fdb.Key("d")},
+			expected: []string{"b", "c"},
+		},
+		{
+			name:     "limit",
+			rng:      fdb.KeyRange{Begin: fdb.Key("a"), End: fdb.Key("z")},
+			opts:     fdb.RangeOptions{Limit: 2},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "reverse",
+			rng:      fdb.KeyRange{Begin: fdb.Key("a"), End: fdb.Key("z")},
+			opts:     fdb.RangeOptions{Limit: 2, Reverse: true},
+			expected: []string{"e", "d"},
+		},
+		{
+			name: "selectors",
+			rng: fdb.SelectorRange{
+				Begin: fdb.FirstGreaterThan(fdb.Key("a")),
+				End:   fdb.LastLessOrEqual(fdb.Key("c")),
+			},
+			expected: []string{"b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+				var actual []string
+				iter := tr.GetRange(test.rng, test.opts).Iterator()
+				for iter.Advance() {
+					kv, err := iter.Get()
+					require.NoError(t, err)
+					actual = append(actual, string(kv.Key))
+				}
+				require.Equal(t, test.expected, actual)
+				return nil, nil
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMem_Conflict(t *testing.T) {
+	t.Run("retry", func(t *testing.T) {
+		tr := NewMemTransactor(nil)
+
+		attempts := 0
+		_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+			attempts++
+			tx.Get(fdb.Key("a")).MustGet()
+
+			// Write the read key in another transaction,
+			// causing the first attempt to conflict.
+			if attempts == 1 {
+				_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+					tx.Set(fdb.Key("a"), []byte("other"))
+					return nil, nil
+				})
+				require.NoError(t, err)
+			}
+
+			tx.Set(fdb.Key("b"), []byte("done"))
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		tr := NewMemTransactor(nil)
+
+		_, err := tr.WithTxOpts(TxOpts{RetryLimit: NoRetries}).Transact(func(tx Transaction) (interface{}, error) {
+			tx.Get(fdb.Key("a")).MustGet()
+			_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+				tx.Set(fdb.Key("a"), []byte("other"))
+				return nil, nil
+			})
+			require.NoError(t, err)
+			return nil, nil
+		})
+		require.ErrorIs(t, err, ErrNotCommitted)
+	})
+
+	t.Run("blind write", func(t *testing.T) {
+		tr := NewMemTransactor(nil)
+
+		attempts := 0
+		_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+			attempts++
+			_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+				tx.Set(fdb.Key("a"), []byte("other"))
+				return nil, nil
+			})
+			require.NoError(t, err)
+			tx.Set(fdb.Key("a"), []byte("mine"))
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, attempts)
+	})
+}
+
+func TestMem_Versionstamp(t *testing.T) {
+	tr := NewMemTransactor(nil)
+
+	var stamps []tuple.Versionstamp
+	for i := 0; i < 2; i++ {
+		_, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+			key, err := tuple.Tuple{"k", tuple.IncompleteVersionstamp(0)}.PackWithVersionstamp(nil)
+			require.NoError(t, err)
+			tr.SetWithVStampKey(fdb.Key(key), nil)
+
+			val, err := tuple.Tuple{tuple.IncompleteVersionstamp(0)}.PackWithVersionstamp(nil)
+			require.NoError(t, err)
+			tr.SetWithVStampValue(fdb.Key("v"), val)
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		_, err = tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+			val, err := tuple.Unpack(tr.Get(fdb.Key("v")).MustGet())
+			require.NoError(t, err)
+			stamps = append(stamps, val[0].(tuple.Versionstamp))
+			return nil, nil
+		})
+		require.NoError(t, err)
+	}
+	require.Negative(t, bytes.Compare(stamps[0].TransactionVersion[:], stamps[1].TransactionVersion[:]))
+
+	_, err := tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		kvs, err := tr.GetRange(tuple.Tuple{"k"}, fdb.RangeOptions{}).GetSliceWithError()
+		require.NoError(t, err)
+		require.Len(t, kvs, 2)
+
+		for i, kv := range kvs {
+			key, err := tuple.Unpack(kv.Key)
+			require.NoError(t, err)
+			require.Equal(t, stamps[i], key[1])
+		}
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMem_Watch(t *testing.T) {
+	t.Run("fire", func(t *testing.T) {
+		tr := NewMemTransactor(nil)
+
+		watch, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+			return tr.Watch(fdb.Key("a")), nil
+		})
+		require.NoError(t, err)
+		require.False(t, watch.(fdb.FutureNil).IsReady())
+
+		_, err = tr.Transact(func(tr Transaction) (interface{}, error) {
+			tr.Set(fdb.Key("a"), []byte("changed"))
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, watch.(fdb.FutureNil).Get())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		tr := NewMemTransactor(nil)
+
+		var watch fdb.FutureNil
+		_, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+			watch = tr.Watch(fdb.Key("a"))
+			return nil, ErrTimedOut
+		})
+		require.ErrorIs(t, err, ErrTimedOut)
+		require.ErrorIs(t, watch.Get(), ErrCancelled)
+	})
+}
+
+func TestMem_Directories(t *testing.T) {
+	tr := NewMemTransactor([]string{"root"})
+
+	a, err := tr.DirCreateOrOpen([]string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "a", "b"}, a.GetPath())
+
+	again, err := tr.DirOpen([]string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, a.Bytes(), again.Bytes())
+
+	_, err = tr.DirCreate([]string{"a", "b"}, nil)
+	require.ErrorIs(t, err, directory.ErrDirAlreadyExists)
+
+	_, err = tr.DirOpen([]string{"missing"})
+	require.ErrorIs(t, err, directory.ErrDirNotExists)
+
+	names, err := tr.DirList(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, names)
+
+	part, err := tr.DirCreate([]string{"p"}, []byte(PartitionLayer))
+	require.NoError(t, err)
+	require.True(t, IsPartition(part))
+
+	inner, err := tr.DirCreateOrOpen([]string{"p", "c"})
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(inner.Bytes(), part.(*memPartitionSubspace).Subspace.Bytes()))
+
+	_, err = tr.DirMove([]string{"a"}, []string{"p", "a"})
+	require.EqualError(t, err, "cannot move between partitions")
+
+	_, err = tr.DirMove([]string{"a"}, []string{"a", "x"})
+	require.Error(t, err)
+
+	moved, err := tr.DirMove([]string{"a"}, []string{"z"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "z"}, moved.GetPath())
+
+	b, err := tr.DirOpen([]string{"z", "b"})
+	require.NoError(t, err)
+	require.Equal(t, a.Bytes(), b.Bytes())
+
+	_, err = tr.DirOpen([]string{"a"})
+	require.ErrorIs(t, err, directory.ErrDirNotExists)
+}
+
+func TestMem_DirFind(t *testing.T) {
+	tr := NewMemTransactor([]string{"root"})
+
+	a, err := tr.DirCreateOrOpen([]string{"a"})
+	require.NoError(t, err)
+	part, err := tr.DirCreate([]string{"p"}, []byte(PartitionLayer))
+	require.NoError(t, err)
+	inner, err := tr.DirCreateOrOpen([]string{"p", "c"})
+	require.NoError(t, err)
+
+	partPrefix := part.(*memPartitionSubspace).Subspace.Bytes()
+	tests := map[string]struct {
+		key  []byte
+		path []string
+	}{
+		"directory":  {key: a.Pack(tuple.Tuple{1}), path: []string{"root", "a"}},
+		"prefix":     {key: a.Bytes(), path: []string{"root", "a"}},
+		"partition":  {key: append(partPrefix, 0x00)},
+		"subdir":     {key: inner.Pack(tuple.Tuple{"x"}), path: []string{"root", "p", "c"}},
+		"no dir":     {key: []byte{0x01, 0x02}},
+		"empty key":  {key: nil},
+		"dir layer":  {key: memAlloc},
+		"meta range": {key: memNodes.Bytes()},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+				return tr.DirFind(test.key)
+			})
+			require.NoError(t, err)
+			if test.path == nil {
+				require.Nil(t, dir)
+				return
+			}
+			require.Equal(t, test.path, dir.(directory.DirectorySubspace).GetPath())
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package facade
+
+import (
+	"bytes"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
+)
+
+// The in-memory directory layer stores a key-value for each
+// directory. The key is the directory's path packed within
+// memNodes. The value is a packed tuple containing the
+// directory's prefix & layer. The last allocated prefix
+// number is stored at memAlloc.
+var (
+	memDirs   = subspace.FromBytes([]byte{0xfe})
+	memNodes  = memDirs.Sub("node")
+	memAlloc  = memDirs.Pack(tuple.Tuple{"alloc"})
+	errMemDir = errors.New("directories which aren't backed by FDB must be accessed via a facade.Transactor")
+)
+
+type (
+	memNode struct {
+		path   []string
+		prefix []byte
+		layer  []byte
+	}
+
+	// memDirectorySubspace is the directory.DirectorySubspace
+	// returned by the in-memory directory layer & by replayed
+	// recordings. The methods of directory.Directory require an
+	// FDB transaction, so they return an error instead.
+	memDirectorySubspace struct {
+		subspace.Subspace
+		path  []string
+		layer []byte
+	}
+
+	// memPartitionSubspace is returned for the root of a
+	// partition. Like the FDB bindings, it panics if used
+	// as a subspace.
+	memPartitionSubspace struct {
+		memDirectorySubspace
+	}
+)
+
+var (
+	_ directory.DirectorySubspace = &memDirectorySubspace{}
+	_ directory.DirectorySubspace = &memPartitionSubspace{}
+)
+
+func (x *memTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the root directory cannot be opened")
+	}
+	node, err := x.dirNode(x.abs(path))
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, directory.ErrDirNotExists
+	}
+	return node.subspace(), nil
+}
+
+func (x *memTransaction) DirList(path []string) ([]string, error) {
+	// The root is treated as existing, even
+	// if no directories were created in it.
+	if len(path) > 0 {
+		node, err := x.dirNode(x.abs(path))
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, directory.ErrDirNotExists
+		}
+	}
+	path = x.abs(path)
+
+	nodes, err := x.dirDescendants(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, node := range nodes {
+		if len(node.path) == len(path)+1 {
+			names = append(names, node.path[len(path)])
+		}
+	}
+	return names, nil
+}
+
+func (x *memTransaction) DirFind(key []byte) (directory.DirectorySubspace, error) {
+	nodes, err := x.dirDescendants(x.root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subdirectories of partitions have prefixes beginning with
+	// the partition's prefix, so the longest match is returned.
+	var found *memNode
+	for i, node := range nodes {
+		if string(node.layer) == PartitionLayer || !bytes.HasPrefix(key, node.prefix) {
+			continue
+		}
+		if found == nil || len(node.prefix) > len(found.prefix) {
+			found = &nodes[i]
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found.subspace(), nil
+}
+
+func (x *memTransaction) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the root directory cannot be opened")
+	}
+	return x.dirCreateOrOpen(x.abs(path), nil, true)
+}
+
+func (x *memTransaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the root directory cannot be opened")
+	}
+	return x.dirCreateOrOpen(x.abs(path), layer, false)
+}
+
+func (x *memTransaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	end := len(oldPath)
+	if end > len(newPath) {
+		end = len(newPath)
+	}
+	if pathsEqual(oldPath, newPath[:end]) {
+		return nil, errors.New("the destination directory cannot be a subdirectory of the source directory")
+	}
+	oldPath, newPath = x.abs(oldPath), x.abs(newPath)
+
+	oldNode, err := x.dirNode(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	if oldNode == nil {
+		return nil, errors.New("the source directory does not exist")
+	}
+
+	oldPartition, err := x.dirPartition(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newPartition, err := x.dirPartition(newPath)
+	if err != nil {
+		return nil, err
+	}
+	if !pathsEqual(oldPartition.pathOrNil(), newPartition.pathOrNil()) {
+		return nil, errors.New("cannot move between partitions")
+	}
+
+	newNode, err := x.dirNode(newPath)
+	if err != nil {
+		return nil, err
+	}
+	if newNode != nil {
+		return nil, errors.New("the destination directory already exists. Remove it first")
+	}
+
+	if len(newPath) > 1 {
+		parent, err := x.dirNode(newPath[:len(newPath)-1])
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, errors.New("the parent of the destination directory does not exist. Create it first")
+		}
+	}
+
+	// Only the paths are changed. The prefixes, along
+	// with the key-values stored under them, stay put.
+	descendants, err := x.dirDescendants(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range append([]memNode{*oldNode}, descendants...) {
+		x.Clear(memNodes.Pack(pathTuple(node.path)))
+		node.path = append(append([]string(nil), newPath...), node.path[len(oldPath):]...)
+		x.Set(memNodes.Pack(pathTuple(node.path)), tuple.Tuple{node.prefix, node.layer}.Pack())
+	}
+
+	oldNode.path = newPath
+	return oldNode.subspace(), nil
+}
+
+func (x *memTransaction) dirCreateOrOpen(path []string, layer []byte, allowOpen bool) (directory.DirectorySubspace, error) {
+	node, err := x.dirNode(path)
+	if err != nil {
+		return nil, err
+	}
+	if node != nil {
+		if !allowOpen {
+			return nil, directory.ErrDirAlreadyExists
+		}
+		if layer != nil && string(layer) != string(node.layer) {
+			return nil, errors.New("the directory was created with an incompatible layer")
+		}
+		return node.subspace(), nil
+	}
+
+	// Like the FDB directory layer, missing
+	// parent directories are created.
+	if len(path) > 1 {
+		if _, err := x.dirCreateOrOpen(path[:len(path)-1], nil, true); err != nil {
+			return nil, err
+		}
+	}
+
+	// Subdirectories of a partition have their
+	// prefixes allocated within the partition.
+	partition, err := x.dirPartition(path)
+	if err != nil {
+		return nil, err
+	}
+	var base []byte
+	if partition != nil {
+		base = partition.prefix
+	}
+
+	prefix, err := x.dirAllocate(base)
+	if err != nil {
+		return nil, err
+	}
+
+	node = &memNode{path: path, prefix: prefix, layer: layer}
+	x.Set(memNodes.Pack(pathTuple(path)), tuple.Tuple{prefix, layer}.Pack())
+	return node.subspace(), nil
+}
+
+// abs prepends the transaction's root to the given path.
+func (x *memTransaction) abs(path []string) []string {
+	return append(append([]string(nil), x.root...), path...)
+}
+
+// dirAllocate returns a new prefix which begins with the given base. The
+// prefix is the base followed by a packed integer. The integer is chosen
+// such that no keys exist under the prefix.
+func (x *memTransaction) dirAllocate(base []byte) ([]byte, error) {
+	var n int64
+	if packed := x.Get(memAlloc).MustGet(); packed != nil {
+		tup, err := tuple.Unpack(packed)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unpack prefix allocator")
+		}
+		n = tup[0].(int64)
+	}
+
+	for {
+		n++
+		prefix := append(append([]byte(nil), base...), tuple.Tuple{n}.Pack()...)
+
+		rng, err := fdb.PrefixRange(prefix)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create prefix range")
+		}
+		kvs, err := x.GetRange(rng, fdb.RangeOptions{Limit: 1}).GetSliceWithError()
+		if err != nil {
+			return nil, err
+		}
+		if len(kvs) == 0 {
+			x.Set(memAlloc, tuple.Tuple{n}.Pack())
+			return prefix, nil
+		}
+	}
+}
+
+// dirNode returns the directory at the given path or
+// nil if the directory doesn't exist.
+func (x *memTransaction) dirNode(path []string) (*memNode, error) {
+	packed := x.Get(memNodes.Pack(pathTuple(path))).MustGet()
+	if packed == nil {
+		return nil, nil
+	}
+	return unpackNode(path, packed)
+}
+
+// dirDescendants returns the directories beneath the given path.
+func (x *memTransaction) dirDescendants(path []string) ([]memNode, error) {
+	kvs, err := x.GetRange(memNodes.Sub(pathTuple(path)...), fdb.RangeOptions{}).GetSliceWithError()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []memNode
+	for _, kv := range kvs {
+		tup, err := memNodes.Unpack(kv.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unpack directory path")
+		}
+		path := make([]string, len(tup))
+		for i, element := range tup {
+			path[i] = element.(string)
+		}
+		node, err := unpackNode(path, kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, nil
+}
+
+// dirPartition returns the nearest partition containing the given
+// path, excluding the path itself, or nil if the path isn't within
+// a partition.
+func (x *memTransaction) dirPartition(path []string) (*memNode, error) {
+	for i := len(path) - 1; i > 0; i-- {
+		node, err := x.dirNode(path[:i])
+		if err != nil {
+			return nil, err
+		}
+		if node != nil && string(node.layer) == PartitionLayer {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+func unpackNode(path []string, packed []byte) (*memNode, error) {
+	tup, err := tuple.Unpack(packed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack directory")
+	}
+	node := memNode{path: path, prefix: tup[0].([]byte)}
+	if tup[1] != nil {
+		node.layer = tup[1].([]byte)
+	}
+	return &node, nil
+}
+
+func (x *memNode) pathOrNil() []string {
+	if x == nil {
+		return nil
+	}
+	return x.path
+}
+
+func (x *memNode) subspace() directory.DirectorySubspace {
+	dir := memDirectorySubspace{
+		Subspace: subspace.FromBytes(x.prefix),
+		path:     append([]string(nil), x.path...),
+		layer:    x.layer,
+	}
+	if string(x.layer) == PartitionLayer {
+		return &memPartitionSubspace{dir}
+	}
+	return &dir
+}
+
+func pathTuple(path []string) tuple.Tuple {
+	tup := make(tuple.Tuple, len(path))
+	for i, name := range path {
+		tup[i] = name
+	}
+	return tup
+}
+
+func pathsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (x *memDirectorySubspace) CreateOrOpen(_ fdb.Transactor, _ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) Open(_ fdb.ReadTransactor, _ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) Create(_ fdb.Transactor, _ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) CreatePrefix(_ fdb.Transactor, _ []string, _ []byte, _ []byte) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) Move(_ fdb.Transactor, _ []string, _ []string) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) MoveTo(_ fdb.Transactor, _ []string) (directory.DirectorySubspace, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) Remove(_ fdb.Transactor, _ []string) (bool, error) {
+	return false, errMemDir
+}
+
+func (x *memDirectorySubspace) Exists(_ fdb.ReadTransactor, _ []string) (bool, error) {
+	return false, errMemDir
+}
+
+func (x *memDirectorySubspace) List(_ fdb.ReadTransactor, _ []string) ([]string, error) {
+	return nil, errMemDir
+}
+
+func (x *memDirectorySubspace) GetLayer() []byte {
+	return x.layer
+}
+
+func (x *memDirectorySubspace) GetPath() []string {
+	return x.path
+}
+
+func (x *memPartitionSubspace) Sub(_ ...tuple.TupleElement) subspace.Subspace {
+	panic("cannot open subspace in the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) Bytes() []byte {
+	panic("cannot get key for the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) Pack(_ tuple.Tuple) fdb.Key {
+	panic("cannot pack keys using the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) Unpack(_ fdb.KeyConvertible) (tuple.Tuple, error) {
+	panic("cannot unpack keys using the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) Contains(_ fdb.KeyConvertible) bool {
+	panic("cannot check whether a key belongs to the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) FDBKey() fdb.Key {
+	panic("cannot get key for the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) FDBRangeKeys() (fdb.KeyConvertible, fdb.KeyConvertible) {
+	panic("cannot get range for the root of a directory partition")
+}
+
+func (x *memPartitionSubspace) FDBRangeKeySelectors() (fdb.Selectable, fdb.Selectable) {
+	panic("cannot get range for the root of a directory partition")
+}
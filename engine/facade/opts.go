@@ -0,0 +1,188 @@
+package facade
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/pkg/errors"
+)
+
+// Priority specifies the priority of a transaction.
+type Priority int
+
+const (
+	// PriorityDefault leaves the transaction's
+	// priority as the FDB default.
+	PriorityDefault Priority = iota
+
+	// PriorityBatch specifies that the transaction should
+	// be treated as low priority. Batch transactions are
+	// throttled before default priority transactions.
+	PriorityBatch
+
+	// PrioritySystemImmediate specifies that the transaction
+	// should be treated as the highest priority. This should
+	// only be used for transactions which must not be
+	// throttled, like those performed by admin tools.
+	PrioritySystemImmediate
+)
+
+// NoRetries can be assigned to TxOpts.RetryLimit to
+// disable retrying transactions.
+const NoRetries = -1
+
+// TxOpts configures the transactions created by a Transactor or
+// ReadTransactor. The zero value leaves every option as the FDB
+// default.
+type TxOpts struct {
+	// Timeout cancels the transaction after the
+	// given duration. Zero disables the timeout.
+	Timeout time.Duration
+
+	// RetryLimit is the maximum number of times a
+	// transaction is retried. Zero leaves the limit
+	// as the FDB default (unlimited). NoRetries
+	// disables retrying.
+	RetryLimit int
+
+	// MaxRetryDelay caps the backoff delay between
+	// retries. Zero leaves the delay as the FDB
+	// default.
+	MaxRetryDelay time.Duration
+
+	// Priority sets the priority of the transaction.
+	Priority Priority
+}
+
+// validate returns an error if the options have invalid values.
+func (x *TxOpts) validate() error {
+	if x.RetryLimit < NoRetries {
+		return errors.Errorf("invalid retry limit %d", x.RetryLimit)
+	}
+	switch x.Priority {
+	case PriorityDefault, PriorityBatch, PrioritySystemImmediate:
+		return nil
+	default:
+		return errors.Errorf("unknown priority %d", x.Priority)
+	}
+}
+
+// apply sets the options on the given transaction. FDB allows
+// options to be set each time a transaction is retried, so this
+// is called at the start of every transactional function.
+func (x *TxOpts) apply(tr fdb.Transaction) error {
+	if err := x.validate(); err != nil {
+		return err
+	}
+	opts := tr.Options()
+
+	if x.Timeout != 0 {
+		if err := opts.SetTimeout(x.Timeout.Milliseconds()); err != nil {
+			return errors.Wrap(err, "failed to set timeout")
+		}
+	}
+
+	switch {
+	case x.RetryLimit == NoRetries:
+		if err := opts.SetRetryLimit(0); err != nil {
+			return errors.Wrap(err, "failed to set retry limit")
+		}
+	case x.RetryLimit > 0:
+		if err := opts.SetRetryLimit(int64(x.RetryLimit)); err != nil {
+			return errors.Wrap(err, "failed to set retry limit")
+		}
+	}
+
+	if x.MaxRetryDelay != 0 {
+		if err := opts.SetMaxRetryDelay(x.MaxRetryDelay.Milliseconds()); err != nil {
+			return errors.Wrap(err, "failed to set max retry delay")
+		}
+	}
+
+	switch x.Priority {
+	case PriorityBatch:
+		if err := opts.SetPriorityBatch(); err != nil {
+			return errors.Wrap(err, "failed to set batch priority")
+		}
+	case PrioritySystemImmediate:
+		if err := opts.SetPrioritySystemImmediate(); err != nil {
+			return errors.Wrap(err, "failed to set system immediate priority")
+		}
+	}
+
+	return nil
+}
+
+// Set changes the option with the given name to the given value. The
+// names match the CLI flags: "timeout", "retry-limit", "max-retry-delay",
+// & "priority". Durations are parsed by time.ParseDuration & priorities
+// by ParsePriority. This allows the options to be changed per query.
+func (x *TxOpts) Set(name, value string) error {
+	switch name {
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Wrap(err, "invalid timeout")
+		}
+		x.Timeout = d
+
+	case "retry-limit":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Wrap(err, "invalid retry limit")
+		}
+		if n < NoRetries {
+			return errors.Errorf("invalid retry limit %d", n)
+		}
+		x.RetryLimit = n
+
+	case "max-retry-delay":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Wrap(err, "invalid max retry delay")
+		}
+		x.MaxRetryDelay = d
+
+	case "priority":
+		priority, err := ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		x.Priority = priority
+
+	default:
+		return errors.Errorf("unknown transaction option '%s'", name)
+	}
+	return nil
+}
+
+// String formats the options using the names accepted by Set.
+func (x TxOpts) String() string {
+	priority := "default"
+	switch x.Priority {
+	case PriorityBatch:
+		priority = "batch"
+	case PrioritySystemImmediate:
+		priority = "immediate"
+	}
+	return fmt.Sprintf("timeout=%v retry-limit=%d max-retry-delay=%v priority=%s",
+		x.Timeout, x.RetryLimit, x.MaxRetryDelay, priority)
+}
+
+// ParsePriority converts the given string into a Priority. The
+// strings "default", "batch", & "immediate" are accepted. An empty
+// string is equivalent to "default".
+func ParsePriority(str string) (Priority, error) {
+	switch str {
+	case "", "default":
+		return PriorityDefault, nil
+	case "batch":
+		return PriorityBatch, nil
+	case "immediate":
+		return PrioritySystemImmediate, nil
+	default:
+		return PriorityDefault, errors.Errorf("unknown priority '%s'", str)
+	}
+}
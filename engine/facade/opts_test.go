@@ -0,0 +1,38 @@
+package facade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxOpts_Set(t *testing.T) {
+	var opts TxOpts
+	require.NoError(t, opts.Set("timeout", "2s"))
+	require.NoError(t, opts.Set("retry-limit", "-1"))
+	require.NoError(t, opts.Set("max-retry-delay", "100ms"))
+	require.NoError(t, opts.Set("priority", "batch"))
+	require.Equal(t, TxOpts{
+		Timeout:       2 * time.Second,
+		RetryLimit:    NoRetries,
+		MaxRetryDelay: 100 * time.Millisecond,
+		Priority:      PriorityBatch,
+	}, opts)
+	require.Equal(t, "timeout=2s retry-limit=-1 max-retry-delay=100ms priority=batch", opts.String())
+
+	tests := map[string][2]string{
+		"unknown name":    {"tag", "a"},
+		"invalid timeout": {"timeout", "2"},
+		"invalid limit":   {"retry-limit", "-2"},
+		"invalid delay":   {"max-retry-delay", "a"},
+		"invalid prio":    {"priority", "high"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			before := opts
+			require.Error(t, opts.Set(test[0], test[1]))
+			require.Equal(t, before, opts)
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package facade
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+)
+
+// A recording is a file containing a JSON object on each line. Each
+// object is a recEvent describing a single call to the facade & the
+// call's result. Calls made by a transaction are identified by the
+// ID of the transaction attempt. Calls which weren't made by a
+// transaction, such as starting or returning from a transaction,
+// have a transaction ID of 0. Besides the calls described by Op,
+// a recording contains the following events.
+const (
+	opAttempt    Op = "attempt"
+	opReturn     Op = "return"
+	opWatchReady Op = "watchReady"
+)
+
+type (
+	recEvent struct {
+		Tx     int        `json:"tx,omitempty"`
+		Call   recCall    `json:"call"`
+		Result *recResult `json:"result,omitempty"`
+	}
+
+	// recCall contains the arguments of a call. During replay,
+	// calls are matched with recorded calls by comparing their
+	// recCall. The results of calls are stored in recResult.
+	recCall struct {
+		Op      Op        `json:"op"`
+		Attempt int       `json:"attempt,omitempty"`
+		Watch   int       `json:"watch,omitempty"`
+		Path    []string  `json:"path,omitempty"`
+		NewPath []string  `json:"newPath,omitempty"`
+		Layer   []byte    `json:"layer,omitempty"`
+		Key     []byte    `json:"key,omitempty"`
+		Value   []byte    `json:"value,omitempty"`
+		Range   *recRange `json:"range,omitempty"`
+	}
+
+	recRange struct {
+		Begin   recSelector `json:"begin"`
+		End     recSelector `json:"end"`
+		Limit   int         `json:"limit,omitempty"`
+		Mode    int         `json:"mode,omitempty"`
+		Reverse bool        `json:"reverse,omitempty"`
+	}
+
+	recSelector struct {
+		Key     []byte `json:"key"`
+		OrEqual bool   `json:"orEqual,omitempty"`
+		Offset  int    `json:"offset,omitempty"`
+	}
+
+	recResult struct {
+		Err      string   `json:"err,omitempty"`
+		Sentinel string   `json:"sentinel,omitempty"`
+		Code     int      `json:"code,omitempty"`
+		Dir      *recDir  `json:"dir,omitempty"`
+		Names    []string `json:"names,omitempty"`
+		Found    bool     `json:"found,omitempty"`
+		Value    []byte   `json:"value,omitempty"`
+		KVs      []recKV  `json:"kvs,omitempty"`
+		Partial  bool     `json:"partial,omitempty"`
+		Watch    int      `json:"watch,omitempty"`
+	}
+
+	recDir struct {
+		Path   []string `json:"path"`
+		Prefix []byte   `json:"prefix,omitempty"`
+		Layer  []byte   `json:"layer,omitempty"`
+	}
+
+	recKV struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	}
+
+	// recLog writes events to the recording.
+	recLog struct {
+		mu        sync.Mutex
+		enc       *json.Encoder
+		err       error
+		lastTx    int
+		lastWatch int
+	}
+
+	recorder struct {
+		tr  Transactor
+		log *recLog
+	}
+
+	// recTransaction records the calls made to a transaction.
+	// If the transaction is read-only, tr is nil.
+	recTransaction struct {
+		rtr ReadTransaction
+		tr  Transaction
+		log *recLog
+		id  int
+
+		mu    sync.Mutex
+		iters []*recRangeIterator
+	}
+
+	recRangeResult struct {
+		result RangeResult
+		tx     *recTransaction
+		call   recCall
+	}
+
+	recRangeIterator struct {
+		iter RangeIterator
+		tx   *recTransaction
+		call recCall
+
+		mu   sync.Mutex
+		kvs  []recKV
+		done bool
+	}
+
+	recWatch struct {
+		fdb.FutureNil
+		log  *recLog
+		id   int
+		once sync.Once
+	}
+
+	// resolvedFutureByteSlice is an fdb.FutureByteSlice
+	// whose value is known when it's created.
+	resolvedFutureByteSlice struct {
+		value []byte
+		err   error
+	}
+)
+
+var (
+	_ Transactor          = &recorder{}
+	_ Transaction         = &recTransaction{}
+	_ RangeResult         = &recRangeResult{}
+	_ RangeIterator       = &recRangeIterator{}
+	_ fdb.FutureNil       = &recWatch{}
+	_ fdb.FutureByteSlice = &resolvedFutureByteSlice{}
+)
+
+// recSentinels are the errors which are recognized when recorded
+// so errors.Is can identify them when they're replayed.
+var recSentinels = map[string]error{
+	"dirNotExists":          directory.ErrDirNotExists,
+	"dirAlreadyExists":      directory.ErrDirAlreadyExists,
+	"parentDirDoesNotExist": directory.ErrParentDirDoesNotExist,
+	"notCommitted":          ErrNotCommitted,
+	"timedOut":              ErrTimedOut,
+	"cancelled":             ErrCancelled,
+	"diverged":              ErrDiverged,
+}
+
+// NewRecorder returns a Transactor which records the calls made to the given
+// Transactor, along with their results, by writing them to the given
+// io.Writer. The recording can be served back by the Transactor returned
+// from NewReplayer. Calls made by transactions, like Get & GetRange, are
+// recorded once their results are known. Transactions retried by the given
+// Transactor are recorded as separate attempts.
+//
+// Transactions may make calls concurrently, but calls which don't belong
+// to a transaction must be made sequentially so they're replayed in the
+// same order. If the recording fails to be written, the error is returned
+// by the next call which returns an error.
+func NewRecorder(tr Transactor, w io.Writer) Transactor {
+	return &recorder{tr: tr, log: &recLog{enc: json.NewEncoder(w)}}
+}
+
+func (x *recorder) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	x.log.write(recEvent{Call: recCall{Op: OpReadTransact}})
+	out, err := x.tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		rtx := x.log.begin(tr, nil)
+		defer rtx.end()
+		return f(rtx)
+	})
+	x.log.write(recEvent{Call: recCall{Op: opReturn}, Result: newRecResult(err)})
+	return out, x.log.check(err)
+}
+
+func (x *recorder) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	x.log.write(recEvent{Call: recCall{Op: OpTransact}})
+	out, err := x.tr.Transact(func(tr Transaction) (interface{}, error) {
+		rtx := x.log.begin(tr, tr)
+		defer rtx.end()
+		return f(rtx)
+	})
+	x.log.write(recEvent{Call: recCall{Op: opReturn}, Result: newRecResult(err)})
+	return out, x.log.check(err)
+}
+
+func (x *recorder) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirOpen(path)
+	return dir, x.log.check(x.log.writeDir(0, recCall{Op: OpDirOpen, Path: path}, dir, err))
+}
+
+func (x *recorder) DirList(path []string) ([]string, error) {
+	names, err := x.tr.DirList(path)
+	res := newRecResult(err)
+	res.Names = names
+	x.log.write(recEvent{Call: recCall{Op: OpDirList, Path: path}, Result: res})
+	return names, x.log.check(err)
+}
+
+func (x *recorder) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirCreateOrOpen(path)
+	return dir, x.log.check(x.log.writeDir(0, recCall{Op: OpDirCreateOrOpen, Path: path}, dir, err))
+}
+
+func (x *recorder) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirCreate(path, layer)
+	return dir, x.log.check(x.log.writeDir(0, recCall{Op: OpDirCreate, Path: path, Layer: layer}, dir, err))
+}
+
+func (x *recorder) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirMove(oldPath, newPath)
+	return dir, x.log.check(x.log.writeDir(0, recCall{Op: OpDirMove, Path: oldPath, NewPath: newPath}, dir, err))
+}
+
+func (x *recorder) WithTxOpts(opts TxOpts) Transactor {
+	return &recorder{tr: x.tr.WithTxOpts(opts), log: x.log}
+}
+
+func (x *recTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.rtr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		return f(x.with(tr, nil))
+	})
+}
+
+func (x *recTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.Transact(func(tr Transaction) (interface{}, error) {
+		return f(x.with(tr, tr))
+	})
+}
+
+func (x *recTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.rtr.DirOpen(path)
+	return dir, x.log.writeDir(x.id, recCall{Op: OpDirOpen, Path: path}, dir, err)
+}
+
+func (x *recTransaction) DirList(path []string) ([]string, error) {
+	names, err := x.rtr.DirList(path)
+	res := newRecResult(err)
+	res.Names = names
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpDirList, Path: path}, Result: res})
+	return names, err
+}
+
+func (x *recTransaction) DirFind(key []byte) (directory.DirectorySubspace, error) {
+	dir, err := x.rtr.DirFind(key)
+	return dir, x.log.writeDir(x.id, recCall{Op: OpDirFind, Key: key}, dir, err)
+}
+
+func (x *recTransaction) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirCreateOrOpen(path)
+	return dir, x.log.writeDir(x.id, recCall{Op: OpDirCreateOrOpen, Path: path}, dir, err)
+}
+
+func (x *recTransaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirCreate(path, layer)
+	return dir, x.log.writeDir(x.id, recCall{Op: OpDirCreate, Path: path, Layer: layer}, dir, err)
+}
+
+func (x *recTransaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirMove(oldPath, newPath)
+	return dir, x.log.writeDir(x.id, recCall{Op: OpDirMove, Path: oldPath, NewPath: newPath}, dir, err)
+}
+
+// WithTxOpts applies the options to the underlying transaction. The
+// options themselves aren't recorded, only their effect on the calls.
+func (x *recTransaction) WithTxOpts(opts TxOpts) Transactor {
+	tr := x.tr.WithTxOpts(opts).(Transaction)
+	return x.with(tr, tr)
+}
+
+// Get resolves the value immediately so the value
+// can be recorded before the transaction ends.
+func (x *recTransaction) Get(key fdb.KeyConvertible) fdb.FutureByteSlice {
+	value, err := x.rtr.Get(key).Get()
+	res := newRecResult(err)
+	res.Found = value != nil
+	res.Value = value
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpGet, Key: key.FDBKey()}, Result: res})
+	return &resolvedFutureByteSlice{value: value, err: err}
+}
+
+func (x *recTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) RangeResult {
+	return &recRangeResult{
+		result: x.rtr.GetRange(rng, options),
+		tx:     x,
+		call:   recCall{Op: OpGetRange, Range: newRecRange(rng, options)},
+	}
+}
+
+func (x *recTransaction) Set(key fdb.KeyConvertible, value []byte) {
+	x.tr.Set(key, value)
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpSet, Key: key.FDBKey(), Value: value}})
+}
+
+func (x *recTransaction) SetWithVStampKey(key fdb.KeyConvertible, value []byte) {
+	x.tr.SetWithVStampKey(key, value)
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpSetVStampKey, Key: key.FDBKey(), Value: value}})
+}
+
+func (x *recTransaction) SetWithVStampValue(key fdb.KeyConvertible, value []byte) {
+	x.tr.SetWithVStampValue(key, value)
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpSetVStampValue, Key: key.FDBKey(), Value: value}})
+}
+
+func (x *recTransaction) Clear(key fdb.KeyConvertible) {
+	x.tr.Clear(key)
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpClear, Key: key.FDBKey()}})
+}
+
+// Watch records the creation of the watch. Once the watch becomes
+// ready, its result is recorded separately because the watch
+// outlives the transaction.
+func (x *recTransaction) Watch(key fdb.KeyConvertible) fdb.FutureNil {
+	watch := &recWatch{FutureNil: x.tr.Watch(key), log: x.log, id: x.log.nextWatch()}
+	x.log.write(recEvent{Tx: x.id, Call: recCall{Op: OpWatch, Key: key.FDBKey()}, Result: &recResult{Watch: watch.id}})
+	return watch
+}
+
+// with returns a recTransaction for the given transaction
+// which records its calls as part of this transaction.
+func (x *recTransaction) with(rtr ReadTransaction, tr Transaction) *recTransaction {
+	return &recTransaction{rtr: rtr, tr: tr, log: x.log, id: x.id}
+}
+
+// end records the range-reads which weren't read to completion.
+func (x *recTransaction) end() {
+	x.mu.Lock()
+	iters := x.iters
+	x.mu.Unlock()
+
+	for _, iter := range iters {
+		iter.finish(nil, true)
+	}
+}
+
+func (x *recRangeResult) GetSliceWithError() ([]fdb.KeyValue, error) {
+	kvs, err := x.result.GetSliceWithError()
+	res := newRecResult(err)
+	res.KVs = newRecKVs(kvs)
+	x.tx.log.write(recEvent{Tx: x.tx.id, Call: x.call, Result: res})
+	return kvs, err
+}
+
+func (x *recRangeResult) Iterator() RangeIterator {
+	iter := &recRangeIterator{iter: x.result.Iterator(), tx: x.tx, call: x.call}
+	x.tx.mu.Lock()
+	defer x.tx.mu.Unlock()
+	x.tx.iters = append(x.tx.iters, iter)
+	return iter
+}
+
+func (x *recRangeIterator) Advance() bool {
+	if !x.iter.Advance() {
+		x.finish(nil, false)
+		return false
+	}
+	return true
+}
+
+func (x *recRangeIterator) Get() (fdb.KeyValue, error) {
+	kv, err := x.iter.Get()
+	if err != nil {
+		x.finish(err, false)
+		return kv, err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.kvs = append(x.kvs, recKV{Key: kv.Key, Value: kv.Value})
+	return kv, nil
+}
+
+// finish records the key-values read by the iterator. If partial is
+// true, the iterator was abandoned before reading the entire range.
+// Only the first call to finish records anything.
+func (x *recRangeIterator) finish(err error, partial bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.done {
+		return
+	}
+	x.done = true
+
+	res := newRecResult(err)
+	res.KVs = x.kvs
+	res.Partial = partial
+	x.tx.log.write(recEvent{Tx: x.tx.id, Call: x.call, Result: res})
+}
+
+func (x *recWatch) Get() error {
+	err := x.FutureNil.Get()
+	x.record(err)
+	return err
+}
+
+func (x *recWatch) MustGet() {
+	if err := x.Get(); err != nil {
+		panic(err)
+	}
+}
+
+func (x *recWatch) BlockUntilReady() {
+	x.FutureNil.BlockUntilReady()
+	x.record(x.FutureNil.Get())
+}
+
+func (x *recWatch) record(err error) {
+	x.once.Do(func() {
+		x.log.write(recEvent{Call: recCall{Op: opWatchReady, Watch: x.id}, Result: newRecResult(err)})
+	})
+}
+
+func (x *resolvedFutureByteSlice) Get() ([]byte, error) {
+	return x.value, x.err
+}
+
+func (x *resolvedFutureByteSlice) MustGet() []byte {
+	if x.err != nil {
+		panic(x.err)
+	}
+	return x.value
+}
+
+func (x *resolvedFutureByteSlice) BlockUntilReady() {}
+
+func (x *resolvedFutureByteSlice) IsReady() bool {
+	return true
+}
+
+func (x *resolvedFutureByteSlice) Cancel() {}
+
+// begin records the start of a transaction attempt and returns
+// a recTransaction which records the calls of the attempt.
+func (x *recLog) begin(rtr ReadTransaction, tr Transaction) *recTransaction {
+	x.mu.Lock()
+	x.lastTx++
+	id := x.lastTx
+	x.mu.Unlock()
+
+	x.write(recEvent{Call: recCall{Op: opAttempt, Attempt: id}})
+	return &recTransaction{rtr: rtr, tr: tr, log: x, id: id}
+}
+
+func (x *recLog) nextWatch() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.lastWatch++
+	return x.lastWatch
+}
+
+func (x *recLog) write(ev recEvent) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.err != nil {
+		return
+	}
+	if err := x.enc.Encode(ev); err != nil {
+		x.err = errors.Wrap(err, "failed to write recording")
+	}
+}
+
+// writeDir records a call which returns a directory, which
+// may be nil. The given error is returned for convenience.
+func (x *recLog) writeDir(tx int, call recCall, dir directory.DirectorySubspace, err error) error {
+	res := newRecResult(err)
+	if err == nil && dir != nil {
+		res.Dir = &recDir{Path: dir.GetPath(), Prefix: DirPrefix(dir), Layer: dir.GetLayer()}
+	}
+	x.write(recEvent{Tx: tx, Call: call, Result: res})
+	return err
+}
+
+// check returns the given error or, if it's nil,
+// the error which occurred while writing.
+func (x *recLog) check(err error) error {
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.err
+}
+
+func newRecResult(err error) *recResult {
+	var res recResult
+	if err == nil {
+		return &res
+	}
+
+	res.Err = err.Error()
+	for name, sentinel := range recSentinels {
+		if errors.Is(err, sentinel) {
+			res.Sentinel = name
+			break
+		}
+	}
+
+	var fdbErr fdb.Error
+	if errors.As(err, &fdbErr) {
+		res.Code = fdbErr.Code
+	}
+	return &res
+}
+
+func newRecRange(rng fdb.Range, options fdb.RangeOptions) *recRange {
+	begin, end := rng.FDBRangeKeySelectors()
+	return &recRange{
+		Begin:   newRecSelector(begin.FDBKeySelector()),
+		End:     newRecSelector(end.FDBKeySelector()),
+		Limit:   options.Limit,
+		Mode:    int(options.Mode),
+		Reverse: options.Reverse,
+	}
+}
+
+func newRecSelector(sel fdb.KeySelector) recSelector {
+	return recSelector{Key: sel.Key.FDBKey(), OrEqual: sel.OrEqual, Offset: sel.Offset}
+}
+
+func newRecKVs(kvs []fdb.KeyValue) []recKV {
+	var out []recKV
+	for _, kv := range kvs {
+		out = append(out, recKV{Key: kv.Key, Value: kv.Value})
+	}
+	return out
+}
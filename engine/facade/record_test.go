@@ -0,0 +1,123 @@
+package facade
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	// session performs the same calls whether recording or replaying.
+	// The returned values are compared between the two.
+	session := func(t *testing.T, tr Transactor) []interface{} {
+		var out []interface{}
+
+		dir, err := tr.DirCreateOrOpen([]string{"dir"})
+		require.NoError(t, err)
+		out = append(out, dir.GetPath(), dir.Bytes())
+
+		_, err = tr.DirOpen([]string{"missing"})
+		require.ErrorIs(t, err, directory.ErrDirNotExists)
+
+		_, err = tr.Transact(func(tr Transaction) (interface{}, error) {
+			tr.Set(dir.Pack(tuple.Tuple{"a"}), []byte("1"))
+			tr.Set(dir.Pack(tuple.Tuple{"b"}), []byte("2"))
+			tr.Set(dir.Pack(tuple.Tuple{"c"}), []byte{})
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		value, err := tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+			// Only read the first key-value of the range.
+			iter := tr.GetRange(dir, fdb.RangeOptions{}).Iterator()
+			require.True(t, iter.Advance())
+			kv, err := iter.Get()
+			require.NoError(t, err)
+
+			kvs, err := tr.GetRange(dir, fdb.RangeOptions{Reverse: true}).GetSliceWithError()
+			require.NoError(t, err)
+
+			found, err := tr.DirFind(kv.Key)
+			require.NoError(t, err)
+			missing, err := tr.DirFind([]byte{0x01})
+			require.NoError(t, err)
+			require.Nil(t, missing)
+
+			return []interface{}{kv, kvs, tr.Get(dir.Pack(tuple.Tuple{"c"})).MustGet(), found.GetPath()}, nil
+		})
+		require.NoError(t, err)
+		out = append(out, value)
+
+		watch, err := tr.Transact(func(tr Transaction) (interface{}, error) {
+			return tr.Watch(dir.Pack(tuple.Tuple{"a"})), nil
+		})
+		require.NoError(t, err)
+
+		_, err = tr.Transact(func(tr Transaction) (interface{}, error) {
+			tr.Clear(dir.Pack(tuple.Tuple{"a"}))
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, watch.(fdb.FutureNil).Get())
+		return out
+	}
+
+	var recording bytes.Buffer
+	expected := session(t, NewRecorder(NewMemTransactor(nil), &recording))
+
+	t.Run("replay", func(t *testing.T) {
+		replayer, err := NewReplayer(bytes.NewReader(recording.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, expected, session(t, replayer))
+	})
+
+	t.Run("divergent call", func(t *testing.T) {
+		replayer, err := NewReplayer(bytes.NewReader(recording.Bytes()))
+		require.NoError(t, err)
+
+		_, err = replayer.DirCreateOrOpen([]string{"other"})
+		require.ErrorIs(t, err, ErrDiverged)
+	})
+
+	t.Run("divergent write", func(t *testing.T) {
+		replayer, err := NewReplayer(bytes.NewReader(recording.Bytes()))
+		require.NoError(t, err)
+
+		dir, err := replayer.DirCreateOrOpen([]string{"dir"})
+		require.NoError(t, err)
+		_, err = replayer.DirOpen([]string{"missing"})
+		require.Error(t, err)
+
+		_, err = replayer.Transact(func(tr Transaction) (interface{}, error) {
+			tr.Set(dir.Pack(tuple.Tuple{"a"}), []byte("other"))
+			return nil, nil
+		})
+		require.ErrorIs(t, err, ErrDiverged)
+	})
+
+	t.Run("read past partial range", func(t *testing.T) {
+		replayer, err := NewReplayer(bytes.NewReader(recording.Bytes()))
+		require.NoError(t, err)
+
+		dir, err := replayer.DirCreateOrOpen([]string{"dir"})
+		require.NoError(t, err)
+		_, err = replayer.DirOpen([]string{"missing"})
+		require.Error(t, err)
+		_, err = replayer.Transact(func(tr Transaction) (interface{}, error) {
+			tr.Set(dir.Pack(tuple.Tuple{"a"}), []byte("1"))
+			tr.Set(dir.Pack(tuple.Tuple{"b"}), []byte("2"))
+			tr.Set(dir.Pack(tuple.Tuple{"c"}), []byte{})
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		_, err = replayer.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+			return tr.GetRange(dir, fdb.RangeOptions{}).GetSliceWithError()
+		})
+		require.ErrorIs(t, err, ErrDiverged)
+	})
+}
@@ -0,0 +1,569 @@
+package facade
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+)
+
+// ErrDiverged is returned by the Transactor created by NewReplayer
+// when a call doesn't match any call in the recording.
+var ErrDiverged = errors.New("call diverged from recording")
+
+type (
+	replayer struct {
+		mu sync.Mutex
+
+		// calls contains the events which don't belong to
+		// a transaction, in the order they were recorded.
+		calls []recEvent
+
+		// attempts contains the events of each transaction
+		// attempt, keyed by the attempt's ID.
+		attempts map[int][]recEvent
+
+		// watches contains the results of watches,
+		// keyed by the watch's ID.
+		watches map[int]recEvent
+	}
+
+	replayTransaction struct {
+		replayer *replayer
+		pool     *replayPool
+
+		mu  sync.Mutex
+		err error
+	}
+
+	// replayPool contains the events of a transaction attempt. The
+	// calls made by a transaction may be concurrent, so they're
+	// matched with any unused event rather than the next event.
+	replayPool struct {
+		mu     sync.Mutex
+		events []recEvent
+		used   []bool
+	}
+
+	replayRangeResult struct {
+		tx   *replayTransaction
+		call recCall
+	}
+
+	replayRangeIterator struct {
+		tx   *replayTransaction
+		call recCall
+
+		init bool
+		res  recResult
+		err  error
+		i    int
+	}
+
+	replayWatch struct {
+		res *recResult
+	}
+
+	// replayedError is a recorded error. The error's cause is one
+	// of recSentinels or an fdb.Error, if either was recorded, so
+	// the error can be identified via errors.Is & errors.As.
+	replayedError struct {
+		msg   string
+		cause error
+	}
+)
+
+var (
+	_ Transactor    = &replayer{}
+	_ Transaction   = &replayTransaction{}
+	_ RangeResult   = &replayRangeResult{}
+	_ RangeIterator = &replayRangeIterator{}
+	_ fdb.FutureNil = &replayWatch{}
+)
+
+// NewReplayer returns a Transactor which serves the calls recorded by the
+// Transactor returned from NewRecorder. The recording is read from the
+// given io.Reader. No DB is accessed.
+//
+// Calls which don't belong to a transaction must be made in the order they
+// were recorded. Calls made by a transaction may be made in any order. If a
+// call doesn't match the recording, an error wrapping ErrDiverged is returned.
+// Calls which cannot return an error, like Set, cause the transaction to
+// fail instead. A transaction also fails if it succeeds without making every
+// recorded call. Transaction options have no effect, as their effects are
+// part of the recording.
+func NewReplayer(r io.Reader) (Transactor, error) {
+	x := replayer{
+		attempts: make(map[int][]recEvent),
+		watches:  make(map[int]recEvent),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		var ev recEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d of recording", line)
+		}
+
+		switch {
+		case ev.Tx != 0:
+			x.attempts[ev.Tx] = append(x.attempts[ev.Tx], ev)
+		case ev.Call.Op == opWatchReady:
+			x.watches[ev.Call.Watch] = ev
+		default:
+			x.calls = append(x.calls, ev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read recording")
+	}
+	return &x, nil
+}
+
+func (x *replayer) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.transact(recCall{Op: OpReadTransact}, func(tr *replayTransaction) (interface{}, error) {
+		return f(tr)
+	})
+}
+
+func (x *replayer) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return x.transact(recCall{Op: OpTransact}, func(tr *replayTransaction) (interface{}, error) {
+		return f(tr)
+	})
+}
+
+// transact replays each recorded attempt of the transaction. Like FDB, the
+// given function is called once for each attempt. The result of the final
+// attempt is returned, unless the transaction failed when it was recorded.
+func (x *replayer) transact(call recCall, f func(*replayTransaction) (interface{}, error)) (interface{}, error) {
+	if _, err := x.next(call); err != nil {
+		return nil, err
+	}
+
+	var (
+		out interface{}
+		err error
+	)
+	for {
+		attempt, ok := x.nextAttempt()
+		if !ok {
+			break
+		}
+		tr := &replayTransaction{replayer: x, pool: newReplayPool(attempt)}
+		out, err = tr.run(f)
+	}
+
+	ret, retErr := x.next(recCall{Op: opReturn})
+	if retErr != nil {
+		return nil, retErr
+	}
+	if err != nil {
+		if ret.Result == nil || ret.Result.Err == "" {
+			return nil, errors.Wrapf(ErrDiverged, "transaction failed but succeeded when recorded: %v", err)
+		}
+		return nil, err
+	}
+	if ret.Result != nil && ret.Result.Err != "" {
+		return nil, ret.Result.error()
+	}
+	return out, nil
+}
+
+func (x *replayer) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirOpen, Path: path})
+}
+
+func (x *replayer) DirList(path []string) ([]string, error) {
+	ev, err := x.next(recCall{Op: OpDirList, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return ev.Result.Names, ev.Result.error()
+}
+
+func (x *replayer) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirCreateOrOpen, Path: path})
+}
+
+func (x *replayer) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirCreate, Path: path, Layer: layer})
+}
+
+func (x *replayer) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirMove, Path: oldPath, NewPath: newPath})
+}
+
+func (x *replayer) WithTxOpts(_ TxOpts) Transactor {
+	return x
+}
+
+func (x *replayer) dir(call recCall) (directory.DirectorySubspace, error) {
+	ev, err := x.next(call)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Result.dir()
+}
+
+// next removes the next event which doesn't belong to a transaction.
+// If the event doesn't match the given call, an error is returned.
+func (x *replayer) next(call recCall) (recEvent, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(x.calls) == 0 {
+		return recEvent{}, errors.Wrapf(ErrDiverged, "unexpected %s call after the end of the recording", call.Op)
+	}
+	ev := x.calls[0]
+	if !callsEqual(ev.Call, call) {
+		return recEvent{}, errors.Wrapf(ErrDiverged, "expected %s call but got %s call", describeCall(ev.Call), describeCall(call))
+	}
+	x.calls = x.calls[1:]
+	if ev.Result == nil {
+		ev.Result = &recResult{}
+	}
+	return ev, nil
+}
+
+// nextAttempt removes the next event if it's the start of a transaction
+// attempt. The events belonging to the attempt are returned.
+func (x *replayer) nextAttempt() ([]recEvent, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(x.calls) == 0 || x.calls[0].Call.Op != opAttempt {
+		return nil, false
+	}
+	id := x.calls[0].Call.Attempt
+	x.calls = x.calls[1:]
+	return x.attempts[id], true
+}
+
+// run calls the given function with the transaction. Errors panicked by
+// the transaction's futures are recovered & returned, much like FDB
+// recovers panics of fdb.Error.
+func (x *replayTransaction) run(f func(*replayTransaction) (interface{}, error)) (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var replayed *replayedError
+			if e, ok := r.(error); ok && (errors.Is(e, ErrDiverged) || errors.As(e, &replayed)) {
+				out, err = nil, e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	out, err = f(x)
+	if err != nil {
+		return nil, err
+	}
+	if err := x.failure(); err != nil {
+		return nil, err
+	}
+	if n := x.pool.unused(); n > 0 {
+		return nil, errors.Wrapf(ErrDiverged, "transaction didn't make %d recorded calls", n)
+	}
+	return out, nil
+}
+
+func (x *replayTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return f(x)
+}
+
+func (x *replayTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return f(x)
+}
+
+func (x *replayTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirOpen, Path: path})
+}
+
+func (x *replayTransaction) DirList(path []string) ([]string, error) {
+	res, err := x.pool.take(recCall{Op: OpDirList, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return res.Names, res.error()
+}
+
+func (x *replayTransaction) DirFind(key []byte) (directory.DirectorySubspace, error) {
+	res, err := x.pool.take(recCall{Op: OpDirFind, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.error(); err != nil || res.Dir == nil {
+		return nil, err
+	}
+	return res.dir()
+}
+
+func (x *replayTransaction) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirCreateOrOpen, Path: path})
+}
+
+func (x *replayTransaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirCreate, Path: path, Layer: layer})
+}
+
+func (x *replayTransaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.dir(recCall{Op: OpDirMove, Path: oldPath, NewPath: newPath})
+}
+
+func (x *replayTransaction) WithTxOpts(_ TxOpts) Transactor {
+	return x
+}
+
+func (x *replayTransaction) Get(key fdb.KeyConvertible) fdb.FutureByteSlice {
+	res, err := x.pool.take(recCall{Op: OpGet, Key: key.FDBKey()})
+	if err != nil {
+		return &resolvedFutureByteSlice{err: err}
+	}
+
+	value := res.Value
+	if res.Found && value == nil {
+		value = []byte{}
+	}
+	return &resolvedFutureByteSlice{value: value, err: res.error()}
+}
+
+func (x *replayTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) RangeResult {
+	return &replayRangeResult{tx: x, call: recCall{Op: OpGetRange, Range: newRecRange(rng, options)}}
+}
+
+func (x *replayTransaction) Set(key fdb.KeyConvertible, value []byte) {
+	x.write(recCall{Op: OpSet, Key: key.FDBKey(), Value: value})
+}
+
+func (x *replayTransaction) SetWithVStampKey(key fdb.KeyConvertible, value []byte) {
+	x.write(recCall{Op: OpSetVStampKey, Key: key.FDBKey(), Value: value})
+}
+
+func (x *replayTransaction) SetWithVStampValue(key fdb.KeyConvertible, value []byte) {
+	x.write(recCall{Op: OpSetVStampValue, Key: key.FDBKey(), Value: value})
+}
+
+func (x *replayTransaction) Clear(key fdb.KeyConvertible) {
+	x.write(recCall{Op: OpClear, Key: key.FDBKey()})
+}
+
+func (x *replayTransaction) Watch(key fdb.KeyConvertible) fdb.FutureNil {
+	res, err := x.pool.take(recCall{Op: OpWatch, Key: key.FDBKey()})
+	if err != nil {
+		x.fail(err)
+		return &replayWatch{res: &recResult{Err: err.Error(), Sentinel: "diverged"}}
+	}
+
+	x.replayer.mu.Lock()
+	defer x.replayer.mu.Unlock()
+	ready, ok := x.replayer.watches[res.Watch]
+	if !ok {
+		// The watch never became ready while
+		// recording, so it never does here.
+		return &replayWatch{}
+	}
+	return &replayWatch{res: ready.Result}
+}
+
+func (x *replayTransaction) dir(call recCall) (directory.DirectorySubspace, error) {
+	res, err := x.pool.take(call)
+	if err != nil {
+		return nil, err
+	}
+	return res.dir()
+}
+
+// write replays a call which cannot return an error. If the
+// call diverges, the transaction fails once it returns.
+func (x *replayTransaction) write(call recCall) {
+	if _, err := x.pool.take(call); err != nil {
+		x.fail(err)
+	}
+}
+
+func (x *replayTransaction) fail(err error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.err == nil {
+		x.err = err
+	}
+}
+
+func (x *replayTransaction) failure() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.err
+}
+
+func (x *replayRangeResult) GetSliceWithError() ([]fdb.KeyValue, error) {
+	res, err := x.tx.pool.take(x.call)
+	if err != nil {
+		return nil, err
+	}
+	if res.Partial {
+		return nil, errors.Wrap(ErrDiverged, "range was only partially read when recorded")
+	}
+	return res.kvs(), res.error()
+}
+
+func (x *replayRangeResult) Iterator() RangeIterator {
+	return &replayRangeIterator{tx: x.tx, call: x.call}
+}
+
+func (x *replayRangeIterator) Advance() bool {
+	if !x.init {
+		x.init = true
+		res, err := x.tx.pool.take(x.call)
+		if err != nil {
+			x.err = err
+		} else {
+			x.res = *res
+		}
+	}
+	return x.err != nil || x.i < len(x.res.KVs) || x.res.Err != "" || x.res.Partial
+}
+
+func (x *replayRangeIterator) Get() (fdb.KeyValue, error) {
+	switch {
+	case x.err != nil:
+		return fdb.KeyValue{}, x.err
+	case x.i < len(x.res.KVs):
+		kv := x.res.KVs[x.i]
+		x.i++
+		return fdb.KeyValue{Key: kv.Key, Value: kv.value()}, nil
+	case x.res.Err != "":
+		return fdb.KeyValue{}, x.res.error()
+	default:
+		return fdb.KeyValue{}, errors.Wrap(ErrDiverged, "read past the end of a partially recorded range")
+	}
+}
+
+// Get blocks forever if the watch never became ready while recording.
+func (x *replayWatch) Get() error {
+	x.BlockUntilReady()
+	return x.res.error()
+}
+
+func (x *replayWatch) MustGet() {
+	if err := x.Get(); err != nil {
+		panic(err)
+	}
+}
+
+func (x *replayWatch) BlockUntilReady() {
+	if x.res == nil {
+		select {}
+	}
+}
+
+func (x *replayWatch) IsReady() bool {
+	return x.res != nil
+}
+
+func (x *replayWatch) Cancel() {}
+
+func newReplayPool(events []recEvent) *replayPool {
+	return &replayPool{events: events, used: make([]bool, len(events))}
+}
+
+// take marks the first unused event matching the given
+// call as used and returns the event's result.
+func (x *replayPool) take(call recCall) (*recResult, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for i, ev := range x.events {
+		if x.used[i] || !callsEqual(ev.Call, call) {
+			continue
+		}
+		x.used[i] = true
+		if ev.Result == nil {
+			return &recResult{}, nil
+		}
+		return ev.Result, nil
+	}
+	return nil, errors.Wrapf(ErrDiverged, "unexpected %s call", describeCall(call))
+}
+
+func (x *replayPool) unused() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	n := 0
+	for _, used := range x.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// error returns the recorded error or nil if no error was recorded.
+func (x *recResult) error() error {
+	if x == nil || x.Err == "" {
+		return nil
+	}
+	err := replayedError{msg: x.Err, cause: recSentinels[x.Sentinel]}
+	if err.cause == nil && x.Code != 0 {
+		err.cause = fdb.Error{Code: x.Code}
+	}
+	return &err
+}
+
+func (x *recResult) dir() (directory.DirectorySubspace, error) {
+	if err := x.error(); err != nil {
+		return nil, err
+	}
+	if x.Dir == nil {
+		return nil, errors.Wrap(ErrDiverged, "recording is missing a directory")
+	}
+	node := memNode{path: x.Dir.Path, prefix: x.Dir.Prefix, layer: x.Dir.Layer}
+	return node.subspace(), nil
+}
+
+func (x *recResult) kvs() []fdb.KeyValue {
+	var out []fdb.KeyValue
+	for _, kv := range x.KVs {
+		out = append(out, fdb.KeyValue{Key: kv.Key, Value: kv.value()})
+	}
+	return out
+}
+
+// value returns the key-value's value. JSON doesn't
+// distinguish between nil & empty byte strings, but
+// FDB never returns a nil value.
+func (x *recKV) value() []byte {
+	if x.Value == nil {
+		return []byte{}
+	}
+	return x.Value
+}
+
+func (x *replayedError) Error() string {
+	return x.msg
+}
+
+func (x *replayedError) Unwrap() error {
+	return x.cause
+}
+
+// callsEqual compares the JSON encodings of the given calls, which
+// treats nil & empty byte strings as equal, like the recording does.
+func callsEqual(a, b recCall) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aJSON) == string(bJSON)
+}
+
+func describeCall(call recCall) string {
+	out, err := json.Marshal(call)
+	if err != nil {
+		return string(call.Op)
+	}
+	return string(out)
+}
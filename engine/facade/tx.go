@@ -74,12 +74,16 @@ func (x *nilReadTransaction) DirList(_ []string) ([]string, error) {
 	return nil, nil
 }
 
+func (x *nilReadTransaction) DirFind(_ []byte) (directory.DirectorySubspace, error) {
+	return nil, nil
+}
+
 func (x *nilReadTransaction) Get(_ fdb.KeyConvertible) fdb.FutureByteSlice {
 	return NewNilFutureByteSlice()
 }
 
-func (x *nilReadTransaction) GetRange(_ fdb.Range, _ fdb.RangeOptions) fdb.RangeResult {
-	return fdb.RangeResult{}
+func (x *nilReadTransaction) GetRange(_ fdb.Range, _ fdb.RangeOptions) RangeResult {
+	return NewNilRangeResult()
 }
 
 func (x *nilTransactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
@@ -90,6 +94,18 @@ func (x *nilTransactor) DirCreateOrOpen(_ []string) (directory.DirectorySubspace
 	return NewNilDirectorySubspace(), nil
 }
 
+func (x *nilTransactor) DirCreate(_ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransactor) DirMove(_ []string, _ []string) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransactor) WithTxOpts(_ TxOpts) Transactor {
+	return x
+}
+
 func (x *nilTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return f(x)
 }
@@ -98,6 +114,18 @@ func (x *nilTransaction) DirCreateOrOpen(_ []string) (directory.DirectorySubspac
 	return NewNilDirectorySubspace(), nil
 }
 
+func (x *nilTransaction) DirCreate(_ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransaction) DirMove(_ []string, _ []string) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransaction) WithTxOpts(_ TxOpts) Transactor {
+	return x
+}
+
 func (x *nilTransaction) Set(_ fdb.KeyConvertible, _ []byte) {}
 
 func (x *nilTransaction) SetWithVStampKey(_ fdb.KeyConvertible, _ []byte) {}
@@ -13,9 +13,30 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func TestEnv(t *testing.T, force bool, f func(facade.Transactor, zerolog.Logger)) {
-	db := fdb.MustOpenDefault()
+// TestEnv calls the given function with a Transactor & Logger for use in
+// tests. If useFDB is false, the Transactor is backed by an in-memory
+// database. Otherwise, the Transactor is backed by the default FDB
+// cluster. Either way, the Transactor is confined to a randomly named
+// directory. When using FDB, the directory is removed once the
+// function returns. If the directory already exists, the test fails
+// unless force is true.
+func TestEnv(t *testing.T, useFDB bool, force bool, f func(facade.Transactor, zerolog.Logger)) {
+	writer := zerolog.ConsoleWriter{Out: os.Stdout}
+	writer.FormatLevel = func(_ interface{}) string { return "" }
+	writer.FormatTimestamp = func(_ interface{}) string { return "" }
+	log := zerolog.New(writer)
+
+	// The API version must be selected even when FDB
+	// isn't used because the tuple layer depends on it.
+	fdb.MustAPIVersion(620)
+
 	rootPath := genRootPath()
+	if !useFDB {
+		f(facade.NewMemTransactor(rootPath), log)
+		return
+	}
+
+	db := fdb.MustOpenDefault()
 
 	exists, err := directory.Exists(db, rootPath)
 	if err != nil {
@@ -41,11 +62,6 @@ func TestEnv(t *testing.T, force bool, f func(facade.Transactor, zerolog.Logger)
 		}
 	}()
 
-	writer := zerolog.ConsoleWriter{Out: os.Stdout}
-	writer.FormatLevel = func(_ interface{}) string { return "" }
-	writer.FormatTimestamp = func(_ interface{}) string { return "" }
-	log := zerolog.New(writer)
-
 	f(facade.NewTransactor(db, dir), log)
 }
 
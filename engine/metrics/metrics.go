@@ -0,0 +1,292 @@
+// Package metrics collects counters & histograms describing the work
+// performed by the engine.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The names of the metrics reported by the engine & stream. The names,
+// labels, & units follow the conventions of Prometheus.
+const (
+	// KeysScanned counts the key-values read from the DB by
+	// range-reads & single-reads, including those which are
+	// later filtered out.
+	KeysScanned = "fql_keys_scanned_total"
+
+	// KeysReturned counts the key-values returned to the
+	// caller after filtering & unpacking.
+	KeysReturned = "fql_keys_returned_total"
+
+	// BytesRead counts the bytes of the keys &
+	// values read from the DB.
+	BytesRead = "fql_bytes_read_total"
+
+	// BytesWritten counts the bytes of the keys &
+	// values written to the DB.
+	BytesWritten = "fql_bytes_written_total"
+
+	// DirectoryOpens counts the directories opened, listed,
+	// or created. It's labeled with the operation.
+	DirectoryOpens = "fql_directory_opens_total"
+
+	// Transactions counts the transactions executed. It's
+	// labeled with the kind of transaction.
+	Transactions = "fql_transactions_total"
+
+	// TransactionRetries counts the number of times a transaction
+	// was retried. It's labeled with the kind of transaction.
+	TransactionRetries = "fql_transaction_retries_total"
+
+	// TransactionSeconds is a histogram of the time taken by
+	// transactions, including retries. It's labeled with the
+	// kind of transaction.
+	TransactionSeconds = "fql_transaction_duration_seconds"
+
+	// StageSeconds is a histogram of the time taken by each
+	// stage of a stream pipeline. It's labeled with the stage.
+	StageSeconds = "fql_stage_duration_seconds"
+)
+
+var help = map[string]string{
+	KeysScanned:        "Key-values read from the DB, including those filtered out.",
+	KeysReturned:       "Key-values returned after filtering & unpacking.",
+	BytesRead:          "Bytes of the keys & values read from the DB.",
+	BytesWritten:       "Bytes of the keys & values written to the DB.",
+	DirectoryOpens:     "Directories opened, listed, or created.",
+	Transactions:       "Transactions executed.",
+	TransactionRetries: "Times a transaction was retried.",
+	TransactionSeconds: "Time taken by transactions, including retries.",
+	StageSeconds:       "Time taken by each stage of a stream pipeline.",
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets used for
+// histograms. They match the default buckets of the Prometheus client.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Label is a name-value pair which distinguishes
+// metrics of the same name.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Collector receives the metrics reported by the engine & stream. It may
+// be implemented to forward metrics to a Prometheus client or another
+// monitoring system. Implementations must be safe for concurrent use.
+type Collector interface {
+	// Add increases the counter with the given name & labels by delta.
+	Add(name string, delta float64, labels ...Label)
+
+	// Observe records the value in the histogram
+	// with the given name & labels.
+	Observe(name string, value float64, labels ...Label)
+}
+
+type nop struct{}
+
+// Nop returns a Collector which discards all metrics.
+func Nop() Collector {
+	return nop{}
+}
+
+func (nop) Add(string, float64, ...Label) {}
+
+func (nop) Observe(string, float64, ...Label) {}
+
+// Since observes the time elapsed since the given
+// start time in the given histogram, in seconds.
+func Since(c Collector, name string, start time.Time, labels ...Label) {
+	c.Observe(name, time.Since(start).Seconds(), labels...)
+}
+
+type (
+	// Registry is a Collector which stores the metrics in memory
+	// so they can be written using the Prometheus text format.
+	Registry struct {
+		mu         sync.Mutex
+		counters   map[string]*counter
+		histograms map[string]*histogram
+	}
+
+	counter struct {
+		name   string
+		labels []Label
+		value  float64
+	}
+
+	histogram struct {
+		name   string
+		labels []Label
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+var _ Collector = &Registry{}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*counter),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (x *Registry) Add(name string, delta float64, labels ...Label) {
+	labels = sortLabels(labels)
+	id := seriesID(name, labels)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	c, ok := x.counters[id]
+	if !ok {
+		c = &counter{name: name, labels: labels}
+		x.counters[id] = c
+	}
+	c.value += delta
+}
+
+func (x *Registry) Observe(name string, value float64, labels ...Label) {
+	labels = sortLabels(labels)
+	id := seriesID(name, labels)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	h, ok := x.histograms[id]
+	if !ok {
+		h = &histogram{name: name, labels: labels, counts: make([]uint64, len(DefaultBuckets))}
+		x.histograms[id] = h
+	}
+	for i, bound := range DefaultBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Counter returns the value of the counter with the given name & labels.
+// If the counter was never increased, zero is returned.
+func (x *Registry) Counter(name string, labels ...Label) float64 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if c, ok := x.counters[seriesID(name, sortLabels(labels))]; ok {
+		return c.value
+	}
+	return 0
+}
+
+// Count returns the number of values observed by the histogram with
+// the given name & labels.
+func (x *Registry) Count(name string, labels ...Label) uint64 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if h, ok := x.histograms[seriesID(name, sortLabels(labels))]; ok {
+		return h.count
+	}
+	return 0
+}
+
+// Write writes the metrics to the given writer using the Prometheus text
+// format. The metrics are sorted by name & then by labels.
+func (x *Registry) Write(w io.Writer) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var b strings.Builder
+
+	counters := make([]*counter, 0, len(x.counters))
+	for _, c := range x.counters {
+		counters = append(counters, c)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return seriesID(counters[i].name, counters[i].labels) < seriesID(counters[j].name, counters[j].labels)
+	})
+
+	histograms := make([]*histogram, 0, len(x.histograms))
+	for _, h := range x.histograms {
+		histograms = append(histograms, h)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		return seriesID(histograms[i].name, histograms[i].labels) < seriesID(histograms[j].name, histograms[j].labels)
+	})
+
+	for i, c := range counters {
+		if i == 0 || counters[i-1].name != c.name {
+			writeHeader(&b, c.name, "counter")
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", c.name, formatLabels(c.labels), formatFloat(c.value))
+	}
+
+	for i, h := range histograms {
+		if i == 0 || histograms[i-1].name != h.name {
+			writeHeader(&b, h.name, "histogram")
+		}
+		for j, bound := range DefaultBuckets {
+			labels := append(append([]Label(nil), h.labels...), Label{Name: "le", Value: formatFloat(bound)})
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, formatLabels(labels), h.counts[j])
+		}
+		labels := append(append([]Label(nil), h.labels...), Label{Name: "le", Value: "+Inf"})
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, formatLabels(labels), h.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", h.name, formatLabels(h.labels), formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", h.name, formatLabels(h.labels), h.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHeader(b *strings.Builder, name string, kind string) {
+	if text, ok := help[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, text)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+func sortLabels(labels []Label) []Label {
+	if len(labels) < 2 {
+		return labels
+	}
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// seriesID uniquely identifies a metric by its name & sorted labels.
+func seriesID(name string, labels []Label) string {
+	return name + formatLabels(labels)
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, l := range labels {
+		parts = append(parts, fmt.Sprintf("%s=%s", l.Name, strconv.Quote(l.Value)))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Add(KeysScanned, 2)
+	r.Add(KeysScanned, 3)
+	r.Add(Transactions, 1, Label{Name: "kind", Value: "write"})
+	r.Add(Transactions, 1, Label{Name: "kind", Value: "read"})
+	r.Observe(StageSeconds, 0.02, Label{Name: "stage", Value: "read range"})
+	r.Observe(StageSeconds, 3, Label{Name: "stage", Value: "read range"})
+
+	require.Equal(t, float64(5), r.Counter(KeysScanned))
+	require.Equal(t, float64(1), r.Counter(Transactions, Label{Name: "kind", Value: "read"}))
+	require.Equal(t, float64(0), r.Counter(KeysReturned))
+	require.Equal(t, uint64(2), r.Count(StageSeconds, Label{Name: "stage", Value: "read range"}))
+
+	var out strings.Builder
+	require.NoError(t, r.Write(&out))
+	require.Equal(t, strings.Join([]string{
+		`# HELP fql_keys_scanned_total Key-values read from the DB, including those filtered out.`,
+		`# TYPE fql_keys_scanned_total counter`,
+		`fql_keys_scanned_total 5`,
+		`# HELP fql_transactions_total Transactions executed.`,
+		`# TYPE fql_transactions_total counter`,
+		`fql_transactions_total{kind="read"} 1`,
+		`fql_transactions_total{kind="write"} 1`,
+		`# HELP fql_stage_duration_seconds Time taken by each stage of a stream pipeline.`,
+		`# TYPE fql_stage_duration_seconds histogram`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.005"} 0`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.01"} 0`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.025"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.05"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.1"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.25"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="0.5"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="1"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="2.5"} 1`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="5"} 2`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="10"} 2`,
+		`fql_stage_duration_seconds_bucket{stage="read range",le="+Inf"} 2`,
+		`fql_stage_duration_seconds_sum{stage="read range"} 3.02`,
+		`fql_stage_duration_seconds_count{stage="read range"} 2`,
+		``,
+	}, "\n"), out.String())
+}
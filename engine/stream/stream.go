@@ -4,17 +4,22 @@ package stream
 import (
 	"context"
 	"encoding/binary"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/janderland/fql/engine/facade"
 	"github.com/janderland/fql/engine/internal"
+	"github.com/janderland/fql/engine/metrics"
+	"github.com/janderland/fql/engine/trace"
 	"github.com/janderland/fql/keyval"
 	"github.com/janderland/fql/keyval/convert"
 	"github.com/janderland/fql/keyval/tuple"
+	"github.com/janderland/fql/parser/format"
 )
 
 type (
@@ -44,8 +49,10 @@ type (
 	// KeyValErr is streamed from a call to [Stream.UnpackKeys] or
 	// [Stream.UnpackValues]. If Err is nil, the other fields should
 	// be non-nil. If Err is non-nil, the other fields should be nil.
+	// Raw is the key-value as it was read from the DB.
 	KeyValErr struct {
 		KV  keyval.KeyValue
+		Raw fdb.KeyValue
 		Err error
 	}
 
@@ -56,9 +63,11 @@ type (
 	// Stream provides methods which build pipelines for reading
 	// a range of key-values.
 	Stream struct {
-		ctx   context.Context
-		log   zerolog.Logger
-		order binary.ByteOrder
+		ctx     context.Context
+		log     zerolog.Logger
+		order   binary.ByteOrder
+		metrics metrics.Collector
+		tracer  trace.Tracer
 	}
 )
 
@@ -66,9 +75,11 @@ type (
 // to cancel any pipelines created with this Stream.
 func New(ctx context.Context, opts ...Option) Stream {
 	s := Stream{
-		ctx:   ctx,
-		log:   zerolog.Nop(),
-		order: binary.BigEndian,
+		ctx:     ctx,
+		log:     zerolog.Nop(),
+		order:   binary.BigEndian,
+		metrics: metrics.Nop(),
+		tracer:  trace.Nop(),
 	}
 	for _, option := range opts {
 		option(&s)
@@ -91,6 +102,25 @@ func ByteOrder(order binary.ByteOrder) Option {
 	}
 }
 
+// Metrics configures the collector which receives the metrics
+// of the pipelines built by a Stream. This includes the keys
+// scanned & returned, the bytes read, the directories opened,
+// and the time taken by each stage.
+func Metrics(c metrics.Collector) Option {
+	return func(s *Stream) {
+		s.metrics = c
+	}
+}
+
+// Tracer configures the tracer which receives a span for each stage of
+// the pipelines built by a Stream. If the Stream's context contains a
+// span, the stages' spans are its children.
+func Tracer(t trace.Tracer) Option {
+	return func(s *Stream) {
+		s.tracer = t
+	}
+}
+
 // SendDir sends the given DirErr onto the given channel and returns
 // true. If the context.Context associated with this Stream is canceled,
 // then nothing is sent and false is returned.
@@ -135,7 +165,9 @@ func (x *Stream) OpenDirectories(tr facade.ReadTransactor, query keyval.Director
 
 	go func() {
 		defer close(out)
-		x.goOpenDirectories(tr, query, out)
+		st := x.startStage("OpenDirectories", "open directories", func(f *format.Format) { f.Directory(query) })
+		defer st.end()
+		x.goOpenDirectories(tr, query, st, out)
 	}()
 
 	return out
@@ -150,7 +182,9 @@ func (x *Stream) ReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts R
 
 	go func() {
 		defer close(out)
-		x.goReadRange(tr, query, opts, in, out)
+		st := x.startStage("ReadRange", "read range", func(f *format.Format) { f.Tuple(query) })
+		defer st.end()
+		x.goReadRange(tr, query, opts, st, in, out)
 	}()
 
 	return out
@@ -165,7 +199,9 @@ func (x *Stream) UnpackKeys(query keyval.Tuple, filter bool, in chan DirKVErr) c
 
 	go func() {
 		defer close(out)
-		x.goUnpackKeys(query, filter, in, out)
+		st := x.startStage("UnpackKeys", "unpack keys", func(f *format.Format) { f.Tuple(query) })
+		defer st.end()
+		x.goUnpackKeys(query, filter, st, in, out)
 	}()
 
 	return out
@@ -180,15 +216,25 @@ func (x *Stream) UnpackValues(query keyval.Value, filter bool, in chan KeyValErr
 
 	go func() {
 		defer close(out)
-		x.goUnpackValues(query, filter, in, out)
+		st := x.startStage("UnpackValues", "unpack values", func(f *format.Format) { f.Value(query) })
+		defer st.end()
+		x.goUnpackValues(query, filter, st, in, out)
 	}()
 
 	return out
 }
 
-func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Directory, out chan DirErr) {
+func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Directory, st *stage, out chan DirErr) {
 	log := x.log.With().Str("stage", "open directories").Interface("query", query).Logger()
 
+	if raw, ok := convert.ToRawPrefix(query); ok {
+		log.Log().Hex("raw", raw).Msg("sending raw prefix")
+		if x.SendDir(out, DirErr{Dir: &rawDirectory{subspace.FromBytes(raw), facade.NewNilDirectory()}}) {
+			st.results++
+		}
+		return
+	}
+
 	prefix, variable, suffix := splitAtFirstVariable(query)
 	prefixStr, err := convert.ToStringArray(prefix)
 	if err != nil {
@@ -197,6 +243,7 @@ func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Direct
 	}
 
 	if variable == nil {
+		x.metrics.Add(metrics.DirectoryOpens, 1, metrics.Label{Name: "op", Value: "open"})
 		dir, err := tr.DirOpen(prefixStr)
 		if err != nil {
 			if errors.Is(err, directory.ErrDirNotExists) {
@@ -207,10 +254,13 @@ func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Direct
 		}
 
 		log.Log().Strs("dir", dir.GetPath()).Msg("sending directory")
-		x.SendDir(out, DirErr{Dir: dir})
+		if x.SendDir(out, DirErr{Dir: dir}) {
+			st.results++
+		}
 		return
 	}
 
+	x.metrics.Add(metrics.DirectoryOpens, 1, metrics.Label{Name: "op", Value: "list"})
 	subDirs, err := tr.DirList(prefixStr)
 	if err != nil {
 		if errors.Is(err, directory.ErrDirNotExists) {
@@ -238,16 +288,20 @@ func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Direct
 		dir = append(dir, prefix...)
 		dir = append(dir, keyval.String(subDir))
 		dir = append(dir, suffix...)
-		x.goOpenDirectories(tr, dir, out)
+		x.goOpenDirectories(tr, dir, st, out)
 	}
 }
 
-func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts RangeOpts, in chan DirErr, out chan DirKVErr) {
+func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts RangeOpts, st *stage, in chan DirErr, out chan DirKVErr) {
 	log := x.log.With().Str("stage", "read range").Interface("query", query).Logger()
 
-	prefix := toTuplePrefix(query)
-	prefix = removeMaybeMore(prefix)
-	fdbPrefix, err := convert.ToFDBTuple(prefix)
+	// The number of directories read is included in the span.
+	dirs := 0
+	defer func() {
+		st.span.SetAttributes(trace.Int("fql.directories", dirs))
+	}()
+
+	fdbPrefix, err := convert.ToFDBTuple(TuplePrefix(query))
 	if err != nil {
 		x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "failed to convert prefix to FDB tuple")})
 		return
@@ -262,6 +316,14 @@ func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts
 		dir := msg.Dir
 		log := log.With().Strs("dir", dir.GetPath()).Logger()
 		log.Log().Msg("received directory")
+		dirs++
+
+		// The root of a partition cannot contain key-values
+		// and attempting to pack a key with it would panic.
+		if facade.IsPartition(dir) {
+			log.Log().Msg("skipping partition")
+			continue
+		}
 
 		rng, err := fdb.PrefixRange(dir.Pack(fdbPrefix))
 		if err != nil {
@@ -280,14 +342,17 @@ func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts
 				x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "failed to get key-value")})
 				return
 			}
+			x.metrics.Add(metrics.KeysScanned, 1)
+			x.metrics.Add(metrics.BytesRead, float64(len(kv.Key)+len(kv.Value)))
 			if !x.SendDirKV(out, DirKVErr{Dir: dir, KV: kv}) {
 				return
 			}
+			st.results++
 		}
 	}
 }
 
-func (x *Stream) goUnpackKeys(query keyval.Tuple, filter bool, in chan DirKVErr, out chan KeyValErr) {
+func (x *Stream) goUnpackKeys(query keyval.Tuple, filter bool, st *stage, in chan DirKVErr, out chan KeyValErr) {
 	log := x.log.With().Str("stage", "unpack keys").Interface("query", query).Logger()
 
 	for msg := range in {
@@ -309,7 +374,7 @@ func (x *Stream) goUnpackKeys(query keyval.Tuple, filter bool, in chan DirKVErr,
 
 		kv := keyval.KeyValue{
 			Key: keyval.Key{
-				Directory: convert.FromStringArray(dir.GetPath()),
+				Directory: ToDirectory(dir),
 				Tuple:     convert.FromFDBTuple(tup),
 			},
 			Value: keyval.Bytes(fromDB.Value),
@@ -324,13 +389,14 @@ func (x *Stream) goUnpackKeys(query keyval.Tuple, filter bool, in chan DirKVErr,
 		}
 
 		log.Log().Msg("sending key-value")
-		if !x.SendKV(out, KeyValErr{KV: kv}) {
+		if !x.SendKV(out, KeyValErr{KV: kv, Raw: fromDB}) {
 			return
 		}
+		st.results++
 	}
 }
 
-func (x *Stream) goUnpackValues(query keyval.Value, filter bool, in chan KeyValErr, out chan KeyValErr) {
+func (x *Stream) goUnpackValues(query keyval.Value, filter bool, st *stage, in chan KeyValErr, out chan KeyValErr) {
 	log := x.log.With().Str("stage", "unpack values").Interface("query", query).Logger()
 
 	valHandler, err := internal.NewValueHandler(query, x.order, filter)
@@ -357,11 +423,55 @@ func (x *Stream) goUnpackValues(query keyval.Value, filter bool, in chan KeyValE
 		}
 		if kv.Value != nil {
 			log.Log().Interface("kv", kv).Msg("sending key-value")
-			if !x.SendKV(out, KeyValErr{KV: kv}) {
+			if !x.SendKV(out, KeyValErr{KV: kv, Raw: msg.Raw}) {
 				return
 			}
+			st.results++
+			x.metrics.Add(metrics.KeysReturned, 1)
+		}
+	}
+}
+
+// stage records the span & metrics of a single stage of a pipeline.
+type stage struct {
+	stream  *Stream
+	name    string
+	start   time.Time
+	span    trace.Span
+	results int
+}
+
+// startStage begins recording the span & metrics of a stage. The
+// span is named after the given method & described by the query
+// which the given function formats. The query is only formatted if
+// a tracer is configured. The stage's metrics are labeled with the
+// given name.
+func (x *Stream) startStage(method string, name string, query func(*format.Format)) *stage {
+	var attrs []trace.Attr
+	if !trace.IsNop(x.tracer) {
+		attrs = []trace.Attr{
+			trace.String("fql.stage", name),
+			trace.String("fql.query", format.Sprint(query)),
 		}
 	}
+	_, span := x.tracer.Start(x.ctx, "stream."+method, attrs...)
+	return &stage{stream: x, name: name, start: time.Now(), span: span}
+}
+
+// end records the number of results sent by the stage
+// along with the time taken by the stage.
+func (x *stage) end() {
+	x.span.SetAttributes(trace.Int("fql.results", x.results))
+	x.span.End()
+	metrics.Since(x.stream.metrics, metrics.StageSeconds, x.start, metrics.Label{Name: "stage", Value: x.name})
+}
+
+// TuplePrefix returns the leading elements of the given tuple which
+// are packed into the prefix of the range read performed by
+// [Stream.ReadRange]. The remaining elements, excluding a trailing
+// [keyval.MaybeMore], are checked on the client by [Stream.UnpackKeys].
+func TuplePrefix(query keyval.Tuple) keyval.Tuple {
+	return removeMaybeMore(toTuplePrefix(query))
 }
 
 func splitAtFirstVariable(dir keyval.Directory) (keyval.Directory, *keyval.Variable, keyval.Directory) {
@@ -391,3 +501,21 @@ func removeMaybeMore(tup keyval.Tuple) keyval.Tuple {
 	}
 	return tup
 }
+
+// rawDirectory is sent by OpenDirectories when the query is a raw
+// prefix. It allows raw prefixes to flow through the pipeline as if
+// they were directories.
+type rawDirectory struct {
+	subspace.Subspace
+	directory.Directory
+}
+
+// ToDirectory converts a directory sent by [Stream.OpenDirectories]
+// into a [keyval.Directory]. Raw prefixes are converted back into
+// a raw prefix rather than a directory path.
+func ToDirectory(dir directory.DirectorySubspace) keyval.Directory {
+	if raw, ok := dir.(*rawDirectory); ok {
+		return convert.FromRawPrefix(raw.Bytes())
+	}
+	return convert.FromStringArray(dir.GetPath())
+}
@@ -23,12 +23,13 @@ import (
 var (
 	byteOrder binary.ByteOrder
 	force     bool
+	useFDB    bool
 )
 
 func init() {
-	fdb.MustAPIVersion(620)
 	byteOrder = binary.BigEndian
 	flag.BoolVar(&force, "force", false, "remove test directory if it exists")
+	flag.BoolVar(&useFDB, "fdb", false, "run tests against an FDB cluster instead of in memory")
 }
 
 func TestStream_OpenDirectories(t *testing.T) {
@@ -344,7 +345,7 @@ func TestToTuplePrefix(t *testing.T) {
 }
 
 func testEnv(t *testing.T, f func(facade.Transaction, Stream)) {
-	internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+	internal.TestEnv(t, useFDB, force, func(tr facade.Transactor, log zerolog.Logger) {
 		_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceName is the value of the "service.name" resource
+// attribute of the spans written by a FileExporter.
+const ServiceName = "fql"
+
+// FileExporter writes spans using the JSON encoding of the OpenTelemetry
+// protocol (OTLP). Each span is written on its own line as an OTLP
+// ExportTraceServiceRequest, which is the format read by the
+// OpenTelemetry Collector's "otlpjsonfile" receiver.
+type FileExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+var _ Exporter = &FileExporter{}
+
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []otlpAttr `json:"attributes,omitempty"`
+		Status            otlpStatus `json:"status"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue *string     `json:"stringValue,omitempty"`
+		IntValue    *string     `json:"intValue,omitempty"`
+		BoolValue   *bool       `json:"boolValue,omitempty"`
+		ArrayValue  *otlpValues `json:"arrayValue,omitempty"`
+	}
+
+	otlpValues struct {
+		Values []otlpValue `json:"values"`
+	}
+)
+
+// The OTLP span kind & status codes used by the FileExporter.
+const (
+	otlpKindInternal = 1
+	otlpStatusError  = 2
+)
+
+// NewFileExporter returns a FileExporter which writes to the given writer.
+func NewFileExporter(w io.Writer) *FileExporter {
+	return &FileExporter{enc: json.NewEncoder(w)}
+}
+
+func (x *FileExporter) Export(data SpanData) {
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttr{toOTLPAttr(String("service.name", ServiceName))}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/janderland/fql"},
+			Spans: []otlpSpan{toOTLPSpan(data)},
+		}},
+	}}}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.err != nil {
+		return
+	}
+	if err := x.enc.Encode(req); err != nil {
+		x.err = errors.Wrap(err, "failed to write span")
+	}
+}
+
+// Err returns the first error which occurred while writing spans.
+func (x *FileExporter) Err() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.err
+}
+
+func toOTLPSpan(data SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(data.Context.TraceID[:]),
+		SpanID:            hex.EncodeToString(data.Context.SpanID[:]),
+		Name:              data.Name,
+		Kind:              otlpKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(data.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(data.End.UnixNano(), 10),
+	}
+	if data.Parent.SpanID != ([8]byte{}) {
+		span.ParentSpanID = hex.EncodeToString(data.Parent.SpanID[:])
+	}
+	for _, attr := range data.Attrs {
+		span.Attributes = append(span.Attributes, toOTLPAttr(attr))
+	}
+	if data.Err != "" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: data.Err}
+	}
+	return span
+}
+
+func toOTLPAttr(attr Attr) otlpAttr {
+	return otlpAttr{Key: attr.Key, Value: toOTLPValue(attr.Value)}
+}
+
+// toOTLPValue converts an attribute's value. Values of
+// unsupported types are converted to an empty value.
+func toOTLPValue(value interface{}) otlpValue {
+	switch value := value.(type) {
+	case string:
+		return otlpValue{StringValue: &value}
+	case int:
+		str := strconv.Itoa(value)
+		return otlpValue{IntValue: &str}
+	case bool:
+		return otlpValue{BoolValue: &value}
+	case []string:
+		values := make([]otlpValue, 0, len(value))
+		for _, v := range value {
+			values = append(values, toOTLPValue(v))
+		}
+		return otlpValue{ArrayValue: &otlpValues{Values: values}}
+	default:
+		return otlpValue{}
+	}
+}
@@ -0,0 +1,94 @@
+// Package trace records spans describing the execution of queries. The
+// spans follow the data model of OpenTelemetry, so they can be correlated
+// with the traces of other services.
+package trace
+
+import (
+	"context"
+)
+
+// Attr is a key-value pair describing a span. The value
+// is a string, int, bool, or []string.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns an Attr with a string value.
+func String(key string, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Int returns an Attr with an int value.
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Bool returns an Attr with a bool value.
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Strings returns an Attr with a []string value.
+func Strings(key string, value []string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Span describes a single operation. Its methods must be safe for
+// concurrent use. Once End is called, the span must not be modified.
+type Span interface {
+	SetAttributes(attrs ...Attr)
+	RecordError(err error)
+	End()
+}
+
+// Tracer creates spans. It may be implemented to forward spans to an
+// OpenTelemetry SDK or another tracing system. Implementations must be
+// safe for concurrent use.
+type Tracer interface {
+	// Start begins a span with the given name & attributes. If the
+	// given context contains a span, the new span is its child. The
+	// returned context contains the new span.
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of the given context containing the span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span contained in the
+// given context. If there is no span, nil is returned.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+type (
+	nopTracer struct{}
+	nopSpan   struct{}
+)
+
+// Nop returns a Tracer whose spans do nothing.
+func Nop() Tracer {
+	return nopTracer{}
+}
+
+// IsNop returns true if the given Tracer was returned by Nop. Callers
+// may skip building attributes which would be discarded anyway.
+func IsNop(t Tracer) bool {
+	_, ok := t.(nopTracer)
+	return ok
+}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...Attr) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopSpan) SetAttributes(...Attr) {}
+
+func (nopSpan) RecordError(error) {}
+
+func (nopSpan) End() {}
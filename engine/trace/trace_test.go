@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type collector struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (x *collector) Export(data SpanData) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.spans = append(x.spans, data)
+}
+
+func TestTracer(t *testing.T) {
+	var exp collector
+	tracer := NewTracer(&exp)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", String("a", "b"))
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(Int("n", 2))
+	child.RecordError(errors.New("failed"))
+	child.End()
+	parent.End()
+
+	// Ending a span twice has no effect.
+	parent.End()
+
+	require.Len(t, exp.spans, 2)
+	c, p := exp.spans[0], exp.spans[1]
+
+	require.Equal(t, "parent", p.Name)
+	require.Equal(t, []Attr{String("a", "b")}, p.Attrs)
+	require.Equal(t, SpanContext{}, p.Parent)
+	require.Empty(t, p.Err)
+
+	require.Equal(t, "child", c.Name)
+	require.Equal(t, []Attr{Int("n", 2)}, c.Attrs)
+	require.Equal(t, p.Context, c.Parent)
+	require.Equal(t, p.Context.TraceID, c.Context.TraceID)
+	require.NotEqual(t, p.Context.SpanID, c.Context.SpanID)
+	require.Equal(t, "failed", c.Err)
+}
+
+func TestIsNop(t *testing.T) {
+	require.True(t, IsNop(Nop()))
+	require.False(t, IsNop(NewTracer(&collector{})))
+}
+
+func TestTraceParent(t *testing.T) {
+	const str = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceParent(str)
+	require.NoError(t, err)
+	require.Equal(t, str, sc.TraceParent())
+
+	var exp collector
+	_, span := NewTracer(&exp, Parent(sc)).Start(context.Background(), "root")
+	span.End()
+	require.Equal(t, sc, exp.spans[0].Parent)
+	require.Equal(t, sc.TraceID, exp.spans[0].Context.TraceID)
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+	} {
+		_, err := ParseTraceParent(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exp := NewFileExporter(&buf)
+
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	_, span := NewTracer(exp, Parent(sc)).Start(context.Background(), "engine.ReadRange",
+		String("fql.query", "/dir(<>)=<>"),
+		Int("fql.results", 3),
+		Bool("ok", true),
+		Strings("path", []string{"dir"}))
+	span.RecordError(errors.New("failed"))
+	span.End()
+	require.NoError(t, exp.Err())
+
+	var req map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &req))
+
+	spans := req["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	require.Len(t, spans, 1)
+
+	s := spans[0].(map[string]interface{})
+	require.Equal(t, "engine.ReadRange", s["name"])
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s["traceId"])
+	require.Equal(t, "00f067aa0ba902b7", s["parentSpanId"])
+	require.Len(t, s["spanId"], 16)
+	require.Equal(t, map[string]interface{}{"code": float64(2), "message": "failed"}, s["status"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"key": "fql.query", "value": map[string]interface{}{"stringValue": "/dir(<>)=<>"}},
+		map[string]interface{}{"key": "fql.results", "value": map[string]interface{}{"intValue": "3"}},
+		map[string]interface{}{"key": "ok", "value": map[string]interface{}{"boolValue": true}},
+		map[string]interface{}{"key": "path", "value": map[string]interface{}{"arrayValue": map[string]interface{}{
+			"values": []interface{}{map[string]interface{}{"stringValue": "dir"}},
+		}}},
+	}, s["attributes"])
+}
@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// SpanContext identifies a span within a trace. It may
+	// be propagated between services using [SpanContext.TraceParent]
+	// & [ParseTraceParent].
+	SpanContext struct {
+		TraceID [16]byte
+		SpanID  [8]byte
+	}
+
+	// SpanData is the completed span passed to an Exporter.
+	SpanData struct {
+		Name    string
+		Context SpanContext
+
+		// Parent is the span which this span is a child
+		// of. If this span is the root of the trace then
+		// Parent.SpanID is all zeros.
+		Parent SpanContext
+
+		Start time.Time
+		End   time.Time
+		Attrs []Attr
+
+		// Err is the error recorded by the span. If
+		// the operation succeeded, Err is empty.
+		Err string
+	}
+
+	// Exporter receives the spans created by the Tracer returned
+	// by NewTracer once they end. Implementations must be safe
+	// for concurrent use.
+	Exporter interface {
+		Export(SpanData)
+	}
+
+	// Option can be passed as a trailing argument to the NewTracer
+	// function to modify properties of the created Tracer.
+	Option func(*tracer)
+
+	tracer struct {
+		exp    Exporter
+		parent *SpanContext
+	}
+
+	span struct {
+		tracer *tracer
+
+		mu    sync.Mutex
+		data  SpanData
+		ended bool
+	}
+)
+
+var (
+	_ Tracer = &tracer{}
+	_ Span   = &span{}
+)
+
+// NewTracer returns a Tracer which passes its spans to the
+// given Exporter once they end.
+func NewTracer(exp Exporter, opts ...Option) Tracer {
+	t := tracer{exp: exp}
+	for _, option := range opts {
+		option(&t)
+	}
+	return &t
+}
+
+// Parent configures the span which the root spans of the Tracer are
+// children of. This allows the spans to join a trace started by another
+// service.
+func Parent(parent SpanContext) Option {
+	return func(t *tracer) {
+		t.parent = &parent
+	}
+}
+
+// ParseTraceParent parses the value of a W3C traceparent header, as
+// specified by https://www.w3.org/TR/trace-context/#traceparent-header.
+func ParseTraceParent(str string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(str), "-")
+	if len(parts) != 4 {
+		return SpanContext{}, errors.Errorf("expected 4 parts separated by '-', got %d", len(parts))
+	}
+	if len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, errors.Errorf("invalid version '%s'", parts[0])
+	}
+
+	var sc SpanContext
+	if err := decodeID(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, errors.Wrap(err, "invalid trace ID")
+	}
+	if err := decodeID(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, errors.Wrap(err, "invalid parent ID")
+	}
+	return sc, nil
+}
+
+func decodeID(dst []byte, str string) error {
+	if hex.DecodedLen(len(str)) != len(dst) {
+		return errors.Errorf("expected %d hex digits, got %d", len(dst)*2, len(str))
+	}
+	if _, err := hex.Decode(dst, []byte(str)); err != nil {
+		return err
+	}
+	for _, b := range dst {
+		if b != 0 {
+			return nil
+		}
+	}
+	return errors.New("ID is all zeros")
+}
+
+// TraceParent formats the SpanContext as the value
+// of a W3C traceparent header. The sampled flag is set.
+func (x SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%x-%x-01", x.TraceID, x.SpanID)
+}
+
+func (x *tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	s := span{
+		tracer: x,
+		data: SpanData{
+			Name:  name,
+			Start: time.Now(),
+			Attrs: append([]Attr(nil), attrs...),
+		},
+	}
+
+	// Spans created by other Tracers are ignored
+	// because their IDs aren't accessible.
+	if parent, ok := SpanFromContext(ctx).(*span); ok {
+		s.data.Parent = parent.data.Context
+	} else if x.parent != nil {
+		s.data.Parent = *x.parent
+	}
+
+	if s.data.Parent != (SpanContext{}) {
+		s.data.Context.TraceID = s.data.Parent.TraceID
+	} else {
+		randomID(s.data.Context.TraceID[:])
+	}
+	randomID(s.data.Context.SpanID[:])
+
+	return ContextWithSpan(ctx, &s), &s
+}
+
+func randomID(dst []byte) {
+	// The crypto/rand reader never
+	// fails on supported platforms.
+	if _, err := rand.Read(dst); err != nil {
+		panic(errors.Wrap(err, "failed to generate ID"))
+	}
+}
+
+// SpanContextFromContext returns the SpanContext of the span contained in
+// the given context. If the context doesn't contain a span created by the
+// Tracer returned by NewTracer, false is returned.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s, ok := SpanFromContext(ctx).(*span); ok {
+		return s.data.Context, true
+	}
+	return SpanContext{}, false
+}
+
+func (x *span) SetAttributes(attrs ...Attr) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.ended {
+		x.data.Attrs = append(x.data.Attrs, attrs...)
+	}
+}
+
+func (x *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.ended {
+		x.data.Err = err.Error()
+	}
+}
+
+func (x *span) End() {
+	x.mu.Lock()
+	if x.ended {
+		x.mu.Unlock()
+		return
+	}
+	x.ended = true
+	x.data.End = time.Now()
+	data := x.data
+	x.mu.Unlock()
+
+	x.tracer.exp.Export(data)
+}
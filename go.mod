@@ -13,6 +13,7 @@ require (
 	github.com/rs/zerolog v1.21.0
 	github.com/spf13/cobra v1.3.0
 	github.com/stretchr/testify v1.7.1
+	golang.org/x/term v0.6.0
 )
 
 require (
@@ -33,7 +34,6 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/term v0.6.0 // indirect
 	golang.org/x/text v0.3.8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -13,8 +14,14 @@ import (
 
 	"github.com/janderland/fql/engine"
 	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/engine/metrics"
+	"github.com/janderland/fql/engine/trace"
 	"github.com/janderland/fql/internal/app/fullscreen"
+	"github.com/janderland/fql/internal/app/fullscreen/editor"
+	"github.com/janderland/fql/internal/app/fullscreen/history"
 	"github.com/janderland/fql/internal/app/headless"
+	"github.com/janderland/fql/internal/app/repl"
+	"github.com/janderland/fql/internal/app/script"
 	"github.com/janderland/fql/parser/format"
 )
 
@@ -33,6 +40,10 @@ var (
 
 func init() {
 	flags = SetupFlags(FQL)
+	SetupDecodeFlags(Decode, flags)
+	FQL.AddCommand(Decode)
+	SetupServeFlags(Serve, flags)
+	FQL.AddCommand(Serve)
 }
 
 var FQL = &cobra.Command{
@@ -40,10 +51,22 @@ var FQL = &cobra.Command{
 	Short:   "fql is a query language for Foundation DB",
 	Version: Version,
 
+	// Shell completion isn't supported.
+	CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) > 0 {
 			return errors.New("unexpected positional args")
 		}
+		if flags.REPL && (len(flags.Queries) > 0 || len(flags.Files) > 0) {
+			return errors.New("cannot use the REPL & execute queries non-interactively at the same time")
+		}
+		if len(flags.Queries) > 0 && len(flags.Files) > 0 {
+			return errors.New("cannot execute queries & files at the same time")
+		}
+		if len(flags.TxStarts) > 0 && len(flags.Queries) == 0 {
+			return errors.New("transaction boundaries can only separate queries given via '--query'")
+		}
 
 		log := zerolog.Nop()
 		if flags.Log {
@@ -66,46 +89,253 @@ var FQL = &cobra.Command{
 			log = zerolog.New(writer).With().Timestamp().Logger()
 		}
 
-		log.Log().Str("cluster file", flags.Cluster).Msg("connecting to DB")
-		if err := fdb.APIVersion(APIVersion); err != nil {
-			return errors.Wrap(err, "failed to set FDB API version")
+		var registry *metrics.Registry
+		var opts []engine.Option
+		if flags.Metrics != "" {
+			if flags.Fullscreen() {
+				return errors.New("metrics cannot be written in fullscreen mode")
+			}
+			registry = metrics.NewRegistry()
+			opts = append(opts, engine.Metrics(registry))
 		}
-		db, err := fdb.OpenDatabase(flags.Cluster)
+
+		eg, tr, closeEngine, err := connect(log, opts...)
 		if err != nil {
-			return errors.Wrap(err, "failed to connect to DB")
+			return err
 		}
+		defer func() {
+			if err := closeEngine(); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+		}()
 
-		eg := engine.New(
-			facade.NewTransactor(db, directory.Root()),
-			engine.ByteOrder(flags.ByteOrder()),
-			engine.Logger(log))
+		// The options were validated by connect. The
+		// REPL & fullscreen UI allow them to be changed.
+		txOpts, _ := flags.TxOpts()
 
-		fmt := format.New(flags.FormatOpts()...)
 		out := os.Stdout
+		fmtOpts, err := flags.FormatOpts(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		color, err := flags.Colorize(out)
+		if err != nil {
+			return err
+		}
+		if color {
+			theme := format.ANSITheme()
+			if flags.Fullscreen() {
+				theme = fullscreen.Theme()
+			}
+			fmtOpts = append(fmtOpts, format.WithTheme(theme))
+		}
+		formatter := format.New(fmtOpts...)
 
 		if flags.Fullscreen() {
+			histOpts, err := flags.HistoryOpts()
+			if err != nil {
+				return err
+			}
+			hist := history.New(histOpts...)
+			if err := hist.Load(); err != nil {
+				return err
+			}
+
+			edOpts, err := flags.EditorOpts()
+			if err != nil {
+				return err
+			}
+
 			app := fullscreen.App{
-				Engine: eg,
-				Format: fmt,
-				Log:    log,
-				Out:    out,
+				Engine:  eg,
+				Format:  formatter,
+				History: hist,
+				Editor:  editor.New(edOpts...),
+				Log:     log,
+				Out:     out,
+
+				Transactor: tr,
 
 				Write:      flags.Write,
+				DryRun:     flags.DryRun,
 				SingleOpts: flags.SingleOpts(),
 				RangeOpts:  flags.RangeOpts(),
+				TxOpts:     txOpts,
 			}
 			return app.Run(cmd.Context())
 		}
 
 		app := headless.App{
 			Engine: eg,
-			Format: fmt,
+			Format: formatter,
 			Out:    out,
+			ErrOut: os.Stderr,
 
 			Write:      flags.Write,
+			Explain:    flags.Explain,
+			DryRun:     flags.DryRun,
 			SingleOpts: flags.SingleOpts(),
 			RangeOpts:  flags.RangeOpts(),
+			KeepGoing:  flags.KeepGoing,
+			TxSize:     flags.TxSize,
+			StdinBlob:  flags.StdinBlob,
+		}
+		if !flags.REPL && !flags.ReadsStdin() {
+			app.Stdin = os.Stdin
 		}
-		return app.Run(cmd.Context(), flags.Queries)
+		switch {
+		case flags.REPL:
+			r := repl.App{In: os.Stdin, Exec: app, TxOpts: txOpts}
+			err = r.Run(cmd.Context())
+		case len(flags.Files) > 0:
+			err = runFiles(cmd.Context(), &app, flags.Files)
+		default:
+			err = app.RunTransactions(cmd.Context(), flags.Transactions())
+		}
+		if registry != nil {
+			// Metrics are written even if the queries failed
+			// because they may explain the failure. If both
+			// fail, the error of the queries is returned.
+			if metricsErr := writeMetrics(registry, flags.Metrics); err == nil {
+				err = metricsErr
+			}
+		}
+		return err
 	},
 }
+
+// runFiles executes the queries in the given files, in order.
+// If a path is '-', the queries are read from stdin.
+func runFiles(ctx context.Context, app *headless.App, paths []string) error {
+	var scripts []*script.Reader
+	for _, path := range paths {
+		if path == "-" {
+			scripts = append(scripts, script.NewReader("stdin", os.Stdin))
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to open file")
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		scripts = append(scripts, script.NewReader(path, file))
+	}
+	return app.RunScripts(ctx, scripts...)
+}
+
+// writeMetrics writes the metrics to the given file
+// or, if the path is '-', to stderr.
+func writeMetrics(registry *metrics.Registry, path string) error {
+	if path == "-" {
+		return errors.Wrap(registry.Write(os.Stderr), "failed to write metrics")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create metrics file")
+	}
+	if err := registry.Write(file); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "failed to write metrics")
+	}
+	return errors.Wrap(file.Close(), "failed to close metrics file")
+}
+
+// connect opens the DB specified by the flags and returns an Engine
+// configured by the flags, along with the Transactor backing the
+// Engine. If a recording is being replayed, the DB
+// isn't opened. The returned function must be called once the Engine
+// is no longer needed so the recording & trace files, if any, are closed. The given
+// options are applied to the Engine after those specified by the flags.
+func connect(log zerolog.Logger, opts ...engine.Option) (engine.Engine, facade.Transactor, func() error, error) {
+	noop := func() error { return nil }
+
+	txOpts, err := flags.TxOpts()
+	if err != nil {
+		return engine.Engine{}, nil, noop, errors.Wrap(err, "invalid transaction options")
+	}
+	if flags.Record != "" && flags.Replay != "" {
+		return engine.Engine{}, nil, noop, errors.New("cannot record & replay at the same time")
+	}
+	traceOpts, err := flags.TraceOpts()
+	if err != nil {
+		return engine.Engine{}, nil, noop, err
+	}
+
+	// The API version is selected even when replaying
+	// because the tuple layer depends on it.
+	if err := fdb.APIVersion(APIVersion); err != nil {
+		return engine.Engine{}, nil, noop, errors.Wrap(err, "failed to set FDB API version")
+	}
+
+	var tr facade.Transactor
+	closer := noop
+
+	if flags.Replay != "" {
+		log.Log().Str("recording", flags.Replay).Msg("replaying recording")
+		file, err := os.Open(flags.Replay)
+		if err != nil {
+			return engine.Engine{}, nil, noop, errors.Wrap(err, "failed to open recording")
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		tr, err = facade.NewReplayer(file)
+		if err != nil {
+			return engine.Engine{}, nil, noop, err
+		}
+	} else {
+		log.Log().Str("cluster file", flags.Cluster).Msg("connecting to DB")
+		db, err := fdb.OpenDatabase(flags.Cluster)
+		if err != nil {
+			return engine.Engine{}, nil, noop, errors.Wrap(err, "failed to connect to DB")
+		}
+		tr = facade.NewTransactor(db, directory.Root())
+
+		if flags.Record != "" {
+			log.Log().Str("recording", flags.Record).Msg("recording DB calls")
+			file, err := os.Create(flags.Record)
+			if err != nil {
+				return engine.Engine{}, nil, noop, errors.Wrap(err, "failed to create recording")
+			}
+			tr = facade.NewRecorder(tr, file)
+			closer = func() error {
+				return errors.Wrap(file.Close(), "failed to close recording")
+			}
+		}
+	}
+
+	opts = append([]engine.Option{
+		engine.ByteOrder(flags.ByteOrder()),
+		engine.TxOpts(txOpts),
+		engine.Logger(log),
+	}, opts...)
+
+	if flags.Trace != "" {
+		log.Log().Str("trace", flags.Trace).Msg("writing spans")
+		file, err := os.Create(flags.Trace)
+		if err != nil {
+			_ = closer()
+			return engine.Engine{}, nil, noop, errors.Wrap(err, "failed to create trace file")
+		}
+		exp := trace.NewFileExporter(file)
+		opts = append(opts, engine.Tracer(trace.NewTracer(exp, traceOpts...)))
+
+		closeRecording := closer
+		closer = func() error {
+			err := exp.Err()
+			if closeErr := file.Close(); err == nil {
+				err = errors.Wrap(closeErr, "failed to close trace file")
+			}
+			if closeErr := closeRecording(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+	}
+
+	return engine.New(tr, opts...), tr.WithTxOpts(txOpts), closer, nil
+}
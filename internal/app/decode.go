@@ -0,0 +1,140 @@
+package app
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser/format"
+)
+
+var Decode = &cobra.Command{
+	Use:   "decode [flags] key [value]",
+	Short: "decode raw FDB key & value bytes into FQL",
+	Long: `Decode raw FDB key & value bytes into FQL.
+
+The bytes may be provided as hex prefixed by '0x' or in the escaped
+format printed by fdbcli & trace logs, such as '\x15\x01hello'. The
+directory containing the key is found via the directory layer. If
+no directory contains the key, it's printed with a raw prefix.`,
+	Args: cobra.RangeArgs(1, 2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := parseBytes(args[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to parse key")
+		}
+
+		var value []byte
+		if len(args) > 1 {
+			value, err = parseBytes(args[1])
+			if err != nil {
+				return errors.Wrap(err, "failed to parse value")
+			}
+		}
+
+		valueType, err := flags.ValueTypes()
+		if err != nil {
+			return errors.Wrap(err, "invalid value type")
+		}
+
+		log := zerolog.Nop()
+		if flags.Log {
+			log = zerolog.New(zerolog.ConsoleWriter{
+				Out:         os.Stderr,
+				FormatLevel: func(_ interface{}) string { return "" },
+			}).With().Timestamp().Logger()
+		}
+
+		eg, _, closeEngine, err := connect(log)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := closeEngine(); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+		}()
+
+		decodedKey, err := eg.DecodeKey(key)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode key")
+		}
+
+		fmtOpts, err := flags.FormatOpts(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		f := format.New(fmtOpts...)
+		if len(args) == 1 {
+			f.Key(decodedKey)
+		} else {
+			decodedValue, err := eg.DecodeValue(value, valueType)
+			if err != nil {
+				return errors.Wrap(err, "failed to decode value")
+			}
+			f.KeyValue(keyval.KeyValue{Key: decodedKey, Value: decodedValue})
+		}
+
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), f.String()); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+		return nil
+	},
+}
+
+// SetupDecodeFlags defines the flags specific to the decode
+// command. The persistent flags of the root command, such
+// as the cluster file, are inherited by the decode command.
+func SetupDecodeFlags(cmd *cobra.Command, flags *Flags) {
+	cmd.Flags().StringVarP(&flags.ValueType, "type", "t", "", "decode the value as the first of the given types which succeeds, such as 'int|string'")
+}
+
+// parseBytes parses a byte string provided as hex prefixed by
+// '0x' or in the escaped format used by fdbcli & trace logs.
+// The quotes fdbcli places around byte strings are optional.
+func parseBytes(str string) ([]byte, error) {
+	if strings.HasPrefix(str, "0x") {
+		out, err := hex.DecodeString(str[2:])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid hex string")
+		}
+		return out, nil
+	}
+
+	if len(str) >= 2 && str[0] == '`' && str[len(str)-1] == '\'' {
+		str = str[1 : len(str)-1]
+	}
+
+	out := make([]byte, 0, len(str))
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' {
+			out = append(out, str[i])
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(str[i:], `\\`):
+			out = append(out, '\\')
+			i++
+
+		case strings.HasPrefix(str[i:], `\x`) && len(str) >= i+4:
+			b, err := hex.DecodeString(str[i+2 : i+4])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid escape at index %d", i)
+			}
+			out = append(out, b[0])
+			i += 3
+
+		default:
+			return nil, errors.Errorf("invalid escape at index %d", i)
+		}
+	}
+	return out, nil
+}
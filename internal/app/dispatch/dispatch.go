@@ -0,0 +1,222 @@
+// Package dispatch parses, classifies, & executes queries using the
+// appropriate [engine.Engine] method. It's shared by the headless,
+// fullscreen, & server apps, which only render the results.
+package dispatch
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/stream"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/class"
+	"github.com/janderland/fql/parser"
+	"github.com/janderland/fql/parser/scanner"
+)
+
+// Kind specifies which Engine method executes a Query.
+type Kind string
+
+const (
+	// Directory queries are executed by [engine.Engine.Directories].
+	Directory Kind = "directory"
+
+	// Move queries are executed by [engine.Engine.Move].
+	Move Kind = "move"
+
+	// Set queries are executed by [engine.Engine.Set].
+	Set Kind = "set"
+
+	// Clear queries are executed by [engine.Engine.Clear].
+	Clear Kind = "clear"
+
+	// ReadSingle queries are executed by [engine.Engine.ReadSingle].
+	ReadSingle Kind = "single read"
+
+	// ReadRange queries are executed by [engine.Engine.ReadRange].
+	ReadRange Kind = "range read"
+)
+
+// Writes returns true if queries of this Kind write to the DB.
+func (x Kind) Writes() bool {
+	switch x {
+	case Move, Set, Clear:
+		return true
+	default:
+		return false
+	}
+}
+
+// Query is a classified query. Only one of the Directory,
+// Move, or KeyValue fields is set, depending on the Kind.
+type Query struct {
+	Kind      Kind
+	Directory keyval.Directory
+	Move      keyval.Move
+
+	// KeyValue is set for the Set, Clear, ReadSingle, &
+	// ReadRange kinds. If the query was parsed as a key,
+	// the value is an empty variable.
+	KeyValue keyval.KeyValue
+}
+
+// Opts configures how Execute executes a Query.
+type Opts struct {
+	// Write enables the Move, Set, & Clear kinds. In
+	// dry-run mode, writing doesn't need to be enabled.
+	Write  bool
+	DryRun bool
+
+	Single engine.SingleOpts
+	Range  engine.RangeOpts
+}
+
+// Result is the outcome of a Query executed by Execute.
+// Which fields are set depends on the Query's Kind.
+type Result struct {
+	// Directories streams the results of the Directory kind.
+	Directories chan stream.DirErr
+
+	// KeyValues streams the results of the ReadRange kind.
+	KeyValues chan stream.KeyValErr
+
+	// KeyValue is the result of the ReadSingle kind. If
+	// the key doesn't exist, KeyValue is nil.
+	KeyValue *keyval.KeyValue
+
+	// Message describes the writes performed by the Move,
+	// Set, & Clear kinds. In dry-run mode, Message is empty.
+	Message string
+
+	// Mutations describes the writes which would have been
+	// performed by the Move, Set, & Clear kinds in dry-run
+	// mode. Otherwise, Mutations is nil.
+	Mutations []engine.Mutation
+}
+
+// Execute executes the given Query using the Engine method for its
+// Kind. The streams of the returned Result are read until closed or
+// the given context is canceled. Errors encountered by the streams
+// are sent along with the results instead of being returned.
+func Execute(ctx context.Context, eg engine.Engine, query Query, opts Opts) (Result, error) {
+	var (
+		res Result
+		err error
+	)
+	switch query.Kind {
+	case Directory:
+		res.Directories = eg.Directories(ctx, query.Directory)
+
+	case Move:
+		res, err = write(eg, opts, "directory moved", func(eg engine.Engine) error {
+			_, err := eg.Move(query.Move)
+			return err
+		})
+
+	case Set:
+		res, err = write(eg, opts, "key set", func(eg engine.Engine) error {
+			return eg.Set(query.KeyValue)
+		})
+
+	case Clear:
+		res, err = write(eg, opts, "key cleared", func(eg engine.Engine) error {
+			return eg.Clear(query.KeyValue)
+		})
+
+	case ReadSingle:
+		res.KeyValue, err = eg.ReadSingle(query.KeyValue, opts.Single)
+
+	case ReadRange:
+		res.KeyValues = eg.ReadRange(ctx, query.KeyValue, opts.Range)
+
+	default:
+		return Result{}, errors.Errorf("unexpected query kind '%v'", query.Kind)
+	}
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "failed to execute as %s query", query.Kind)
+	}
+	return res, nil
+}
+
+// write executes the given write function using Write. On
+// success, the returned Result contains the given message.
+func write(eg engine.Engine, opts Opts, msg string, f func(engine.Engine) error) (Result, error) {
+	mutations, err := Write(eg, opts.Write, opts.DryRun, f)
+	if err != nil {
+		return Result{}, err
+	}
+	if mutations != nil {
+		return Result{Mutations: mutations}, nil
+	}
+	return Result{Message: msg}, nil
+}
+
+// Parse parses the given string as a query. The returned
+// query may be passed to [engine.Engine.Explain] or Classify.
+func Parse(str string) (keyval.Query, error) {
+	p := parser.New(scanner.New(strings.NewReader(str)))
+	return p.Parse()
+}
+
+// Classify determines which Kind of Query the given query is. An
+// error is returned if no Engine method can execute the query.
+func Classify(query keyval.Query) (Query, error) {
+	switch query := query.(type) {
+	case keyval.Directory:
+		return Query{Kind: Directory, Directory: query}, nil
+
+	case keyval.Move:
+		return Query{Kind: Move, Move: query}, nil
+
+	case keyval.Key:
+		return classifyKeyValue(keyval.KeyValue{Key: query, Value: keyval.Variable{}})
+
+	case keyval.KeyValue:
+		return classifyKeyValue(query)
+
+	default:
+		return Query{}, errors.Errorf("unexpected query type '%T'", query)
+	}
+}
+
+func classifyKeyValue(kv keyval.KeyValue) (Query, error) {
+	var kind Kind
+	switch c := class.Classify(kv); c {
+	case class.Constant, class.VStampKey, class.VStampVal:
+		kind = Set
+	case class.Clear:
+		kind = Clear
+	case class.ReadSingle:
+		kind = ReadSingle
+	case class.ReadRange:
+		kind = ReadRange
+	default:
+		return Query{}, errors.Errorf("unexpected query class '%v'", c)
+	}
+	return Query{Kind: kind, KeyValue: kv}, nil
+}
+
+// Write executes the given write function. If writing isn't enabled,
+// an error is returned. In dry-run mode, writing doesn't need to be
+// enabled. Instead of performing the writes, they are described by the
+// returned mutations, which are never nil in dry-run mode.
+func Write(eg engine.Engine, write bool, dryRun bool, f func(engine.Engine) error) ([]engine.Mutation, error) {
+	if !dryRun {
+		if !write {
+			return nil, errors.New("writing isn't enabled")
+		}
+		return nil, f(eg)
+	}
+
+	mutations := []engine.Mutation{}
+	eg = eg.WithDryRun(func(m engine.Mutation) {
+		mutations = append(mutations, m)
+	})
+	if err := f(eg); err != nil {
+		return nil, err
+	}
+	return mutations, nil
+}
@@ -0,0 +1,162 @@
+package dispatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+)
+
+func init() {
+	// The tuple layer requires an API version
+	// when packing versionstamps.
+	fdb.MustAPIVersion(620)
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		query string
+		kind  Kind
+		err   bool
+	}{
+		{query: "/my/dir", kind: Directory},
+		{query: "/old/dir=/new/dir", kind: Move},
+		{query: "/my/dir(1)=2", kind: Set},
+		{query: "/my/dir(1)=clear", kind: Clear},
+		{query: "/my/dir(1)", kind: ReadSingle},
+		{query: "/my/dir(1)=<int>", kind: ReadSingle},
+		{query: "/my/dir(<>)", kind: ReadRange},
+		{query: "/my/dir(<>)=clear", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := Parse(test.query)
+			require.NoError(t, err)
+
+			d, err := Classify(query)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.kind, d.Kind)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	eg := engine.New(facade.NewNilTransactor())
+	query, err := Parse("/my/dir(1)=2")
+	require.NoError(t, err)
+	d, err := Classify(query)
+	require.NoError(t, err)
+
+	set := func(eg engine.Engine) error {
+		return eg.Set(d.KeyValue)
+	}
+
+	_, err = Write(eg, false, false, set)
+	require.Error(t, err)
+
+	mutations, err := Write(eg, true, false, set)
+	require.NoError(t, err)
+	require.Nil(t, mutations)
+
+	mutations, err = Write(eg, false, true, set)
+	require.NoError(t, err)
+	require.NotEmpty(t, mutations)
+}
+
+func TestWrite_VStamp(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+	dir := keyval.Directory{keyval.String("my"), keyval.String("dir")}
+
+	// The parser doesn't accept versionstamps,
+	// so these queries are constructed directly.
+	queries := map[string]keyval.KeyValue{
+		"key": {
+			Key:   keyval.Key{Directory: dir, Tuple: keyval.Tuple{keyval.VStampFuture{UserVersion: 1}}},
+			Value: keyval.Int(2),
+		},
+		"value": {
+			Key:   keyval.Key{Directory: dir, Tuple: keyval.Tuple{keyval.Int(1)}},
+			Value: keyval.Tuple{keyval.VStampFuture{UserVersion: 1}},
+		},
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			d, err := Classify(query)
+			require.NoError(t, err)
+			require.Equal(t, Set, d.Kind)
+
+			_, err = Write(eg, true, false, func(eg engine.Engine) error {
+				return eg.Set(d.KeyValue)
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	query, err := Parse("/my/dir(<>)")
+	require.NoError(t, err)
+	d, err := Classify(query)
+	require.NoError(t, err)
+
+	var count int
+	for kv := range eg.ReadRange(context.Background(), d.KeyValue, engine.RangeOpts{}) {
+		require.NoError(t, kv.Err)
+		count++
+	}
+	require.Equal(t, 2, count)
+}
+
+func TestExecute(t *testing.T) {
+	ctx := context.Background()
+	eg := engine.New(facade.NewMemTransactor(nil))
+
+	execute := func(str string, opts Opts) (Result, error) {
+		query, err := Parse(str)
+		require.NoError(t, err)
+		d, err := Classify(query)
+		require.NoError(t, err)
+		return Execute(ctx, eg, d, opts)
+	}
+
+	_, err := execute("/my/dir(1)=2", Opts{})
+	require.Error(t, err)
+
+	res, err := execute("/my/dir(1)=2", Opts{DryRun: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Mutations)
+
+	res, err = execute("/my/dir(1)=2", Opts{Write: true})
+	require.NoError(t, err)
+	require.Equal(t, Result{Message: "key set"}, res)
+
+	res, err = execute("/my/dir(1)=<int>", Opts{})
+	require.NoError(t, err)
+	require.NotNil(t, res.KeyValue)
+	require.Equal(t, keyval.Int(2), res.KeyValue.Value)
+
+	res, err = execute("/my/dir(<>)", Opts{})
+	require.NoError(t, err)
+	var count int
+	for kv := range res.KeyValues {
+		require.NoError(t, kv.Err)
+		count++
+	}
+	require.Equal(t, 1, count)
+
+	res, err = execute("/my/<>", Opts{})
+	require.NoError(t, err)
+	var dirs [][]string
+	for dir := range res.Directories {
+		require.NoError(t, dir.Err)
+		dirs = append(dirs, dir.Dir.GetPath())
+	}
+	require.Equal(t, [][]string{{"my", "dir"}}, dirs)
+}
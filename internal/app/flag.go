@@ -1,46 +1,169 @@
 package app
 
 import (
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/engine/trace"
+	"github.com/janderland/fql/internal/app/fullscreen/editor"
+	"github.com/janderland/fql/internal/app/fullscreen/history"
+	"github.com/janderland/fql/keyval"
 	"github.com/janderland/fql/parser/format"
 )
 
 type Flags struct {
 	Cluster string
 	Write   bool
+	Explain bool
+	DryRun  bool
+	REPL    bool
 	Log     bool
 	LogFile string
+	Record  string
+	Replay  string
+	Metrics string
+	Trace   string
+	Parent  string
+
+	Queries   []string
+	Files     []string
+	KeepGoing bool
+	TxSize    int
+	StdinBlob bool
+
+	// TxStarts contains the indexes of the
+	// queries which start a new transaction.
+	TxStarts []int
 
-	Queries []string
 	Reverse bool
 	Strict  bool
 	Little  bool
 	Bytes   bool
 	Limit   int
+	Details bool
+	Color   string
+	Width   int
+
+	Placeholders []string
+	RedactDirs   []int
+	RedactKey    []int
+	RedactValue  bool
+	RedactSalt   string
+
+	ValueType string
+	Addr      string
+
+	HistoryFile string
+	HistorySize int
+	BufferFile  string
+
+	Timeout       time.Duration
+	RetryLimit    int
+	MaxRetryDelay time.Duration
+	Priority      string
 }
 
+// SetupFlags defines the flags of the given command. Flags which are
+// needed to connect to the DB & encode/decode data are persistent, so
+// they're inherited by subcommands.
 func SetupFlags(cmd *cobra.Command) *Flags {
 	var flags Flags
 
-	cmd.Flags().StringVarP(&flags.Cluster, "cluster", "c", "", "path to cluster file")
+	cmd.PersistentFlags().StringVarP(&flags.Cluster, "cluster", "c", "", "path to cluster file")
 	cmd.Flags().BoolVarP(&flags.Write, "write", "w", false, "allow write queries")
-	cmd.Flags().BoolVar(&flags.Log, "log", false, "enable debug logging")
+	cmd.Flags().BoolVar(&flags.Explain, "explain", false, "describe how the given queries would execute instead of executing them")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", false, "print the packed bytes of write queries instead of writing them")
+	cmd.PersistentFlags().BoolVar(&flags.Log, "log", false, "enable debug logging")
 	cmd.Flags().StringVar(&flags.LogFile, "log-file", "log.txt", "logging file when in fullscreen")
+	cmd.PersistentFlags().StringVar(&flags.Record, "record", "", "record the DB calls & their results to the given file")
+	cmd.PersistentFlags().StringVar(&flags.Replay, "replay", "", "serve DB calls from the given recording instead of a DB")
+	cmd.PersistentFlags().StringVar(&flags.Trace, "trace", "", "write a span for each query & pipeline stage to the given file as OTLP JSON")
+	cmd.PersistentFlags().StringVar(&flags.Parent, "trace-parent", "", "W3C traceparent of the span which the spans are children of, defaults to $TRACEPARENT")
+	cmd.Flags().StringVar(&flags.Metrics, "metrics", "", "after executing the queries, write a summary of metrics to the given file, or '-' for stderr")
 
 	cmd.Flags().StringArrayVarP(&flags.Queries, "query", "q", nil, "execute query non-interactively")
+	cmd.Flags().StringArrayVarP(&flags.Files, "file", "f", nil, "execute the queries in the given file non-interactively, or '-' for stdin")
+	cmd.Flags().BoolVar(&flags.KeepGoing, "keep-going", false, "report failed transactions & continue executing the rest")
+	cmd.Flags().VarPF(txFlag{flags: &flags}, "tx", "", "end the transaction of the preceding queries, so the following queries execute in a new transaction").NoOptDefVal = "true"
+	cmd.Flags().IntVar(&flags.TxSize, "tx-size", 0, "commit after every given number of queries, defaults to 1 when executing files")
+	cmd.Flags().BoolVar(&flags.StdinBlob, "stdin-blob", false, "use all of stdin as the value of the ':stdin' reference instead of each line")
+	cmd.Flags().StringVar(&flags.HistoryFile, "history-file", "", "file storing the query history of the fullscreen UI, defaults to fql/history in the user config directory")
+	cmd.Flags().IntVar(&flags.HistorySize, "history-size", history.DefaultMaxSize, "max number of queries kept in the history, 0 disables saving the history")
+	cmd.Flags().StringVar(&flags.BufferFile, "buffer-file", "", "file which the multi-line editor of the fullscreen UI saves to & loads from, defaults to fql/buffer.fql in the user config directory")
+	cmd.Flags().BoolVar(&flags.REPL, "repl", false, "read queries from stdin line by line instead of starting the fullscreen UI")
 	cmd.Flags().BoolVarP(&flags.Reverse, "reverse", "r", false, "query range-reads in reverse order")
 	cmd.Flags().BoolVarP(&flags.Strict, "strict", "s", false, "throw an error if a KV is read which doesn't match the schema")
-	cmd.Flags().BoolVarP(&flags.Little, "little", "l", false, "encode/decode values as little endian instead of big endian")
-	cmd.Flags().BoolVarP(&flags.Bytes, "bytes", "b", false, "print full byte strings instead of just their length")
+	cmd.PersistentFlags().BoolVarP(&flags.Little, "little", "l", false, "encode/decode values as little endian instead of big endian")
+	cmd.PersistentFlags().BoolVarP(&flags.Bytes, "bytes", "b", false, "print full byte strings instead of just their length")
 	cmd.Flags().IntVar(&flags.Limit, "limit", 0, "limit the number of KVs read in range-reads")
+	cmd.Flags().BoolVar(&flags.Details, "details", false, "print the prefix of each directory when listing directories")
+	cmd.Flags().StringVar(&flags.Color, "color", "auto", "highlight the output: auto, always, or never")
+	cmd.Flags().IntVar(&flags.Width, "width", 0, "print tuples across multiple indented lines if they would exceed the given width")
+	cmd.Flags().StringArrayVar(&flags.Placeholders, "placeholder", nil, "print elements of the given type as a variable instead of their value")
+	cmd.Flags().IntSliceVar(&flags.RedactDirs, "redact-dir", nil, "replace the directory elements at the given indexes with hashes")
+	cmd.Flags().IntSliceVar(&flags.RedactKey, "redact-key", nil, "replace the strings & bytes of the key's tuple elements at the given indexes with hashes")
+	cmd.Flags().BoolVar(&flags.RedactValue, "redact-value", false, "replace the strings & bytes of values with hashes")
+	cmd.Flags().StringVar(&flags.RedactSalt, "redact-salt", "", "salt mixed into the redaction hashes, defaults to $FQL_REDACT_SALT or a random salt")
+
+	cmd.PersistentFlags().DurationVar(&flags.Timeout, "timeout", 0, "cancel transactions which take longer than the given duration")
+	cmd.PersistentFlags().IntVar(&flags.RetryLimit, "retry-limit", 0, "max number of times a transaction is retried, -1 disables retries")
+	cmd.PersistentFlags().DurationVar(&flags.MaxRetryDelay, "max-retry-delay", 0, "max backoff delay between transaction retries")
+	cmd.PersistentFlags().StringVar(&flags.Priority, "priority", "default", "transaction priority: default, batch, or immediate")
 
 	return &flags
 }
 
+// txFlag is the value of the transaction boundary flag. Because
+// flags are parsed in order, the number of queries parsed so far
+// is the index of the query which starts the next transaction.
+type txFlag struct {
+	flags *Flags
+}
+
+func (x txFlag) String() string {
+	return ""
+}
+
+func (x txFlag) Set(value string) error {
+	if value != "true" {
+		return errors.Errorf("unexpected value '%s'", value)
+	}
+	x.flags.TxStarts = append(x.flags.TxStarts, len(x.flags.Queries))
+	return nil
+}
+
+// Type returns "bool" so the flag is
+// documented without a value.
+func (x txFlag) Type() string {
+	return "bool"
+}
+
+// Transactions groups the queries into the transactions
+// separated by the transaction boundary flag.
+func (x *Flags) Transactions() [][]string {
+	var txs [][]string
+	start := 0
+	for _, end := range append(x.TxStarts, len(x.Queries)) {
+		if end > start {
+			txs = append(txs, x.Queries[start:end])
+			start = end
+		}
+	}
+	return txs
+}
+
 func (x *Flags) ByteOrder() binary.ByteOrder {
 	if x.Little {
 		return binary.LittleEndian
@@ -62,14 +185,177 @@ func (x *Flags) RangeOpts() engine.RangeOpts {
 	}
 }
 
-func (x *Flags) FormatOpts() []format.Option {
+func (x *Flags) TxOpts() (facade.TxOpts, error) {
+	priority, err := facade.ParsePriority(x.Priority)
+	if err != nil {
+		return facade.TxOpts{}, err
+	}
+	return facade.TxOpts{
+		Timeout:       x.Timeout,
+		RetryLimit:    x.RetryLimit,
+		MaxRetryDelay: x.MaxRetryDelay,
+		Priority:      priority,
+	}, nil
+}
+
+// TraceOpts returns the options for the tracer. The parent span is
+// specified by the trace parent flag or, if the flag isn't set, by
+// the TRACEPARENT environment variable.
+func (x *Flags) TraceOpts() ([]trace.Option, error) {
+	parent := x.Parent
+	if parent == "" {
+		parent = os.Getenv("TRACEPARENT")
+	}
+	if parent == "" {
+		return nil, nil
+	}
+
+	sc, err := trace.ParseTraceParent(parent)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid trace parent")
+	}
+	return []trace.Option{trace.Parent(sc)}, nil
+}
+
+// FormatOpts returns the format options specified by the flags. If
+// redaction is enabled without a salt, a random salt is generated &
+// written to errOut so the output may be correlated with later runs.
+func (x *Flags) FormatOpts(errOut io.Writer) ([]format.Option, error) {
 	var opts []format.Option
 	if x.Bytes {
 		opts = append(opts, format.WithPrintBytes())
 	}
-	return opts
+	if x.Details {
+		opts = append(opts, format.WithDirDetails())
+	}
+	if x.Width > 0 {
+		opts = append(opts, format.WithWidth(x.Width))
+	}
+
+	var types []keyval.ValueType
+	for _, str := range x.Placeholders {
+		typ, ok := parseValueType(str)
+		if !ok || typ == keyval.AnyType {
+			return nil, errors.Errorf("unknown placeholder type '%s'", str)
+		}
+		types = append(types, typ)
+	}
+	if len(types) > 0 {
+		opts = append(opts, format.WithPlaceholders(types...))
+	}
+
+	if len(x.RedactDirs) > 0 || len(x.RedactKey) > 0 || x.RedactValue {
+		if x.RedactSalt == "" {
+			x.RedactSalt = os.Getenv("FQL_REDACT_SALT")
+		}
+		if x.RedactSalt == "" {
+			var salt [16]byte
+			if _, err := rand.Read(salt[:]); err != nil {
+				return nil, errors.Wrap(err, "failed to generate redaction salt")
+			}
+			x.RedactSalt = hex.EncodeToString(salt[:])
+			fmt.Fprintf(errOut, "generated redaction salt: %s\n", x.RedactSalt)
+		}
+		opts = append(opts, format.WithRedaction(format.Redaction{
+			Salt:      []byte(x.RedactSalt),
+			Directory: x.RedactDirs,
+			Tuple:     x.RedactKey,
+			Value:     x.RedactValue,
+		}))
+	}
+	return opts, nil
+}
+
+// Colorize returns true if the output written to the given file
+// should be highlighted. When the color flag is "auto", output is
+// highlighted if the file is a terminal & $NO_COLOR isn't set.
+func (x *Flags) Colorize(out *os.File) (bool, error) {
+	switch x.Color {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(out.Fd())), nil
+	default:
+		return false, errors.Errorf("unknown color mode '%s'", x.Color)
+	}
+}
+
+// ValueTypes parses the value type flag, which lists the types
+// separated by '|', into a keyval.Variable. The surrounding '<'
+// & '>' of a variable are optional.
+func (x *Flags) ValueTypes() (keyval.Variable, error) {
+	str := strings.TrimSuffix(strings.TrimPrefix(x.ValueType, "<"), ">")
+	if str == "" {
+		return keyval.Variable{}, nil
+	}
+
+	var variable keyval.Variable
+	for _, part := range strings.Split(str, "|") {
+		typ, ok := parseValueType(part)
+		if !ok {
+			return nil, errors.Errorf("unknown value type '%s'", part)
+		}
+		variable = append(variable, typ)
+	}
+	return variable, nil
+}
+
+func parseValueType(str string) (keyval.ValueType, bool) {
+	for _, typ := range keyval.AllTypes() {
+		if string(typ) == strings.TrimSpace(str) {
+			return typ, true
+		}
+	}
+	return "", false
+}
+
+// HistoryOpts returns the options for the history of the
+// fullscreen UI. If the history size is zero, the history
+// isn't persisted.
+func (x *Flags) HistoryOpts() ([]history.Option, error) {
+	if x.HistorySize <= 0 {
+		return nil, nil
+	}
+
+	path := x.HistoryFile
+	if path == "" {
+		var err error
+		if path, err = history.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return []history.Option{
+		history.WithFile(path),
+		history.WithMaxSize(x.HistorySize),
+	}, nil
+}
+
+// EditorOpts returns the options for the
+// multi-line editor of the fullscreen UI.
+func (x *Flags) EditorOpts() ([]editor.Option, error) {
+	path := x.BufferFile
+	if path == "" {
+		var err error
+		if path, err = editor.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return []editor.Option{editor.WithPath(path)}, nil
+}
+
+// ReadsStdin returns true if a file
+// is read from stdin.
+func (x *Flags) ReadsStdin() bool {
+	for _, path := range x.Files {
+		if path == "-" {
+			return true
+		}
+	}
+	return false
 }
 
 func (x *Flags) Fullscreen() bool {
-	return len(x.Queries) == 0
+	return len(x.Queries) == 0 && len(x.Files) == 0 && !x.REPL
 }
@@ -0,0 +1,317 @@
+// Package complete suggests completions for partially typed queries.
+package complete
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/parser/format"
+)
+
+// DefaultSamples is the number of keys read from a directory
+// to suggest the types of its tuple elements, if WithSamples
+// isn't provided.
+const DefaultSamples = 10
+
+// Msg is returned by the command created by Completer.Complete.
+type Msg struct {
+	// Input & Pos are the input & cursor position
+	// given to Complete. If the input has since
+	// changed, the completion is stale.
+	Input string
+	Pos   int
+
+	Result
+}
+
+// Result describes the completions of the token ending at
+// the cursor. The runes in [Start, Pos) of the input are
+// replaced by one of the Candidates.
+type Result struct {
+	Start      int
+	Candidates []string
+	Err        error
+}
+
+// Prefix returns the longest prefix shared by all the candidates.
+func (x Result) Prefix() string {
+	if len(x.Candidates) == 0 {
+		return ""
+	}
+	prefix := []rune(x.Candidates[0])
+	for _, c := range x.Candidates[1:] {
+		runes := []rune(c)
+		i := 0
+		for i < len(prefix) && i < len(runes) && prefix[i] == runes[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+type Option func(*Completer)
+
+// Completer suggests directory names, keywords, & variable types for
+// the query being typed. Directory listings & sampled keys are read
+// asynchronously & cached for the lifetime of the Completer, which is
+// shared by all of its copies.
+type Completer struct {
+	tr      facade.ReadTransactor
+	samples int
+	cache   *cache
+}
+
+// cache stores the DB reads performed by a Completer.
+// The keys of the maps are directory paths joined by '/'.
+type cache struct {
+	mutex sync.Mutex
+	dirs  map[string][]string
+	types map[string][]keyval.Variable
+}
+
+func New(tr facade.ReadTransactor, opts ...Option) Completer {
+	x := Completer{
+		tr:      tr,
+		samples: DefaultSamples,
+		cache: &cache{
+			dirs:  make(map[string][]string),
+			types: make(map[string][]keyval.Variable),
+		},
+	}
+	for _, option := range opts {
+		option(&x)
+	}
+	return x
+}
+
+// WithSamples sets the number of keys read from a directory to suggest
+// the types of its tuple elements. If zero, types aren't suggested.
+func WithSamples(samples int) Option {
+	return func(x *Completer) {
+		x.samples = samples
+	}
+}
+
+// Complete returns a command which finds the completions of the
+// token ending at the given cursor position. The position is the
+// index of a rune within the input.
+func (x *Completer) Complete(input string, pos int) func() tea.Msg {
+	return func() tea.Msg {
+		runes := []rune(input)
+		if pos > len(runes) {
+			pos = len(runes)
+		}
+		return Msg{
+			Input:  input,
+			Pos:    pos,
+			Result: x.complete(parse(runes[:pos])),
+		}
+	}
+}
+
+// Keywords which may be completed within tuples & values.
+var (
+	tupleKeywords = []string{"nil", "true", "false", "..."}
+	valueKeywords = []string{"nil", "true", "false", "clear"}
+)
+
+func (x *Completer) complete(sc scope) Result {
+	res := Result{Start: sc.start}
+
+	switch sc.kind {
+	case kindVariable:
+		for _, typ := range keyval.AllTypes() {
+			if typ != keyval.AnyType && strings.HasPrefix(string(typ), sc.token) {
+				res.Candidates = append(res.Candidates, string(typ))
+			}
+		}
+
+	case kindDirectory:
+		if sc.path == nil {
+			break
+		}
+		names, err := x.dirList(sc.path)
+		if err != nil {
+			res.Err = err
+			break
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, sc.token) {
+				res.Candidates = append(res.Candidates, formatDirName(name))
+			}
+		}
+
+	case kindTuple, kindValue:
+		if sc.kind == kindTuple && sc.index >= 0 && sc.path != nil && x.samples > 0 {
+			types, err := x.sampleTypes(sc.path)
+			if err != nil {
+				res.Err = err
+				break
+			}
+			if sc.index < len(types) {
+				f := format.New()
+				f.Variable(types[sc.index])
+				if str := f.String(); strings.HasPrefix(str, sc.token) {
+					res.Candidates = append(res.Candidates, str)
+				}
+			}
+		}
+
+		keywords := tupleKeywords
+		if sc.kind == kindValue {
+			keywords = valueKeywords
+		}
+		for _, keyword := range keywords {
+			if strings.HasPrefix(keyword, sc.token) {
+				res.Candidates = append(res.Candidates, keyword)
+			}
+		}
+	}
+
+	return res
+}
+
+// formatDirName formats the name as a directory
+// element, quoting it if necessary.
+func formatDirName(name string) string {
+	f := format.New()
+	f.Directory(keyval.Directory{keyval.String(name)})
+	return strings.TrimPrefix(f.String(), "/")
+}
+
+// dirList returns the names of the directories at the given path. If
+// the path doesn't exist, no names are returned. The result is cached.
+func (x *Completer) dirList(path []string) ([]string, error) {
+	key := strings.Join(path, "/")
+
+	x.cache.mutex.Lock()
+	names, ok := x.cache.dirs[key]
+	x.cache.mutex.Unlock()
+	if ok {
+		return names, nil
+	}
+
+	names, err := x.tr.DirList(path)
+	if err != nil {
+		if !errors.Is(err, directory.ErrDirNotExists) {
+			return nil, errors.Wrap(err, "failed to list directory")
+		}
+		names = nil
+	}
+	sort.Strings(names)
+
+	x.cache.mutex.Lock()
+	x.cache.dirs[key] = names
+	x.cache.mutex.Unlock()
+	return names, nil
+}
+
+// sampleTypes reads the first few keys of the directory at the given
+// path & returns, for each tuple element index, a variable allowing
+// the types found at that index. The result is cached.
+func (x *Completer) sampleTypes(path []string) ([]keyval.Variable, error) {
+	key := strings.Join(path, "/")
+
+	x.cache.mutex.Lock()
+	types, ok := x.cache.types[key]
+	x.cache.mutex.Unlock()
+	if ok {
+		return types, nil
+	}
+
+	dir, err := x.tr.DirOpen(path)
+	if err != nil {
+		if !errors.Is(err, directory.ErrDirNotExists) {
+			return nil, errors.Wrap(err, "failed to open directory")
+		}
+		dir = nil
+	}
+
+	// Partitions can't contain key-values,
+	// so there are no types to sample.
+	if dir != nil && !facade.IsPartition(dir) {
+		out, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			return tr.GetRange(dir, fdb.RangeOptions{Limit: x.samples}).GetSliceWithError()
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to sample keys")
+		}
+		for _, kv := range out.([]fdb.KeyValue) {
+			tup, err := dir.Unpack(kv.Key)
+			if err != nil {
+				// Keys which aren't tuples are skipped.
+				continue
+			}
+			types = addTypes(types, convert.FromFDBTuple(tup))
+		}
+	}
+
+	x.cache.mutex.Lock()
+	x.cache.types[key] = types
+	x.cache.mutex.Unlock()
+	return types, nil
+}
+
+// addTypes adds the types of the tuple's elements
+// to the variables at the corresponding indexes.
+func addTypes(types []keyval.Variable, tup keyval.Tuple) []keyval.Variable {
+	for i, element := range tup {
+		if i == len(types) {
+			types = append(types, keyval.Variable{})
+		}
+		typ, ok := typeOf(element)
+		if !ok {
+			continue
+		}
+		if !hasType(types[i], typ) {
+			types[i] = append(types[i], typ)
+		}
+	}
+	return types
+}
+
+func hasType(variable keyval.Variable, typ keyval.ValueType) bool {
+	for _, t := range variable {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the type of the given element. If the
+// element has no corresponding type, false is returned.
+func typeOf(element keyval.TupElement) (keyval.ValueType, bool) {
+	switch element.(type) {
+	case keyval.Int:
+		return keyval.IntType, true
+	case keyval.Uint:
+		return keyval.UintType, true
+	case keyval.Bool:
+		return keyval.BoolType, true
+	case keyval.Float:
+		return keyval.FloatType, true
+	case keyval.String:
+		return keyval.StringType, true
+	case keyval.Bytes:
+		return keyval.BytesType, true
+	case keyval.UUID:
+		return keyval.UUIDType, true
+	case keyval.Tuple:
+		return keyval.TupleType, true
+	case keyval.VStamp:
+		return keyval.VStampType, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,104 @@
+package complete
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+)
+
+// countingTransactor counts the calls to DirList.
+type countingTransactor struct {
+	facade.ReadTransactor
+	lists int
+}
+
+func (x *countingTransactor) DirList(path []string) ([]string, error) {
+	x.lists++
+	return x.ReadTransactor.DirList(path)
+}
+
+func setup(t *testing.T) *countingTransactor {
+	tr := facade.NewMemTransactor(nil)
+	eg := engine.New(tr)
+
+	dir := func(name string) keyval.Directory {
+		return keyval.Directory{keyval.String("app"), keyval.String("tenants"), keyval.String(name)}
+	}
+	for _, kv := range []keyval.KeyValue{
+		{Key: keyval.Key{Directory: dir("acme"), Tuple: keyval.Tuple{keyval.Int(1), keyval.String("a")}}, Value: keyval.Nil{}},
+		{Key: keyval.Key{Directory: dir("acme"), Tuple: keyval.Tuple{keyval.Int(2), keyval.Float(4.5), keyval.Nil{}}}, Value: keyval.Nil{}},
+		{Key: keyval.Key{Directory: dir("big co"), Tuple: keyval.Tuple{keyval.Int(1)}}, Value: keyval.Nil{}},
+	} {
+		require.NoError(t, eg.Set(kv))
+	}
+
+	_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		return tr.DirCreate([]string{"app", "part"}, []byte(facade.PartitionLayer))
+	})
+	require.NoError(t, err)
+	return &countingTransactor{ReadTransactor: tr}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		start      int
+		candidates []string
+	}{
+		{input: "", candidates: nil},
+		{input: "/", start: 1, candidates: []string{"app"}},
+		{input: "/app/tenants/", start: 13, candidates: []string{"acme", `"big co"`}},
+		{input: "/app/tenants/a", start: 13, candidates: []string{"acme"}},
+		{input: `/app/tenants/"bi`, start: 13, candidates: []string{`"big co"`}},
+		{input: "/app/missing/", start: 13, candidates: nil},
+		{input: "/app/<>/", start: 8, candidates: nil},
+		{input: "/app/tenants/acme(", start: 18, candidates: []string{"<int>", "nil", "true", "false", "..."}},
+		{input: "/app/tenants/acme(1, ", start: 21, candidates: []string{"<string|float>", "nil", "true", "false", "..."}},
+		{input: "/app/tenants/acme(1,2,", start: 22, candidates: []string{"<>", "nil", "true", "false", "..."}},
+		{input: "/app/tenants/acme(1,(", start: 21, candidates: []string{"nil", "true", "false", "..."}},
+		{input: "/app/tenants/acme(1,t", start: 20, candidates: []string{"true"}},
+		{input: `/app/tenants/acme("a,`, candidates: nil},
+		{input: "/app/tenants/acme(1)", candidates: nil},
+		{input: "/app/part(", start: 10, candidates: []string{"nil", "true", "false", "..."}},
+		{input: "/app(<in", start: 6, candidates: []string{"int"}},
+		{input: "/app(<int|u", start: 10, candidates: []string{"uint", "uuid"}},
+		{input: "/app(1)=cl", start: 8, candidates: []string{"clear"}},
+		{input: "0xff", candidates: nil},
+	}
+
+	tr := setup(t)
+	completer := New(tr)
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			msg := completer.Complete(test.input, len([]rune(test.input)))().(Msg)
+			require.NoError(t, msg.Err)
+			require.Equal(t, test.input, msg.Input)
+			require.Equal(t, test.candidates, msg.Candidates)
+			if test.candidates != nil {
+				require.Equal(t, test.start, msg.Start)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	tr := setup(t)
+	completer := New(tr)
+
+	// Copies of the Completer share the cache.
+	other := completer
+	completer.Complete("/app/", 5)()
+	other.Complete("/app/t", 6)()
+	require.Equal(t, 1, tr.lists)
+}
+
+func TestPrefix(t *testing.T) {
+	require.Equal(t, "", Result{}.Prefix())
+	require.Equal(t, "u", Result{Candidates: []string{"uint", "uuid"}}.Prefix())
+	require.Equal(t, "acme", Result{Candidates: []string{"acme"}}.Prefix())
+}
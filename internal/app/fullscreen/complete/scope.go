@@ -0,0 +1,191 @@
+package complete
+
+import "strings"
+
+type kind int
+
+const (
+	kindNone kind = iota
+	kindDirectory
+	kindTuple
+	kindValue
+	kindVariable
+)
+
+// scope describes the part of the query containing the cursor.
+type scope struct {
+	kind kind
+
+	// token is the partially typed text ending at the cursor,
+	// which starts at the rune index start. For directories, the
+	// token excludes the opening quote of a quoted name.
+	token string
+	start int
+
+	// path is the directory of the query. For kindDirectory, it's
+	// the parent of the directory being typed. If the directory
+	// contains variables, path is nil.
+	path []string
+
+	// index is the index of the key's tuple element containing
+	// the cursor. If the cursor is within a nested tuple or
+	// outside the key's tuple, index is -1.
+	index int
+}
+
+// parse determines the scope at the end of the given runes, which are the
+// query up to the cursor. Only the tokens relevant to completion are
+// tracked, so the runes may contain syntax errors.
+func parse(in []rune) scope {
+	if len(in) == 0 || in[0] != '/' {
+		return scope{kind: kindNone}
+	}
+
+	var (
+		section   = kindDirectory
+		depth     = 0
+		index     = -1
+		path      []string
+		validPath = true
+		elemStart = 0
+		token     = 0
+		inString  = false
+		escaped   = false
+		varStart  = -1
+	)
+
+	// endElement adds the directory element ending at i to the path.
+	endElement := func(i int) {
+		if i > elemStart {
+			path = append(path, unquote(string(in[elemStart:i])))
+		}
+	}
+
+	for i, r := range in {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				inString = false
+			}
+			continue
+		}
+
+		if varStart >= 0 {
+			switch r {
+			case '|':
+				varStart = i + 1
+			case '>':
+				varStart = -1
+				token = i + 1
+			}
+			continue
+		}
+
+		switch r {
+		case '"':
+			inString = true
+
+		case '<':
+			varStart = i + 1
+			if section == kindDirectory {
+				validPath = false
+			}
+
+		case '/':
+			if section == kindDirectory {
+				endElement(i)
+				elemStart = i + 1
+			}
+			token = i + 1
+
+		case '(':
+			if section == kindDirectory {
+				endElement(i)
+				section = kindTuple
+			}
+			depth++
+			if section == kindTuple && depth == 1 {
+				index = 0
+			}
+			token = i + 1
+
+		case ')':
+			depth--
+			if section == kindTuple && depth == 0 {
+				index = -1
+			}
+			token = i + 1
+
+		case ',':
+			if section == kindTuple && depth == 1 {
+				index++
+			}
+			token = i + 1
+
+		case '=':
+			if depth == 0 {
+				if section == kindDirectory {
+					endElement(i)
+				}
+				section = kindValue
+				index = -1
+			}
+			token = i + 1
+
+		case ' ', '\t', '\n':
+			token = i + 1
+		}
+	}
+
+	if !validPath {
+		path = nil
+	} else if path == nil {
+		path = []string{}
+	}
+
+	switch {
+	case varStart >= 0:
+		return scope{kind: kindVariable, token: string(in[varStart:]), start: varStart, index: -1}
+
+	case section == kindDirectory:
+		elem := string(in[elemStart:])
+		if inString {
+			elem = unquote(elem)
+		} else if strings.ContainsRune(elem, '"') {
+			return scope{kind: kindNone}
+		}
+		return scope{kind: kindDirectory, token: elem, start: elemStart, path: path, index: -1}
+
+	case inString:
+		return scope{kind: kindNone}
+
+	case section == kindTuple:
+		if depth == 0 {
+			return scope{kind: kindNone}
+		}
+		if depth > 1 {
+			index = -1
+		}
+		return scope{kind: kindTuple, token: string(in[token:]), start: token, path: path, index: index}
+
+	default:
+		return scope{kind: kindValue, token: string(in[token:]), start: token, path: path, index: -1}
+	}
+}
+
+// unquote removes the quotes surrounding a directory
+// element & the escapes within it. The closing quote
+// may be missing if the element is partially typed.
+func unquote(elem string) string {
+	if !strings.HasPrefix(elem, `"`) {
+		return elem
+	}
+	elem = strings.TrimPrefix(elem, `"`)
+	elem = strings.TrimSuffix(elem, `"`)
+	elem = strings.ReplaceAll(elem, `\"`, `"`)
+	return strings.ReplaceAll(elem, `\\`, `\`)
+}
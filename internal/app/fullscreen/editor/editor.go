@@ -0,0 +1,351 @@
+// Package editor provides a multi-line query editor for the
+// fullscreen app. The editor auto-indents tuples, re-flows
+// queries, & saves & loads its buffer to & from a file.
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser"
+	"github.com/janderland/fql/parser/format"
+	"github.com/janderland/fql/parser/scanner"
+)
+
+// indent is inserted once for each
+// tuple enclosing a new line.
+const indent = "  "
+
+// ExecuteMsg is returned when the user presses
+// the key chord which executes the buffer.
+type ExecuteMsg struct {
+	Query string
+}
+
+// LoadMsg replaces the buffer with the given text, re-flowed if
+// it's a valid query. It's returned after the buffer file is read.
+type LoadMsg struct {
+	Text string
+}
+
+type keyMap struct {
+	Execute key.Binding
+	Reflow  key.Binding
+	Save    key.Binding
+	Load    key.Binding
+	Newline key.Binding
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Execute: key.NewBinding(
+			key.WithKeys("alt+enter", "ctrl+g"),
+			key.WithHelp("alt+enter/ctrl+g", "execute"),
+		),
+		Reflow: key.NewBinding(
+			key.WithKeys("ctrl+l"),
+			key.WithHelp("ctrl+l", "re-flow"),
+		),
+		Save: key.NewBinding(
+			key.WithKeys("ctrl+s"),
+			key.WithHelp("ctrl+s", "save"),
+		),
+		Load: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "load"),
+		),
+		Newline: key.NewBinding(
+			key.WithKeys("enter", "ctrl+m"),
+		),
+	}
+}
+
+type Option func(*Model)
+
+type Model struct {
+	keyMap   keyMap
+	textarea textarea.Model
+
+	// path is the file which the
+	// buffer is saved to & loaded from.
+	path string
+}
+
+func New(opts ...Option) Model {
+	ta := textarea.New()
+	ta.Placeholder = "Query"
+	ta.ShowLineNumbers = false
+	ta.Prompt = ""
+	ta.CharLimit = 0
+
+	x := Model{
+		keyMap:   defaultKeyMap(),
+		textarea: ta,
+	}
+	for _, option := range opts {
+		option(&x)
+	}
+	return x
+}
+
+// WithPath sets the file which the buffer is saved to & loaded from.
+func WithPath(path string) Option {
+	return func(x *Model) {
+		x.path = path
+	}
+}
+
+// DefaultPath returns the path of the buffer
+// file within the user's config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find config directory")
+	}
+	return filepath.Join(dir, "fql", "buffer.fql"), nil
+}
+
+func (x *Model) Focus() tea.Cmd {
+	return x.textarea.Focus()
+}
+
+func (x *Model) Blur() {
+	x.textarea.Blur()
+}
+
+// SetSize sets the width & height of the editor in cells.
+func (x *Model) SetSize(width, height int) {
+	x.textarea.SetWidth(width)
+	x.textarea.SetHeight(height)
+}
+
+func (x *Model) Value() string {
+	return x.textarea.Value()
+}
+
+// SetValue replaces the contents of the buffer.
+func (x *Model) SetValue(str string) {
+	x.textarea.SetValue(str)
+}
+
+func (x Model) View() string {
+	return x.textarea.View()
+}
+
+func (x Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case LoadMsg:
+		x.textarea.SetValue(x.reflow(msg.Text))
+		return x, nil
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, x.keyMap.Execute):
+			query := x.textarea.Value()
+			return x, func() tea.Msg {
+				return ExecuteMsg{Query: query}
+			}
+
+		case key.Matches(msg, x.keyMap.Reflow):
+			query, err := Reflow(x.textarea.Value(), x.textarea.Width())
+			if err != nil {
+				return x, func() tea.Msg {
+					return errors.Wrap(err, "failed to re-flow query")
+				}
+			}
+			x.textarea.SetValue(query)
+			return x, nil
+
+		case key.Matches(msg, x.keyMap.Save):
+			return x, x.save()
+
+		case key.Matches(msg, x.keyMap.Load):
+			return x, x.load()
+
+		case key.Matches(msg, x.keyMap.Newline):
+			// Outside of tuples, the textarea
+			// inserts the new line itself.
+			if n := depth(x.beforeCursor()); n > 0 {
+				x.textarea.InsertString("\n" + strings.Repeat(indent, n))
+				return x, nil
+			}
+
+		case msg.Type == tea.KeyRunes && string(msg.Runes) == ")":
+			// Closing a tuple on an empty line dedents the line.
+			line := x.currentLine()
+			if len(line) >= len(indent) && strings.TrimSpace(line) == "" {
+				for range indent {
+					x.textarea, _ = x.textarea.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+				}
+			}
+
+		case msg.Type == tea.KeyRunes && len(msg.Runes) > 1:
+			// Many runes at once are assumed to be pasted. If the
+			// buffer can be re-flowed afterwards, it is, so the
+			// query's original layout doesn't matter.
+			var cmd tea.Cmd
+			x.textarea, cmd = x.textarea.Update(msg)
+			if query, err := Reflow(x.textarea.Value(), x.textarea.Width()); err == nil {
+				x.textarea.SetValue(query)
+			}
+			return x, cmd
+		}
+	}
+
+	var cmd tea.Cmd
+	x.textarea, cmd = x.textarea.Update(msg)
+	return x, cmd
+}
+
+// reflow re-flows the given query. If the query
+// can't be re-flowed, it's returned unchanged.
+func (x *Model) reflow(query string) string {
+	if out, err := Reflow(query, x.textarea.Width()); err == nil {
+		return out
+	}
+	return query
+}
+
+// save returns a command which writes the buffer to the buffer file.
+func (x *Model) save() tea.Cmd {
+	path, text := x.path, x.textarea.Value()
+	return func() tea.Msg {
+		if path == "" {
+			return errors.New("no buffer file")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return errors.Wrap(err, "failed to create buffer directory")
+		}
+		if err := os.WriteFile(path, []byte(text+"\n"), 0o600); err != nil {
+			return errors.Wrap(err, "failed to save buffer")
+		}
+		return "buffer saved to " + path
+	}
+}
+
+// load returns a command which reads the buffer file.
+func (x *Model) load() tea.Cmd {
+	path := x.path
+	return func() tea.Msg {
+		if path == "" {
+			return errors.New("no buffer file")
+		}
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to load buffer")
+		}
+		return LoadMsg{Text: strings.TrimRight(string(text), "\n")}
+	}
+}
+
+// beforeCursor returns the contents of the buffer before the cursor.
+func (x *Model) beforeCursor() string {
+	lines := strings.Split(x.textarea.Value(), "\n")
+	row := x.textarea.Line()
+	if row >= len(lines) {
+		return x.textarea.Value()
+	}
+	return strings.Join(append(lines[:row:row], x.currentLine()), "\n")
+}
+
+// currentLine returns the contents of the
+// cursor's line which precede the cursor.
+func (x *Model) currentLine() string {
+	lines := strings.Split(x.textarea.Value(), "\n")
+	row := x.textarea.Line()
+	if row >= len(lines) {
+		return ""
+	}
+	info := x.textarea.LineInfo()
+	line := []rune(lines[row])
+	col := info.StartColumn + info.ColumnOffset
+	if col > len(line) {
+		col = len(line)
+	}
+	return string(line[:col])
+}
+
+// depth returns the number of tuples which are left open
+// by the given text. Parentheses within strings are ignored.
+func depth(text string) int {
+	var (
+		n        int
+		inString bool
+		escaped  bool
+	)
+	for _, r := range text {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				inString = false
+			}
+			continue
+		}
+		switch r {
+		case '"':
+			inString = true
+		case '(':
+			n++
+		case ')':
+			if n > 0 {
+				n--
+			}
+		}
+	}
+	return n
+}
+
+// Reflow parses the query & formats it so tuples which would
+// exceed the given width are split across indented lines. If
+// the query can't be parsed, or re-flowing it would lose any
+// of its contents, an error is returned.
+func Reflow(query string, width int) (string, error) {
+	if hasComment(query) {
+		return "", errors.New("re-flowing would remove the comments")
+	}
+	ast, err := parse(query)
+	if err != nil {
+		return "", err
+	}
+	f := format.New(format.WithPrintBytes(), format.WithWidth(width))
+	f.Query(ast)
+
+	// Re-flowing only changes the layout
+	// of the query, never its meaning.
+	if out, err := parse(f.String()); err != nil || !reflect.DeepEqual(ast, out) {
+		return "", errors.New("re-flowing would change the query")
+	}
+	return f.String(), nil
+}
+
+func parse(query string) (keyval.Query, error) {
+	p := parser.New(scanner.New(strings.NewReader(strings.TrimSpace(query))))
+	return p.Parse()
+}
+
+// hasComment returns true if the query contains a comment.
+// If the query can't be scanned, false is returned.
+func hasComment(query string) bool {
+	s := scanner.New(strings.NewReader(query))
+	for {
+		kind, err := s.Scan()
+		if err != nil || kind == scanner.TokenKindEnd {
+			return false
+		}
+		if kind == scanner.TokenKindComment {
+			return true
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package editor
+
+import (
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(opts ...Option) Model {
+	x := New(opts...)
+	x.SetSize(40, 10)
+	x.Focus()
+	return x
+}
+
+func typeKeys(x Model, keys ...tea.KeyMsg) Model {
+	for _, k := range keys {
+		x, _ = x.Update(k)
+	}
+	return x
+}
+
+func runes(str string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(str)}
+}
+
+var enter = tea.KeyMsg{Type: tea.KeyEnter}
+
+func TestAutoIndent(t *testing.T) {
+	x := setup()
+	for _, r := range "/dir(1" {
+		x = typeKeys(x, runes(string(r)))
+	}
+	x = typeKeys(x, runes(","), enter, runes("("), enter, runes("2"), enter, runes(")"), runes(","), enter, runes(")"), runes("="), enter, runes("n"))
+
+	require.Equal(t, "/dir(1,\n  (\n    2\n  ),\n)=\nn", x.Value())
+}
+
+func TestReflow(t *testing.T) {
+	out, err := Reflow("  /dir(1,\n\"two\",   (3))=nil\n", 80)
+	require.NoError(t, err)
+	require.Equal(t, `/dir(1,"two",(3))=nil`, out)
+
+	out, err = Reflow(`/dir(1,"two",(3))=nil`, 10)
+	require.NoError(t, err)
+	require.Equal(t, "/dir(\n  1,\n  \"two\",\n  (3),\n)=nil", out)
+
+	_, err = Reflow("/dir(", 10)
+	require.Error(t, err)
+
+	// Pasting a valid query re-flows it.
+	x := setup()
+	x = typeKeys(x, runes(`/dir(1,  "two")`))
+	require.Equal(t, `/dir(1,"two")`, x.Value())
+}
+
+func TestReflow_RoundTrip(t *testing.T) {
+	// Versionstamps aren't included because
+	// the parser doesn't accept them yet.
+	queries := []string{
+		`/dir(nil,true,false,-12,3.5,0.30000000000000004,1.0e-300,1000000000000000000000.0)=nil`,
+		`/dir("str","with \"quotes\"","%",0xab12,0x)=0x00ff`,
+		`/dir(bcefd2ec-4df5-43b6-8c79-81b70b886af9)=bcefd2ec-4df5-43b6-8c79-81b70b886af9`,
+		`/dir/<>/"with space"(<>,<int|string>,(1,(2,())),...)=<tuple>`,
+		`/dir(1)=("a",1.5,(nil))`,
+		`/dir(1)=clear`,
+		`/old/dir=/new/dir`,
+		`0xff0a(1)=2`,
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			want, err := parse(query)
+			require.NoError(t, err)
+
+			for _, width := range []int{0, 10} {
+				out, err := Reflow(query, width)
+				require.NoError(t, err)
+
+				got, err := parse(out)
+				require.NoError(t, err)
+				require.Equal(t, want, got)
+			}
+		})
+	}
+
+	// Comments would be lost, so queries
+	// containing them aren't re-flowed.
+	_, err := Reflow("/dir(1, % one\n2)", 80)
+	require.Error(t, err)
+
+	x := setup()
+	x = typeKeys(x, runes(`/dir(1,  2) % pasted`))
+	require.Equal(t, `/dir(1,  2) % pasted`, x.Value())
+
+	x, _ = x.Update(LoadMsg{Text: "/dir(\n  1, % one\n)"})
+	require.Equal(t, "/dir(\n  1, % one\n)", x.Value())
+}
+
+func TestExecute(t *testing.T) {
+	x := setup()
+	x.SetValue("/dir(\n  1,\n)")
+
+	_, cmd := x.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	require.Equal(t, ExecuteMsg{Query: "/dir(\n  1,\n)"}, cmd())
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fql", "buffer.fql")
+
+	x := setup(WithPath(path))
+	x.SetValue("/dir(\n  1,\n)")
+
+	_, cmd := x.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	require.Equal(t, "buffer saved to "+path, cmd())
+
+	y := setup(WithPath(path))
+	_, cmd = y.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	msg := cmd()
+	require.Equal(t, LoadMsg{Text: "/dir(\n  1,\n)"}, msg)
+
+	y, _ = y.Update(msg)
+	require.Equal(t, "/dir(1)", y.Value())
+
+	z := setup(WithPath(filepath.Join(t.TempDir(), "missing")))
+	_, cmd = z.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	require.Error(t, cmd().(error))
+}
@@ -13,27 +13,86 @@ func init() {
 	const str = `
 FQL provides an environment for querying and mutating
 data of a Foundation DB cluster. The environment has
-3 modes: input, scroll, & help. The environment starts
-in input mode. 
+8 modes: input, editor, search, scroll, select, detail,
+tree, & help. The environment
+starts in input mode. 
 
 During input mode, the user can type queries into the
 input box at the bottom of the screen. Pressing "enter"
 cancels the currently executing query, clears the on
 screen results, and executes a new query defined by
-the input box. Pressing "up" or "down" scrolls by line.
-Pressing "page up" or "page down" scrolls by page.
-Pressing "escape" switches to scroll mode.
+the input box. Executed queries are saved in the
+history. Pressing "up" or "down" recalls the previous
+or next query from the history. Pressing "tab"
+completes the directory name, keyword, or type being
+typed. If there are several completions, they're
+listed until the next key press. Pressing "page up" or
+"page down" scrolls by page. Pressing "ctrl+x" switches
+to editor mode. Pressing "ctrl+r" switches to search
+mode. Pressing "ctrl+t" switches to tree mode. Pressing
+"escape" switches to scroll mode.
+
+Instead of a query, the command "set" prints the
+transaction options & "set NAME VALUE" changes an
+option for the following queries. The names are
+"timeout", "retry-limit", "max-retry-delay", &
+"priority".
+
+During editor mode, the user can write a query across
+several lines. New lines are indented within tuples.
+Pressing "alt+enter" or "ctrl+g" executes the query.
+Pressing "ctrl+l" re-flows the query to fit the editor.
+Pasted queries are re-flowed automatically, unless they
+contain comments. Pressing
+"ctrl+s" saves the editor's buffer to a file & pressing
+"ctrl+o" loads it. Pressing "escape" switches back to
+input mode.
+
+During search mode, the user can type text to search
+the history for the newest query containing the text.
+Pressing "ctrl+r" finds the next older match. Pressing
+"enter" places the match in the input box. Pressing
+"escape" restores the input box. Both switch back to
+input mode.
 
 During scroll mode, the user can scroll through the
 results of the previously executed query. Pressing
-"up", "down", "page up", or "page down" scrolls as in
-input mode. Pressing "j" or "k" scrolls by line.
+"up" or "down" scrolls by line. Pressing "page up" or
+"page down" scrolls by page. Pressing "j" or "k"
+scrolls by line.
 Pressing "J" or "K" scrolls by item. Pressing "ctrl+d"
-or "ctrl+u" scrolls by half page. Pressing "i"
-switches back to input mode. Pressing "?" switches to
+or "ctrl+u" scrolls by half page. Pressing "e"
+describes how the query in the input box would be
+executed without executing it. Pressing "s" switches
+to select mode. Pressing "t" switches to tree mode. Pressing "i" switches back to input mode. Pressing "?" switches to
 help mode. Pressing "q" quits the application after
 confirmation.
 
+During select mode, one of the results is highlighted.
+Pressing "up" or "down" selects the previous or next
+result. Pressing "j" or "k" does the same. Pressing
+"enter" switches to detail mode. Pressing "escape"
+switches to scroll mode.
+
+During detail mode, the selected key-value is described
+in detail: the directory's path & prefix, the type of
+each tuple element, the packed key & value as hex
+dumps, and the value decoded as each type. Scrolling
+works the same as in scroll mode. Pressing "escape"
+switches back to select mode.
+
+During tree mode, a sidebar lists the directories of
+the DB. Pressing "up" or "down" selects a directory.
+Pressing "right" expands the selected directory,
+listing its subdirectories, & pressing "left"
+collapses it. Pressing "s" toggles between showing the
+number of keys, the size, or nothing next to each
+directory. Pressing "enter" places a query reading the
+selected directory in the input box & switches to
+input mode. Pressing "escape" switches to scroll mode
+while keeping the sidebar open. Pressing "t" closes the
+sidebar & switches to scroll mode.
+
 During help mode, this help screen is displayed.
 Scrolling works the same as in scroll mode. Pressing
 "escape" switches to scroll mode.
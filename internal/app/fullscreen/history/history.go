@@ -0,0 +1,248 @@
+// Package history stores the queries executed by the fullscreen
+// app, allowing them to be recalled & searched.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxSize is the number of queries
+// retained if WithMaxSize isn't provided.
+const DefaultMaxSize = 1000
+
+type Option func(*History)
+
+// History contains the previously executed queries, ordered
+// from oldest to newest. If a file is provided via WithFile,
+// the queries are persisted in the file so that they're
+// available to later sessions.
+type History struct {
+	// path is the file in which the queries are
+	// persisted. If empty, the queries are only
+	// kept in memory.
+	path string
+
+	// maxSize is the max number of queries retained.
+	// The oldest queries are discarded first.
+	maxSize int
+
+	// entries contains the queries,
+	// from oldest to newest.
+	entries []string
+
+	// cursor is the index of the query being
+	// recalled. When equal to len(entries),
+	// no query is being recalled.
+	cursor int
+
+	// draft is the input which was being
+	// edited when the recall began.
+	draft string
+}
+
+func New(opts ...Option) History {
+	x := History{maxSize: DefaultMaxSize}
+	for _, option := range opts {
+		option(&x)
+	}
+	return x
+}
+
+// WithFile persists the queries in the given file.
+func WithFile(path string) Option {
+	return func(x *History) {
+		x.path = path
+	}
+}
+
+// WithMaxSize limits the number of queries retained.
+func WithMaxSize(size int) Option {
+	return func(x *History) {
+		x.maxSize = size
+	}
+}
+
+// DefaultPath returns the path of the history
+// file within the user's config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find config directory")
+	}
+	return filepath.Join(dir, "fql", "history"), nil
+}
+
+// Load reads the queries from the file provided via WithFile.
+// If the file doesn't exist, the history is left empty. Each
+// line of the file contains a JSON encoded query, so queries
+// spanning multiple lines can be stored.
+func (x *History) Load() error {
+	if x.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(x.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to open history file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var query string
+		if err := json.Unmarshal(scanner.Bytes(), &query); err != nil {
+			return errors.Wrapf(err, "failed to parse history entry %d", len(entries)+1)
+		}
+		entries = append(entries, query)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read history file")
+	}
+
+	x.entries = nil
+	for _, query := range entries {
+		x.entries = x.insert(query)
+	}
+	x.cursor = len(x.entries)
+	return nil
+}
+
+// Add appends the query to the history & persists the history.
+// If the query is already in the history, the older copy is
+// removed. Blank queries are ignored. Adding a query ends any
+// recall in progress.
+func (x *History) Add(query string) error {
+	x.cursor = len(x.entries)
+	x.draft = ""
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+
+	x.entries = x.insert(query)
+	x.cursor = len(x.entries)
+	return x.save()
+}
+
+// insert returns a copy of the entries with the query appended
+// and any older copy of the query removed. The oldest entries
+// are dropped to keep the history within its max size.
+func (x *History) insert(query string) []string {
+	entries := make([]string, 0, len(x.entries)+1)
+	for _, entry := range x.entries {
+		if entry != query {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, query)
+
+	if x.maxSize > 0 && len(entries) > x.maxSize {
+		entries = entries[len(entries)-x.maxSize:]
+	}
+	return entries
+}
+
+// save writes the entries to the history file. The entries are written
+// to a temporary file which then replaces the history file, so the
+// history isn't lost if the write fails.
+func (x *History) save() error {
+	if x.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0o700); err != nil {
+		return errors.Wrap(err, "failed to create history directory")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), filepath.Base(x.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create history file")
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	writer := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(writer)
+	for _, entry := range x.entries {
+		if err := enc.Encode(entry); err != nil {
+			_ = tmp.Close()
+			return errors.Wrap(err, "failed to write history file")
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "failed to write history file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write history file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), x.path), "failed to replace history file")
+}
+
+// Len returns the number of queries in the history.
+func (x *History) Len() int {
+	return len(x.entries)
+}
+
+// Get returns the query at the given index. Index
+// 0 is the oldest query in the history.
+func (x *History) Get(i int) string {
+	return x.entries[i]
+}
+
+// Prev recalls the query older than the one currently recalled.
+// The given input is the query being edited. If a recall isn't in
+// progress, the input is saved so Next can restore it. If there
+// isn't an older query, false is returned.
+func (x *History) Prev(input string) (string, bool) {
+	if x.cursor == 0 {
+		return "", false
+	}
+	if x.cursor == len(x.entries) {
+		x.draft = input
+	}
+	x.cursor--
+	return x.entries[x.cursor], true
+}
+
+// Next recalls the query newer than the one currently recalled.
+// After the newest query, the input saved by Prev is returned.
+// If a recall isn't in progress, false is returned.
+func (x *History) Next() (string, bool) {
+	if x.cursor == len(x.entries) {
+		return "", false
+	}
+	x.cursor++
+	if x.cursor == len(x.entries) {
+		return x.draft, true
+	}
+	return x.entries[x.cursor], true
+}
+
+// Search returns the index of the newest query which contains
+// the given term & is older than the query at the given index.
+// To search the entire history, provide Len as the index. If
+// no query matches, false is returned.
+func (x *History) Search(term string, before int) (int, bool) {
+	if before > len(x.entries) {
+		before = len(x.entries)
+	}
+	for i := before - 1; i >= 0; i-- {
+		if strings.Contains(x.entries[i], term) {
+			return i, true
+		}
+	}
+	return 0, false
+}
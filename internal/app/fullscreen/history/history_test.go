@@ -0,0 +1,94 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecall(t *testing.T) {
+	x := New()
+	require.NoError(t, x.Add("/a"))
+	require.NoError(t, x.Add("/b"))
+	require.NoError(t, x.Add("  "))
+
+	_, ok := x.Next()
+	require.False(t, ok)
+
+	query, ok := x.Prev("draft")
+	require.True(t, ok)
+	require.Equal(t, "/b", query)
+
+	query, ok = x.Prev("ignored")
+	require.True(t, ok)
+	require.Equal(t, "/a", query)
+
+	_, ok = x.Prev("ignored")
+	require.False(t, ok)
+
+	query, ok = x.Next()
+	require.True(t, ok)
+	require.Equal(t, "/b", query)
+
+	query, ok = x.Next()
+	require.True(t, ok)
+	require.Equal(t, "draft", query)
+
+	_, ok = x.Next()
+	require.False(t, ok)
+}
+
+func TestDeduplicate(t *testing.T) {
+	x := New(WithMaxSize(3))
+	for _, query := range []string{"/a", "/b", "/a", "/c", "/d"} {
+		require.NoError(t, x.Add(query))
+	}
+
+	var entries []string
+	for i := 0; i < x.Len(); i++ {
+		entries = append(entries, x.Get(i))
+	}
+	require.Equal(t, []string{"/a", "/c", "/d"}, entries)
+}
+
+func TestSearch(t *testing.T) {
+	x := New()
+	for _, query := range []string{"/users(1)", "/orders(1)", "/users(2)"} {
+		require.NoError(t, x.Add(query))
+	}
+
+	i, ok := x.Search("users", x.Len())
+	require.True(t, ok)
+	require.Equal(t, "/users(2)", x.Get(i))
+
+	i, ok = x.Search("users", i)
+	require.True(t, ok)
+	require.Equal(t, "/users(1)", x.Get(i))
+
+	_, ok = x.Search("users", i)
+	require.False(t, ok)
+
+	_, ok = x.Search("missing", x.Len())
+	require.False(t, ok)
+}
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fql", "history")
+
+	x := New(WithFile(path))
+	require.NoError(t, x.Load())
+	require.Equal(t, 0, x.Len())
+
+	require.NoError(t, x.Add("/a"))
+	require.NoError(t, x.Add("/b(\n  1,\n)"))
+
+	y := New(WithFile(path), WithMaxSize(1))
+	require.NoError(t, y.Load())
+	require.Equal(t, 1, y.Len())
+	require.Equal(t, "/b(\n  1,\n)", y.Get(0))
+
+	require.NoError(t, os.WriteFile(path, []byte("bad\n"), 0o600))
+	require.Error(t, y.Load())
+}
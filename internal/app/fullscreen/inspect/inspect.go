@@ -0,0 +1,222 @@
+// Package inspect describes a single key-value in detail,
+// including its raw bytes & every way its value decodes.
+package inspect
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/parser/format"
+)
+
+// Msg is returned by the command created by Inspector.Inspect.
+// If the key-value couldn't be packed, Err is non-nil.
+type Msg struct {
+	Detail Detail
+	Err    error
+}
+
+// Detail describes a key-value.
+type Detail struct {
+	// KeyValue is the key-value being described.
+	KeyValue keyval.KeyValue
+
+	// Prefix is the prefix of the key's
+	// directory or the key's raw prefix.
+	Prefix []byte
+
+	// Key & Value are the bytes of the
+	// key & value, respectively.
+	Key   []byte
+	Value []byte
+
+	// Decoded contains the value decoded
+	// as each of the primitive types.
+	Decoded []Decoded
+}
+
+// Decoded is the result of decoding a value as a single type.
+type Decoded struct {
+	Type  keyval.ValueType
+	Value keyval.Value
+	Err   error
+}
+
+// Inspector packs & decodes key-values using an Engine, so
+// the directory prefixes & byte order match the DB's.
+type Inspector struct {
+	eg engine.Engine
+}
+
+func New(eg engine.Engine) Inspector {
+	return Inspector{eg: eg}
+}
+
+// Inspect returns a command which describes the given key-value.
+// The raw key-value is the one read from the DB. If it's nil, the
+// key-value is packed instead, which may not reproduce the bytes
+// stored in the DB if the value was read as a particular type.
+func (x *Inspector) Inspect(kv keyval.KeyValue, raw *fdb.KeyValue) func() tea.Msg {
+	eg := x.eg
+	return func() tea.Msg {
+		detail, err := inspect(&eg, kv, raw)
+		return Msg{Detail: detail, Err: err}
+	}
+}
+
+func inspect(eg *engine.Engine, kv keyval.KeyValue, raw *fdb.KeyValue) (Detail, error) {
+	var key, value []byte
+	if raw != nil {
+		key, value = raw.Key, raw.Value
+	} else {
+		var err error
+		key, err = eg.EncodeKey(kv.Key)
+		if err != nil {
+			return Detail{}, errors.Wrap(err, "failed to pack key")
+		}
+		value, err = eg.EncodeValue(kv.Value)
+		if err != nil {
+			return Detail{}, errors.Wrap(err, "failed to pack value")
+		}
+	}
+
+	tup, err := convert.ToFDBTuple(kv.Key.Tuple)
+	if err != nil {
+		return Detail{}, errors.Wrap(err, "failed to convert tuple to FDB tuple")
+	}
+	packed := tup.Pack()
+	if len(packed) > len(key) {
+		return Detail{}, errors.New("key is shorter than its tuple")
+	}
+	prefix := key[:len(key)-len(packed)]
+
+	detail := Detail{
+		KeyValue: kv,
+		Prefix:   prefix,
+		Key:      key,
+		Value:    value,
+	}
+	for _, typ := range keyval.AllTypes() {
+		if typ == keyval.AnyType {
+			continue
+		}
+		val, err := eg.DecodeValue(value, keyval.Variable{typ})
+		detail.Decoded = append(detail.Decoded, Decoded{Type: typ, Value: val, Err: err})
+	}
+	return detail, nil
+}
+
+// Sections formats the Detail as human-readable sections of
+// text. Each section may contain several lines. The given
+// format.Format is used to format the key-value & its parts.
+func (x *Detail) Sections(f format.Format) []string {
+	var sections []string
+
+	f.Reset()
+	f.KeyValue(x.KeyValue)
+	sections = append(sections, "key-value: "+f.String())
+
+	f.Reset()
+	f.Directory(x.KeyValue.Key.Directory)
+	sections = append(sections, fmt.Sprintf("directory: %s\nprefix: 0x%s",
+		f.String(), hex.EncodeToString(x.Prefix)))
+
+	var rows [][2]string
+	for _, element := range x.KeyValue.Key.Tuple {
+		f.Reset()
+		f.Tuple(keyval.Tuple{element})
+		str := f.String()
+		rows = append(rows, [2]string{typeName(element), str[1 : len(str)-1]})
+	}
+	if len(rows) == 0 {
+		sections = append(sections, "tuple: empty")
+	} else {
+		sections = append(sections, "tuple:\n"+table(rows, true))
+	}
+
+	sections = append(sections, dump("key", x.Key))
+	sections = append(sections, dump("value", x.Value))
+
+	rows = nil
+	for _, decoded := range x.Decoded {
+		var str string
+		if decoded.Err != nil {
+			str = fmt.Sprintf("ERR! %v", decoded.Err)
+		} else {
+			f.Reset()
+			f.Value(decoded.Value)
+			str = f.String()
+		}
+		rows = append(rows, [2]string{string(decoded.Type), str})
+	}
+	sections = append(sections, "value as:\n"+table(rows, false))
+
+	return sections
+}
+
+// dump formats the bytes as a hex dump with a header.
+func dump(name string, b []byte) string {
+	header := fmt.Sprintf("%s (%d bytes):", name, len(b))
+	if len(b) == 0 {
+		return header + " empty"
+	}
+	lines := strings.Split(strings.TrimSuffix(hex.Dump(b), "\n"), "\n")
+	return header + "\n  " + strings.Join(lines, "\n  ")
+}
+
+// table formats the rows as indented, aligned columns.
+// If indexed is true, each row is prefixed by its index.
+func table(rows [][2]string, indexed bool) string {
+	width := 0
+	for _, row := range rows {
+		if len(row[0]) > width {
+			width = len(row[0])
+		}
+	}
+
+	var lines []string
+	for i, row := range rows {
+		line := fmt.Sprintf("%-*s  %s", width, row[0], row[1])
+		if indexed {
+			line = fmt.Sprintf("%d  %s", i, line)
+		}
+		lines = append(lines, "  "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// typeName returns the name of the element's type.
+func typeName(element keyval.TupElement) string {
+	switch element.(type) {
+	case keyval.Nil:
+		return "nil"
+	case keyval.Int:
+		return string(keyval.IntType)
+	case keyval.Uint:
+		return string(keyval.UintType)
+	case keyval.Bool:
+		return string(keyval.BoolType)
+	case keyval.Float:
+		return string(keyval.FloatType)
+	case keyval.String:
+		return string(keyval.StringType)
+	case keyval.Bytes:
+		return string(keyval.BytesType)
+	case keyval.UUID:
+		return string(keyval.UUIDType)
+	case keyval.Tuple:
+		return string(keyval.TupleType)
+	case keyval.VStamp, keyval.VStampFuture:
+		return string(keyval.VStampType)
+	default:
+		return fmt.Sprintf("%T", element)
+	}
+}
@@ -0,0 +1,91 @@
+package inspect
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/engine/stream"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser/format"
+)
+
+func TestInspect(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+	x := New(eg)
+
+	kv := keyval.KeyValue{
+		Key: keyval.Key{
+			Directory: keyval.Directory{keyval.String("app"), keyval.String("users")},
+			Tuple:     keyval.Tuple{keyval.Int(7), keyval.String("jon"), keyval.Nil{}},
+		},
+		Value: keyval.Int(42),
+	}
+
+	msg := x.Inspect(kv, nil)().(Msg)
+	require.ErrorContains(t, msg.Err, "failed to pack key")
+
+	require.NoError(t, eg.Set(kv))
+	msg = x.Inspect(kv, nil)().(Msg)
+	require.NoError(t, msg.Err)
+
+	detail := msg.Detail
+	require.Equal(t, kv, detail.KeyValue)
+	require.NotEmpty(t, detail.Prefix)
+	require.True(t, strings.HasPrefix(string(detail.Key), string(detail.Prefix)))
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 42}, detail.Value)
+
+	decoded := make(map[keyval.ValueType]Decoded)
+	for _, d := range detail.Decoded {
+		decoded[d.Type] = d
+	}
+	require.NotContains(t, decoded, keyval.AnyType)
+	require.Equal(t, keyval.Int(42), decoded[keyval.IntType].Value)
+	require.Equal(t, keyval.Uint(42), decoded[keyval.UintType].Value)
+	require.Equal(t, keyval.Bytes(detail.Value), decoded[keyval.BytesType].Value)
+	require.Error(t, decoded[keyval.BoolType].Err)
+	require.Error(t, decoded[keyval.UUIDType].Err)
+
+	sections := detail.Sections(format.New(format.WithPrintBytes()))
+	require.Equal(t, `key-value: /app/users(7,"jon",nil)=42`, sections[0])
+	require.True(t, strings.HasPrefix(sections[1], "directory: /app/users\nprefix: 0x"))
+	require.Equal(t, "tuple:\n  0  int     7\n  1  string  \"jon\"\n  2  nil     nil", sections[2])
+	require.True(t, strings.HasPrefix(sections[3], "key ("))
+	require.Equal(t, "value (8 bytes):\n  00000000  00 00 00 00 00 00 00 2a                           |.......*|", sections[4])
+	require.Contains(t, sections[5], "\n  int     42\n")
+	require.Contains(t, sections[5], "\n  bool    ERR! ")
+}
+
+func TestInspect_Raw(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+	x := New(eg)
+
+	dir := keyval.Directory{keyval.String("app")}
+	key := keyval.Key{Directory: dir, Tuple: keyval.Tuple{keyval.Int(1)}}
+	require.NoError(t, eg.Set(keyval.KeyValue{Key: key, Value: keyval.Bytes{0x16, 0x00, 0x01}}))
+
+	// The value is a tuple containing a non-minimal encoding
+	// of the integer 1, which re-encoding wouldn't reproduce.
+	query := keyval.KeyValue{
+		Key:   keyval.Key{Directory: dir, Tuple: keyval.Tuple{keyval.Variable{}}},
+		Value: keyval.Variable{keyval.TupleType},
+	}
+	var results []stream.KeyValErr
+	for res := range eg.ReadRange(context.Background(), query, engine.RangeOpts{}) {
+		require.NoError(t, res.Err)
+		results = append(results, res)
+	}
+	require.Len(t, results, 1)
+
+	msg := x.Inspect(results[0].KV, &results[0].Raw)().(Msg)
+	require.NoError(t, msg.Err)
+	require.Equal(t, results[0].KV, msg.Detail.KeyValue)
+	require.Equal(t, []byte(results[0].Raw.Key), msg.Detail.Key)
+	require.Equal(t, keyval.Tuple{keyval.Int(1)}, msg.Detail.KeyValue.Value)
+	require.Equal(t, []byte{0x16, 0x00, 0x01}, msg.Detail.Value)
+	require.Equal(t, msg.Detail.Key[:len(msg.Detail.Prefix)], msg.Detail.Prefix)
+}
@@ -9,11 +9,9 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/dispatch"
 	"github.com/janderland/fql/internal/app/fullscreen/buffer"
-	"github.com/janderland/fql/keyval"
-	"github.com/janderland/fql/keyval/class"
-	"github.com/janderland/fql/parser"
-	"github.com/janderland/fql/parser/scanner"
 )
 
 type AsyncQueryMsg struct {
@@ -27,7 +25,9 @@ type QueryManager struct {
 	eg         engine.Engine
 	singleOpts engine.SingleOpts
 	rangeOpts  engine.RangeOpts
+	txOpts     facade.TxOpts
 	write      bool
+	dryRun     bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -63,11 +63,38 @@ func WithWrite(write bool) Option {
 	}
 }
 
+// WithDryRun enables dry-run mode. In dry-run mode, write queries
+// don't require writing to be enabled. Instead of performing the
+// writes, the returned message is an []engine.Mutation describing
+// the writes which would have been performed.
+func WithDryRun(dryRun bool) Option {
+	return func(x *QueryManager) {
+		x.dryRun = dryRun
+	}
+}
+
+// WithTxOpts specifies the transaction options the Engine was
+// configured with. The "set" command modifies these options.
+func WithTxOpts(opts facade.TxOpts) Option {
+	return func(x *QueryManager) {
+		x.txOpts = opts
+	}
+}
+
 func (x *QueryManager) Cancel() {
 	x.cancel()
 }
 
+// Query executes the given query. If the string is a "set" command
+// instead of a query, the transaction options are printed or, if a
+// name & value are given, an option is changed for the following
+// queries.
 func (x *QueryManager) Query(str string) func() tea.Msg {
+	if fields := strings.Fields(str); len(fields) > 0 && fields[0] == "set" {
+		msg := x.set(fields[1:])
+		return func() tea.Msg { return msg }
+	}
+
 	// Cancel previous query before starting a new one.
 	x.cancel()
 
@@ -76,63 +103,92 @@ func (x *QueryManager) Query(str string) func() tea.Msg {
 	childCtx, x.cancel = context.WithCancel(x.ctx)
 
 	return func() tea.Msg {
-		p := parser.New(scanner.New(strings.NewReader(str)))
-		query, err := p.Parse()
+		query, err := dispatch.Parse(str)
 		if err != nil {
 			return err
 		}
-
-		if query, ok := query.(keyval.Directory); ok {
-			return AsyncQueryMsg{
-				StartedAt: time.Now(),
-				Buffer:    buffer.New(x.eg.Directories(childCtx, query)),
-			}
+		d, err := dispatch.Classify(query)
+		if err != nil {
+			return err
 		}
 
-		var kv keyval.KeyValue
-		if key, ok := query.(keyval.Key); ok {
-			kv = keyval.KeyValue{Key: key, Value: keyval.Variable{}}
-		} else {
-			kv = query.(keyval.KeyValue)
+		res, err := dispatch.Execute(childCtx, x.eg, d, dispatch.Opts{
+			Write:  x.write,
+			DryRun: x.dryRun,
+			Single: x.singleOpts,
+			Range:  x.rangeOpts,
+		})
+		if err != nil {
+			return err
 		}
 
-		switch c := class.Classify(kv); c {
-		case class.Constant:
-			if !x.write {
-				return errors.New("writing isn't enabled")
-			}
-			if err := x.eg.Set(kv); err != nil {
-				return err
-			}
-			return "key set"
-
-		case class.Clear:
-			if !x.write {
-				return errors.New("writing isn't enabled")
-			}
-			if err := x.eg.Clear(kv); err != nil {
-				return err
-			}
-			return "key cleared"
-
-		case class.ReadSingle:
-			out, err := x.eg.ReadSingle(kv, x.singleOpts)
-			if err != nil {
-				return err
-			}
-			if out == nil {
-				return "no results"
+		switch {
+		case res.Directories != nil:
+			return AsyncQueryMsg{
+				StartedAt: time.Now(),
+				Buffer:    buffer.New(res.Directories),
 			}
-			return *out
 
-		case class.ReadRange:
+		case res.KeyValues != nil:
 			return AsyncQueryMsg{
 				StartedAt: time.Now(),
-				Buffer:    buffer.New(x.eg.ReadRange(childCtx, kv, x.rangeOpts)),
+				Buffer:    buffer.New(res.KeyValues),
 			}
 
+		case res.KeyValue != nil:
+			return *res.KeyValue
+
+		case res.Mutations != nil:
+			return res.Mutations
+
+		case res.Message != "":
+			return res.Message
+
 		default:
-			return errors.Errorf("unexpected query class '%v'", c)
+			return "no results"
+		}
+	}
+}
+
+// set implements the "set" command. The options are changed
+// synchronously so queries started afterwards observe them.
+func (x *QueryManager) set(args []string) tea.Msg {
+	switch len(args) {
+	case 0:
+		return x.txOpts.String()
+	case 2:
+		opts := x.txOpts
+		if err := opts.Set(args[0], args[1]); err != nil {
+			return err
+		}
+		x.txOpts = opts
+		x.eg = x.eg.WithTxOpts(opts)
+		return opts.String()
+	default:
+		return errors.New("expected 'set' or 'set NAME VALUE'")
+	}
+}
+
+// Explain describes how the given query would be executed without
+// executing it. The returned message is an [*engine.Explanation].
+func (x *QueryManager) Explain(str string) func() tea.Msg {
+	// Cancel previous query before starting a new one.
+	x.cancel()
+
+	// Create a new context for the new query.
+	var childCtx context.Context
+	childCtx, x.cancel = context.WithCancel(x.ctx)
+
+	return func() tea.Msg {
+		query, err := dispatch.Parse(str)
+		if err != nil {
+			return err
+		}
+
+		exp, err := x.eg.Explain(childCtx, query, x.rangeOpts)
+		if err != nil {
+			return err
 		}
+		return exp
 	}
 }
@@ -41,6 +41,18 @@ func TestWriteFlag(t *testing.T) {
 			query: "/my/dir(\"hi\",\"there\")=clear",
 			err:   true,
 		},
+		{
+			name:  "move",
+			write: true,
+			query: "/old/dir=/new/dir",
+			err:   false,
+		},
+		{
+			name:  "move error",
+			write: false,
+			query: "/old/dir=/new/dir",
+			err:   true,
+		},
 		{
 			name:  "get nothing",
 			write: false,
@@ -67,3 +79,68 @@ func TestWriteFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		mutations int
+		err       bool
+	}{
+		{
+			name:      "set",
+			query:     "/my/dir(\"hi\",\"there\")=33.9",
+			mutations: 1,
+		},
+		{
+			name:      "clear",
+			query:     "/my/dir(\"hi\",\"there\")=clear",
+			mutations: 1,
+		},
+		{
+			name:  "move",
+			query: "/old/dir=/new/dir",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qm := New(
+				context.Background(),
+				engine.New(facade.NewNilTransactor()),
+				WithDryRun(true))
+
+			out := qm.Query(test.query)()
+			if test.err {
+				require.Implements(t, (*error)(nil), out)
+				return
+			}
+			require.IsType(t, []engine.Mutation{}, out)
+			require.Len(t, out, test.mutations)
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	qm := New(
+		context.Background(),
+		engine.New(facade.NewMemTransactor(nil)),
+		WithWrite(true),
+		WithTxOpts(facade.TxOpts{RetryLimit: 2}))
+
+	out := qm.Query("set")()
+	require.Equal(t, "timeout=0s retry-limit=2 max-retry-delay=0s priority=default", out)
+
+	out = qm.Query("set timeout 1ns")()
+	require.Equal(t, "timeout=1ns retry-limit=2 max-retry-delay=0s priority=default", out)
+
+	// The timeout expires before the set completes.
+	out = qm.Query("/dir(1)=2")()
+	require.Error(t, out.(error))
+
+	for _, cmd := range []string{"set timeout", "set color red", "set timeout a"} {
+		out = qm.Query(cmd)()
+		require.Error(t, out.(error), cmd)
+	}
+}
@@ -13,19 +13,36 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/fullscreen/complete"
+	"github.com/janderland/fql/internal/app/fullscreen/editor"
+	"github.com/janderland/fql/internal/app/fullscreen/history"
+	"github.com/janderland/fql/internal/app/fullscreen/inspect"
 	"github.com/janderland/fql/internal/app/fullscreen/manager"
+	"github.com/janderland/fql/internal/app/fullscreen/tree"
 	"github.com/janderland/fql/parser/format"
 )
 
 type App struct {
-	Engine engine.Engine
-	Format format.Format
-	Log    zerolog.Logger
-	Out    io.Writer
+	Engine  engine.Engine
+	Format  format.Format
+	History history.History
+	Editor  editor.Model
+	Log     zerolog.Logger
+	Out     io.Writer
+
+	// Transactor is used to read the directories
+	// & keys suggested by tab completion.
+	Transactor facade.ReadTransactor
 
 	Write      bool
+	DryRun     bool
 	SingleOpts engine.SingleOpts
 	RangeOpts  engine.RangeOpts
+
+	// TxOpts are the transaction options of Engine.
+	// They're modified by the "set" command.
+	TxOpts facade.TxOpts
 }
 
 func (x *App) Run(ctx context.Context) error {
@@ -48,17 +65,30 @@ func (x *App) Run(ctx context.Context) error {
 			input: lip.NewStyle().
 				Border(lip.RoundedBorder()).
 				Padding(0, 1),
+
+			tree: lip.NewStyle().
+				Border(lip.RoundedBorder()).
+				Padding(0, 1),
 		},
 
 		results: resultsStack,
+		format:  x.Format,
 		input:   input,
+		editor:  x.Editor,
+		history: x.History,
+
+		completer: complete.New(x.Transactor),
+		tree:      tree.New(ctx, x.Engine, x.Transactor),
+		inspector: inspect.New(x.Engine),
 
 		qm: manager.New(
 			ctx,
 			x.Engine,
 			manager.WithSingleOpts(x.SingleOpts),
 			manager.WithRangeOpts(x.RangeOpts),
-			manager.WithWrite(x.Write)),
+			manager.WithWrite(x.Write),
+			manager.WithDryRun(x.DryRun),
+			manager.WithTxOpts(x.TxOpts)),
 	}
 
 	_, err := tea.NewProgram(
@@ -77,11 +107,17 @@ const (
 	modeInput
 	modeHelp
 	modeQuit
+	modeSearch
+	modeEditor
+	modeTree
+	modeSelect
+	modeDetail
 )
 
 type Style struct {
 	results lip.Style
 	input   lip.Style
+	tree    lip.Style
 }
 
 type Model struct {
@@ -90,7 +126,48 @@ type Model struct {
 	log    zerolog.Logger
 
 	style   Style
+	format  format.Format
 	input   textinput.Model
+	editor  editor.Model
 	results stack.ResultsStack
 	qm      manager.QueryManager
+	history history.History
+	search  search
+
+	// size is the latest size of the terminal. It's
+	// used to resize the input area when switching
+	// between the input box & the editor.
+	size tea.WindowSizeMsg
+
+	completer complete.Completer
+
+	// tree is displayed as a sidebar
+	// to the left of the results.
+	tree     tree.Model
+	showTree bool
+
+	inspector inspect.Inspector
+
+	// completing is true while the candidates
+	// of a completion are displayed on top of
+	// the results stack.
+	completing bool
+}
+
+// search is the state of the reverse
+// incremental search of the history.
+type search struct {
+	// term is the text being searched for.
+	term string
+
+	// match is the index of the history
+	// entry matching the term. It's only
+	// valid if found is true.
+	match int
+	found bool
+
+	// input is the content of the input box
+	// when the search began. It's restored if
+	// the search is canceled.
+	input string
 }
@@ -6,11 +6,13 @@ import (
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
+	lip "github.com/charmbracelet/lipgloss"
 	"github.com/janderland/fql/internal/app/fullscreen/results/wrap"
 	"github.com/rs/zerolog"
 	"math"
 	"strings"
 
+	"github.com/janderland/fql/engine/facade"
 	"github.com/janderland/fql/engine/stream"
 	"github.com/janderland/fql/keyval"
 	"github.com/janderland/fql/keyval/convert"
@@ -128,6 +130,10 @@ type Model struct {
 	// allowed for subCursor. This prevents
 	// scrolling past the final page.
 	endSubCursor int
+
+	// selected points at the selected
+	// item. If nil, no item is selected.
+	selected *list.Element
 }
 
 func New(opts ...Option) Model {
@@ -168,6 +174,7 @@ func (x *Model) Reset() {
 	x.list = list.New()
 	x.cursor = nil
 	x.endCursor = nil
+	x.selected = nil
 }
 
 func (x *Model) Height(height int) {
@@ -285,7 +292,14 @@ func (x *Model) render(e *list.Element) []string {
 	res := e.Value.(result)
 	prefix := fmt.Sprintf("%d  ", res.i)
 	indent := strings.Repeat(" ", len(prefix))
-	lines := wrap.Wrap(x.str(res.value), x.wrapWidth-len(prefix))
+
+	// Items may span multiple lines, so each
+	// line is wrapped separately to preserve
+	// the line breaks & indentation.
+	var lines []string
+	for _, line := range strings.Split(x.str(res.value), "\n") {
+		lines = append(lines, wrap.Wrap(line, x.wrapWidth-len(prefix))...)
+	}
 
 	// If spaced is enabled, add an extra blank
 	// line after each item except the newest.
@@ -301,11 +315,16 @@ func (x *Model) render(e *list.Element) []string {
 		} else {
 			line = indent + lines[i]
 		}
+		if e == x.selected {
+			line = selectedStyle.Render(line)
+		}
 		reversed = append(reversed, line)
 	}
 	return reversed
 }
 
+var selectedStyle = lip.NewStyle().Reverse(true)
+
 func (x *Model) str(item any) string {
 	switch val := item.(type) {
 	case error:
@@ -322,6 +341,11 @@ func (x *Model) str(item any) string {
 	case directory.DirectorySubspace:
 		x.format.Reset()
 		x.format.Directory(convert.FromStringArray(val.GetPath()))
+		x.format.DirMeta(format.DirMeta{
+			Prefix:    facade.DirPrefix(val),
+			Layer:     val.GetLayer(),
+			Partition: facade.IsPartition(val),
+		})
 		return x.format.String()
 
 	case stream.KeyValErr:
@@ -381,6 +405,85 @@ func (x *Model) Scroll(msg tea.Msg) {
 	}
 }
 
+// Select moves the selection by one item in response to the
+// keys which scroll by line or item. If no item is selected,
+// the newest visible item is selected. The results are
+// scrolled to keep the selected item visible.
+func (x *Model) Select(msg tea.KeyMsg) {
+	if x.list.Len() == 0 {
+		return
+	}
+
+	switch {
+	case x.selected == nil:
+		x.selected = x.cursor
+		if x.selected == nil {
+			x.selected = x.list.Front()
+		}
+
+	case key.Matches(msg, x.keyMap.UpLine), key.Matches(msg, x.keyMap.UpItem):
+		if older := x.selected.Next(); older != nil {
+			x.selected = older
+		}
+
+	case key.Matches(msg, x.keyMap.DownLine), key.Matches(msg, x.keyMap.DownItem):
+		if newer := x.selected.Prev(); newer != nil {
+			x.selected = newer
+		}
+	}
+
+	x.scrollToSelected()
+}
+
+// Selected returns the value of the selected item.
+// If no item is selected, false is returned.
+func (x *Model) Selected() (any, bool) {
+	if x.selected == nil {
+		return nil, false
+	}
+	return x.selected.Value.(result).value, true
+}
+
+// ClearSelection removes the selection, if any.
+func (x *Model) ClearSelection() {
+	x.selected = nil
+}
+
+// scrollToSelected scrolls the results so the first
+// line of the selected item is visible.
+func (x *Model) scrollToSelected() {
+	cursor := x.cursor
+	if cursor == nil {
+		cursor = x.list.Front()
+	}
+
+	// Newer items have larger indexes. If the selected
+	// item is below the screen, it's placed at the bottom.
+	if x.index(x.selected) >= x.index(cursor) {
+		x.cursor = x.selected
+		x.subCursor = 0
+		return
+	}
+
+	// Otherwise, scroll up until the first line of
+	// the selected item fits within the screen.
+	for cursor != x.selected {
+		lines := len(x.render(cursor)) - x.subCursor
+		for e := cursor.Next(); e != x.selected; e = e.Next() {
+			lines += len(x.render(e))
+		}
+		lines += len(x.render(x.selected))
+		if lines <= x.height || !x.scrollUpItems(1) {
+			return
+		}
+		cursor = x.cursor
+	}
+}
+
+func (x *Model) index(e *list.Element) int {
+	return e.Value.(result).i
+}
+
 func (x *Model) scrollDownItems(n int) bool {
 	log := x.log.With().Int("n", n).Logger()
 	log.Log().Msg("down items")
@@ -6,12 +6,14 @@ import (
 	"testing"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
 	"github.com/janderland/fql/engine/facade"
 	"github.com/janderland/fql/engine/stream"
 	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser/format"
 )
 
 func TestHeight(t *testing.T) {
@@ -54,6 +56,26 @@ func TestWrapWidth(t *testing.T) {
 	require.Equal(t, expected, x.View())
 }
 
+func TestMultiLine(t *testing.T) {
+	x := New(WithFormat(format.New(format.WithWidth(8))))
+	x.Push(keyval.KeyValue{
+		Key:   keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{keyval.Int(1), keyval.Int(2)}},
+		Value: keyval.Nil{},
+	})
+
+	x.WrapWidth(20)
+	x.Height(5)
+
+	// The [1:] gets rid of the leading newline.
+	expected := `
+1  /dir(
+     1,
+     2,
+   )=nil`[1:]
+
+	require.Equal(t, expected, x.View())
+}
+
 func TestReset(t *testing.T) {
 	x := setup()
 	x.Height(50)
@@ -94,6 +116,14 @@ func TestSingleLine(t *testing.T) {
 			dir([]string{"dir"}),
 			"1  /dir",
 		},
+		{
+			layerDir([]string{"dir"}, "partition"),
+			"1  /dir % partition",
+		},
+		{
+			layerDir([]string{"dir"}, "my_layer"),
+			"1  /dir % layer \"my_layer\"",
+		},
 		{
 			stream.KeyValErr{
 				KV: keyval.KeyValue{
@@ -141,6 +171,40 @@ func TestSingleLine(t *testing.T) {
 	}
 }
 
+func TestDirDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    directory.DirectorySubspace
+		expected string
+	}{
+		{
+			name:     "prefix",
+			input:    metaDir([]string{"dir"}, []byte{0x15, 0xa3}, ""),
+			expected: "1  /dir % prefix 0x15a3",
+		},
+		{
+			name:     "prefix & layer",
+			input:    metaDir([]string{"dir"}, []byte{0x15, 0xa3}, "my_layer"),
+			expected: "1  /dir % prefix 0x15a3, layer \"my_layer\"",
+		},
+		{
+			name:     "partition",
+			input:    metaDir([]string{"dir"}, nil, "partition"),
+			expected: "1  /dir % partition",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			x := New(WithFormat(format.New(format.WithDirDetails())))
+			x.Height(1)
+
+			x.Push(test.input)
+			require.Equal(t, test.expected, x.View())
+		})
+	}
+}
+
 func TestSpaced(t *testing.T) {
 	x := New(WithSpaced(true))
 	x.Height(2)
@@ -193,6 +257,54 @@ func TestLineScroll(t *testing.T) {
 	require.Equal(t, "1  # xxx \n   xxx", x.View())
 }
 
+func TestSelect(t *testing.T) {
+	x := setup()
+	x.Height(5)
+
+	up := tea.KeyMsg{Type: tea.KeyUp}
+	down := tea.KeyMsg{Type: tea.KeyDown}
+
+	_, ok := x.Selected()
+	require.False(t, ok)
+
+	// The first key press selects the newest visible item.
+	x.Select(up)
+	val, ok := x.Selected()
+	require.True(t, ok)
+	require.Equal(t, "100", val)
+
+	// Selecting past the top of the screen scrolls up.
+	for i := 0; i < 5; i++ {
+		x.Select(up)
+	}
+	val, _ = x.Selected()
+	require.Equal(t, "95", val)
+	require.True(t, strings.HasPrefix(x.View(), "95  # 95\n"))
+
+	// Selecting past the bottom of the screen scrolls down.
+	x.scrollUpItems(10)
+	x.Select(down)
+	val, _ = x.Selected()
+	require.Equal(t, "96", val)
+	require.True(t, strings.HasSuffix(x.View(), "\n96  # 96"))
+
+	// The selection can't move past the newest item.
+	for i := 0; i < 10; i++ {
+		x.Select(down)
+	}
+	val, _ = x.Selected()
+	require.Equal(t, "100", val)
+
+	x.ClearSelection()
+	_, ok = x.Selected()
+	require.False(t, ok)
+
+	x.Select(up)
+	x.Reset()
+	_, ok = x.Selected()
+	require.False(t, ok)
+}
+
 func setup() Model {
 	x := New()
 	for i := 1; i <= 100; i++ {
@@ -217,3 +329,25 @@ type mockDir struct {
 func (x *mockDir) GetPath() []string {
 	return x.path
 }
+
+func layerDir(path []string, layer string) directory.DirectorySubspace {
+	return metaDir(path, nil, layer)
+}
+
+func metaDir(path []string, prefix []byte, layer string) directory.DirectorySubspace {
+	return &mockMetaDir{mockDir{facade.NewNilDirectorySubspace(), path}, prefix, layer}
+}
+
+type mockMetaDir struct {
+	mockDir
+	prefix []byte
+	layer  string
+}
+
+func (x *mockMetaDir) Bytes() []byte {
+	return x.prefix
+}
+
+func (x *mockMetaDir) GetLayer() []byte {
+	return []byte(x.layer)
+}
@@ -0,0 +1,37 @@
+package fullscreen
+
+import (
+	"strings"
+
+	lip "github.com/charmbracelet/lipgloss"
+
+	"github.com/janderland/fql/parser/format"
+)
+
+// Theme returns the format.Theme used to
+// highlight the key-values in the results.
+func Theme() format.Theme {
+	return format.Theme{
+		Directory: style(lip.NewStyle().Foreground(lip.Color("4"))),
+		String:    style(lip.NewStyle().Foreground(lip.Color("2"))),
+		Number:    style(lip.NewStyle().Foreground(lip.Color("6"))),
+		Bytes:     style(lip.NewStyle().Foreground(lip.Color("5"))),
+		Keyword:   style(lip.NewStyle().Foreground(lip.Color("3"))),
+		Variable:  style(lip.NewStyle().Bold(true)),
+		Comment:   style(lip.NewStyle().Faint(true)),
+	}
+}
+
+// style converts the lipgloss style into a format.Style. Each
+// line is rendered separately because lipgloss pads multi-line
+// strings into a block, which would alter strings containing
+// newlines.
+func style(s lip.Style) format.Style {
+	return func(str string) string {
+		lines := strings.Split(str, "\n")
+		for i, line := range lines {
+			lines[i] = s.Render(line)
+		}
+		return strings.Join(lines, "\n")
+	}
+}
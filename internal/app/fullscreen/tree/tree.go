@@ -0,0 +1,542 @@
+// Package tree provides a collapsible sidebar for the fullscreen
+// app which lists the directories of the DB. Subdirectories are
+// read lazily as the directories are expanded.
+package tree
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	lip "github.com/charmbracelet/lipgloss"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser/format"
+)
+
+// DefaultScanLimit is the max number of keys read from a
+// directory to count its keys & estimate its size, if
+// WithScanLimit isn't provided.
+const DefaultScanLimit = 10000
+
+// Stats determines which statistic is
+// displayed next to each directory.
+type Stats int
+
+const (
+	StatsNone Stats = iota
+	StatsCount
+	StatsSize
+)
+
+// ListMsg contains the subdirectories of the directory at Path.
+type ListMsg struct {
+	Path  []string
+	Names []string
+	Err   error
+}
+
+// StatsMsg contains the number of keys & their total size in bytes
+// for the directory at Path. If the directory contains more keys
+// than the scan limit, Partial is true & the stats are a minimum.
+// If the directory is a partition, Partition is true & no keys are
+// read, since partitions can't contain key-values.
+type StatsMsg struct {
+	Path      []string
+	Keys      int
+	Bytes     int
+	Partial   bool
+	Partition bool
+	Err       error
+}
+
+// SelectMsg is returned when a directory is selected. It contains
+// a query which reads the directory's key-values.
+type SelectMsg struct {
+	Query string
+}
+
+type keyMap struct {
+	Up       key.Binding
+	Down     key.Binding
+	Expand   key.Binding
+	Collapse key.Binding
+	Select   key.Binding
+	Stats    key.Binding
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Up:       key.NewBinding(key.WithKeys("up", "k")),
+		Down:     key.NewBinding(key.WithKeys("down", "j")),
+		Expand:   key.NewBinding(key.WithKeys("right", "l", " ")),
+		Collapse: key.NewBinding(key.WithKeys("left", "h")),
+		Select:   key.NewBinding(key.WithKeys("enter")),
+		Stats:    key.NewBinding(key.WithKeys("s")),
+	}
+}
+
+// node is a directory in the tree. The root node
+// has an empty path & is never displayed.
+type node struct {
+	path     []string
+	expanded bool
+
+	// loaded is true once the subdirectories have been
+	// listed. loading is true while they're being listed.
+	loaded   bool
+	loading  bool
+	children []*node
+	err      error
+
+	stats        *StatsMsg
+	statsLoading bool
+}
+
+// row is a visible node & its depth in the tree.
+type row struct {
+	node  *node
+	depth int
+}
+
+type Option func(*Model)
+
+// Model is the state of the directory tree. The nodes are
+// shared by all the copies of a Model, so the results of
+// asynchronous reads may be applied to any copy.
+type Model struct {
+	ctx    context.Context
+	eg     engine.Engine
+	tr     facade.ReadTransactor
+	keyMap keyMap
+
+	root  *node
+	stats Stats
+	limit int
+
+	// cursor is the index of the selected row &
+	// offset is the index of the first visible row.
+	cursor int
+	offset int
+
+	width  int
+	height int
+}
+
+// New creates a Model which lists directories using the given
+// Engine & reads the keys of directories using the given
+// ReadTransactor. The given context bounds the reads.
+func New(ctx context.Context, eg engine.Engine, tr facade.ReadTransactor, opts ...Option) Model {
+	x := Model{
+		ctx:    ctx,
+		eg:     eg,
+		tr:     tr,
+		keyMap: defaultKeyMap(),
+		root:   &node{expanded: true},
+		limit:  DefaultScanLimit,
+	}
+	for _, option := range opts {
+		option(&x)
+	}
+	return x
+}
+
+// WithScanLimit sets the max number of keys read from a
+// directory to count its keys & estimate its size.
+func WithScanLimit(limit int) Option {
+	return func(x *Model) {
+		x.limit = limit
+	}
+}
+
+// WithStats sets the statistic initially displayed next to each directory.
+func WithStats(stats Stats) Option {
+	return func(x *Model) {
+		x.stats = stats
+	}
+}
+
+// Init returns a command which lists the root directories.
+// It only reads from the DB the first time it's called.
+func (x *Model) Init() tea.Cmd {
+	if x.root.loaded || x.root.loading {
+		return nil
+	}
+	return x.list(x.root)
+}
+
+// SetSize sets the width & height of the tree in cells.
+func (x *Model) SetSize(width, height int) {
+	x.width = width
+	x.height = height
+	x.scroll()
+}
+
+func (x Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case ListMsg:
+		return x.updateList(msg)
+
+	case StatsMsg:
+		if n := x.find(msg.Path); n != nil {
+			n.stats = &msg
+			n.statsLoading = false
+		}
+		return x, nil
+
+	case tea.KeyMsg:
+		return x.updateKey(msg)
+	}
+	return x, nil
+}
+
+func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	rows := x.rows()
+
+	switch {
+	case key.Matches(msg, x.keyMap.Up):
+		if x.cursor > 0 {
+			x.cursor--
+		}
+
+	case key.Matches(msg, x.keyMap.Down):
+		if x.cursor < len(rows)-1 {
+			x.cursor++
+		}
+
+	case key.Matches(msg, x.keyMap.Stats):
+		x.stats = (x.stats + 1) % (StatsSize + 1)
+		var cmds []tea.Cmd
+		for _, r := range rows {
+			cmds = append(cmds, x.loadStats(r.node))
+		}
+		return x, tea.Batch(cmds...)
+
+	case len(rows) == 0:
+		return x, nil
+
+	case key.Matches(msg, x.keyMap.Expand):
+		n := rows[x.cursor].node
+		if n.expanded {
+			break
+		}
+		n.expanded = true
+		if !n.loaded && !n.loading {
+			return x, x.list(n)
+		}
+		return x, x.loadChildStats(n)
+
+	case key.Matches(msg, x.keyMap.Collapse):
+		r := rows[x.cursor]
+		if r.node.expanded {
+			r.node.expanded = false
+			break
+		}
+		// If already collapsed, the parent is selected.
+		for i := x.cursor - 1; i >= 0; i-- {
+			if rows[i].depth < r.depth {
+				x.cursor = i
+				break
+			}
+		}
+
+	case key.Matches(msg, x.keyMap.Select):
+		query := Query(rows[x.cursor].node.path)
+		return x, func() tea.Msg {
+			return SelectMsg{Query: query}
+		}
+	}
+
+	x.scroll()
+	return x, nil
+}
+
+func (x Model) updateList(msg ListMsg) (Model, tea.Cmd) {
+	n := x.find(msg.Path)
+	if n == nil {
+		return x, nil
+	}
+	n.loading = false
+	n.loaded = true
+	n.err = msg.Err
+	n.children = nil
+	for _, name := range msg.Names {
+		path := append(append([]string{}, msg.Path...), name)
+		n.children = append(n.children, &node{path: path})
+	}
+	x.scroll()
+	return x, x.loadChildStats(n)
+}
+
+// list returns a command which lists the subdirectories of the node.
+func (x *Model) list(n *node) tea.Cmd {
+	n.loading = true
+	ctx, eg, path := x.ctx, x.eg, n.path
+
+	return func() tea.Msg {
+		query := make(keyval.Directory, 0, len(path)+1)
+		for _, name := range path {
+			query = append(query, keyval.String(name))
+		}
+		query = append(query, keyval.Variable{})
+
+		msg := ListMsg{Path: path}
+		for dir := range eg.Directories(ctx, query) {
+			if dir.Err != nil {
+				msg.Err = dir.Err
+				continue
+			}
+			subPath := dir.Dir.GetPath()
+			msg.Names = append(msg.Names, subPath[len(subPath)-1])
+		}
+		sort.Strings(msg.Names)
+		return msg
+	}
+}
+
+// loadChildStats returns a command which reads the stats
+// of the node's children, if stats are displayed.
+func (x *Model) loadChildStats(n *node) tea.Cmd {
+	var cmds []tea.Cmd
+	for _, child := range n.children {
+		cmds = append(cmds, x.loadStats(child))
+	}
+	return tea.Batch(cmds...)
+}
+
+// loadStats returns a command which reads the stats of the node, if stats
+// are displayed & the node's stats haven't been read. Otherwise, nil is
+// returned. The stats are read using a single range-read limited by the
+// scan limit, so large directories are only partially counted.
+func (x *Model) loadStats(n *node) tea.Cmd {
+	if x.stats == StatsNone || n.stats != nil || n.statsLoading || len(n.path) == 0 {
+		return nil
+	}
+	n.statsLoading = true
+	tr, path, limit := x.tr, n.path, x.limit
+
+	return func() tea.Msg {
+		msg := StatsMsg{Path: path}
+		_, err := tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			dir, err := tr.DirOpen(path)
+			if err != nil {
+				if errors.Is(err, directory.ErrDirNotExists) {
+					return nil, nil
+				}
+				return nil, errors.Wrap(err, "failed to open directory")
+			}
+			if facade.IsPartition(dir) {
+				msg.Partition = true
+				return nil, nil
+			}
+
+			opts := fdb.RangeOptions{}
+			if limit > 0 {
+				opts.Limit = limit + 1
+			}
+			iter := tr.GetRange(dir, opts).Iterator()
+			for iter.Advance() {
+				kv, err := iter.Get()
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to read key-value")
+				}
+				if limit > 0 && msg.Keys == limit {
+					msg.Partial = true
+					break
+				}
+				msg.Keys++
+				msg.Bytes += len(kv.Key) + len(kv.Value)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			msg.Err = errors.Wrap(err, "failed to read directory stats")
+		}
+		return msg
+	}
+}
+
+// find returns the node with the given path. If the node
+// hasn't been loaded, nil is returned.
+func (x *Model) find(path []string) *node {
+	n := x.root
+	for i := range path {
+		var next *node
+		for _, child := range n.children {
+			if child.path[i] == path[i] {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// rows returns the visible nodes in display order.
+func (x *Model) rows() []row {
+	var rows []row
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		for _, child := range n.children {
+			rows = append(rows, row{node: child, depth: depth})
+			if child.expanded {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(x.root, 0)
+	return rows
+}
+
+// scroll keeps the cursor within the visible rows.
+func (x *Model) scroll() {
+	rows := x.rows()
+	if x.cursor >= len(rows) {
+		x.cursor = len(rows) - 1
+	}
+	if x.cursor < 0 {
+		x.cursor = 0
+	}
+	if x.cursor < x.offset {
+		x.offset = x.cursor
+	}
+	if x.height > 0 && x.cursor >= x.offset+x.height {
+		x.offset = x.cursor - x.height + 1
+	}
+}
+
+func (x Model) View() string {
+	var lines []string
+	switch {
+	case x.root.err != nil:
+		lines = append(lines, fmt.Sprintf("ERR! %v", x.root.err))
+	case !x.root.loaded:
+		lines = append(lines, "loading...")
+	case len(x.root.children) == 0:
+		lines = append(lines, "no directories")
+	}
+
+	for i := range lines {
+		lines[i] = x.truncate(lines[i])
+	}
+
+	rows := x.rows()
+	for i := x.offset; i < len(rows); i++ {
+		if x.height > 0 && len(lines) == x.height {
+			break
+		}
+		line := x.truncate(x.rowView(rows[i]))
+		if i == x.cursor {
+			line = lip.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (x *Model) rowView(r row) string {
+	n := r.node
+
+	marker := "▸ "
+	switch {
+	case n.loaded && len(n.children) == 0:
+		marker = "  "
+	case n.expanded && n.loading:
+		marker = "… "
+	case n.expanded:
+		marker = "▾ "
+	}
+
+	line := strings.Repeat("  ", r.depth) + marker + n.path[len(n.path)-1]
+	if stats := x.statsView(n); stats != "" {
+		line += " " + stats
+	}
+	if n.err != nil {
+		line += " ERR! " + n.err.Error()
+	}
+	return line
+}
+
+// truncate shortens the line to fit the width of the tree.
+func (x *Model) truncate(line string) string {
+	runes := []rune(line)
+	if x.width > 0 && len(runes) > x.width {
+		return string(runes[:x.width-1]) + "…"
+	}
+	return line
+}
+
+func (x *Model) statsView(n *node) string {
+	if x.stats == StatsNone {
+		return ""
+	}
+	if n.stats == nil {
+		if n.statsLoading {
+			return "(…)"
+		}
+		return ""
+	}
+	if n.stats.Err != nil {
+		return "(?)"
+	}
+	if n.stats.Partition {
+		return "(partition)"
+	}
+
+	var plus string
+	if n.stats.Partial {
+		plus = "+"
+	}
+	switch x.stats {
+	case StatsCount:
+		noun := "keys"
+		if n.stats.Keys == 1 && !n.stats.Partial {
+			noun = "key"
+		}
+		return fmt.Sprintf("(%d%s %s)", n.stats.Keys, plus, noun)
+	case StatsSize:
+		return fmt.Sprintf("(%s%s)", byteSize(n.stats.Bytes), plus)
+	default:
+		return ""
+	}
+}
+
+// byteSize formats the number of bytes using binary units.
+func byteSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size := float64(n) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		if size < unit {
+			return fmt.Sprintf("%.1f %s", size, suffix)
+		}
+		size /= unit
+	}
+	return fmt.Sprintf("%.1f TiB", size)
+}
+
+// Query returns a query which reads the
+// key-values of the directory at the path.
+func Query(path []string) string {
+	dir := make(keyval.Directory, 0, len(path))
+	for _, name := range path {
+		dir = append(dir, keyval.String(name))
+	}
+	f := format.New()
+	f.Key(keyval.Key{Directory: dir, Tuple: keyval.Tuple{keyval.MaybeMore{}}})
+	return f.String()
+}
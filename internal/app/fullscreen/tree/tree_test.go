@@ -0,0 +1,152 @@
+package tree
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/keyval"
+)
+
+func setup(t *testing.T, opts ...Option) Model {
+	tr := facade.NewMemTransactor(nil)
+	eg := engine.New(tr)
+
+	dir := func(names ...string) keyval.Directory {
+		var dir keyval.Directory
+		for _, name := range names {
+			dir = append(dir, keyval.String(name))
+		}
+		return dir
+	}
+	for _, kv := range []keyval.KeyValue{
+		{Key: keyval.Key{Directory: dir("app", "users"), Tuple: keyval.Tuple{keyval.Int(1)}}, Value: keyval.String("jon")},
+		{Key: keyval.Key{Directory: dir("app", "users"), Tuple: keyval.Tuple{keyval.Int(2)}}, Value: keyval.String("ann")},
+		{Key: keyval.Key{Directory: dir("app", "users"), Tuple: keyval.Tuple{keyval.Int(3)}}, Value: keyval.String("bob")},
+		{Key: keyval.Key{Directory: dir("app", "orders"), Tuple: keyval.Tuple{keyval.Int(1)}}, Value: keyval.Nil{}},
+		{Key: keyval.Key{Directory: dir("logs"), Tuple: keyval.Tuple{keyval.Int(1)}}, Value: keyval.Nil{}},
+	} {
+		require.NoError(t, eg.Set(kv))
+	}
+
+	x := New(context.Background(), eg, tr, opts...)
+	x = run(x, x.Init())
+	return x
+}
+
+// run executes the command & passes the resulting
+// messages to the model, recursively.
+func run(x Model, cmd tea.Cmd) Model {
+	if cmd == nil {
+		return x
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			x = run(x, c)
+		}
+	default:
+		x, cmd = x.Update(msg)
+		x = run(x, cmd)
+	}
+	return x
+}
+
+func press(x Model, keys ...string) Model {
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		var cmd tea.Cmd
+		x, cmd = x.Update(msg)
+		x = run(x, cmd)
+	}
+	return x
+}
+
+func TestTree(t *testing.T) {
+	x := setup(t)
+	require.Equal(t, "▸ app\n▸ logs", stripReverse(x.View()))
+
+	x = press(x, "l")
+	require.Equal(t, "▾ app\n  ▸ orders\n  ▸ users\n▸ logs", stripReverse(x.View()))
+
+	// Directories without subdirectories have no marker once
+	// expanded. Collapsing a collapsed directory selects its parent.
+	x = press(x, "j", "j", "l")
+	require.Equal(t, "▾ app\n  ▸ orders\n    users\n▸ logs", stripReverse(x.View()))
+	x = press(x, "h", "h")
+	require.Equal(t, 0, x.cursor)
+	x = press(x, "h")
+	require.Equal(t, "▸ app\n▸ logs", stripReverse(x.View()))
+
+	// Re-expanding doesn't list the directory again.
+	x.root.children[0].loaded = true
+	x = press(x, "l")
+	require.Equal(t, "▾ app\n  ▸ orders\n    users\n▸ logs", stripReverse(x.View()))
+}
+
+func TestSelect(t *testing.T) {
+	x := setup(t)
+	x = press(x, "l", "j", "j")
+
+	_, cmd := x.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	require.Equal(t, SelectMsg{Query: "/app/users(...)"}, cmd())
+
+	require.Equal(t, `/"with space"/dir(...)`, Query([]string{"with space", "dir"}))
+}
+
+func TestStats(t *testing.T) {
+	x := setup(t, WithScanLimit(2))
+	x = press(x, "l", "s")
+	require.Equal(t, "▾ app (0 keys)\n  ▸ orders (1 key)\n  ▸ users (2+ keys)\n▸ logs (1 key)", stripReverse(x.View()))
+
+	x = press(x, "s")
+	require.Regexp(t, `^▾ app \(0 B\)\n  ▸ orders \(\d+ B\)\n  ▸ users \(\d+ B\+\)\n▸ logs \(\d+ B\)$`, stripReverse(x.View()))
+
+	x = press(x, "s")
+	require.Equal(t, "▾ app\n  ▸ orders\n  ▸ users\n▸ logs", stripReverse(x.View()))
+}
+
+func TestStats_Partition(t *testing.T) {
+	tr := facade.NewMemTransactor(nil)
+	_, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		return tr.DirCreate([]string{"part"}, []byte(facade.PartitionLayer))
+	})
+	require.NoError(t, err)
+
+	x := New(context.Background(), engine.New(tr), tr)
+	x = run(x, x.Init())
+	x = press(x, "s")
+	require.Equal(t, "▸ part (partition)", stripReverse(x.View()))
+}
+
+func TestSize(t *testing.T) {
+	x := setup(t)
+	x = press(x, "l")
+	x.SetSize(8, 2)
+	x = press(x, "j", "j")
+	require.Equal(t, "  ▸ ord…\n  ▸ use…", stripReverse(x.View()))
+}
+
+func TestByteSize(t *testing.T) {
+	require.Equal(t, "12 B", byteSize(12))
+	require.Equal(t, "1.5 KiB", byteSize(1536))
+	require.Equal(t, "2.0 MiB", byteSize(2<<20))
+}
+
+// stripReverse removes the styling of the selected row.
+func stripReverse(str string) string {
+	return ansi.ReplaceAllString(str, "")
+}
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
@@ -8,8 +8,16 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/pkg/errors"
 
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/stream"
+	"github.com/janderland/fql/internal/app/fullscreen/complete"
+	"github.com/janderland/fql/internal/app/fullscreen/editor"
+	"github.com/janderland/fql/internal/app/fullscreen/inspect"
 	"github.com/janderland/fql/internal/app/fullscreen/manager"
+	"github.com/janderland/fql/internal/app/fullscreen/results"
+	"github.com/janderland/fql/internal/app/fullscreen/tree"
 	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser/format"
 )
 
 func (x Model) Init() tea.Cmd {
@@ -33,6 +41,37 @@ func (x Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case manager.AsyncQueryMsg:
 		return x.updateAsyncQuery(msg)
 
+	case complete.Msg:
+		return x.updateComplete(msg), nil
+
+	case editor.ExecuteMsg:
+		return x.execute(msg.Query)
+
+	case tree.ListMsg, tree.StatsMsg:
+		var cmd tea.Cmd
+		x.tree, cmd = x.tree.Update(msg)
+		return x, cmd
+
+	case tree.SelectMsg:
+		x.mode = modeInput
+		x.setInput(msg.Query)
+		x.input.Focus()
+		return x, textinput.Blink
+
+	case inspect.Msg:
+		return x.updateInspect(msg), nil
+
+	case editor.LoadMsg:
+		var cmd tea.Cmd
+		x.editor, cmd = x.editor.Update(msg)
+		return x, cmd
+
+	case *engine.Explanation:
+		return x.updateExplain(msg)
+
+	case []engine.Mutation:
+		return x.updateDryRun(msg)
+
 	case error, string, keyval.KeyValue:
 		return x.updateSingle(msg)
 
@@ -45,11 +84,13 @@ func (x Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	x.endCompletion()
+
 	switch x.mode {
 	case modeScroll:
 		switch msg.Type {
 		case tea.KeyEnter:
-			return x, x.qm.Query(x.input.Value())
+			return x.query()
 
 		case tea.KeyCtrlC:
 			x.qm.Cancel()
@@ -62,6 +103,17 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 				x.input.Focus()
 				return x, textinput.Blink
 
+			case "e":
+				return x, x.qm.Explain(x.input.Value())
+
+			case "t":
+				return x.openTree()
+
+			case "s":
+				x.mode = modeSelect
+				x.results.Top().Select(msg)
+				return x, nil
+
 			case "?":
 				x.mode = modeHelp
 				x.results.Push(newHelp())
@@ -80,7 +132,7 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 	case modeInput:
 		switch msg.Type {
 		case tea.KeyEnter:
-			return x, x.qm.Query(x.input.Value())
+			return x.query()
 
 		case tea.KeyCtrlC:
 			x.qm.Cancel()
@@ -91,7 +143,34 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 			x.input.Blur()
 			return x, nil
 
-		case tea.KeyUp, tea.KeyDown, tea.KeyPgUp, tea.KeyPgDown:
+		case tea.KeyUp:
+			if query, ok := x.history.Prev(x.input.Value()); ok {
+				x.setInput(query)
+			}
+			return x, nil
+
+		case tea.KeyDown:
+			if query, ok := x.history.Next(); ok {
+				x.setInput(query)
+			}
+			return x, nil
+
+		case tea.KeyCtrlR:
+			x.mode = modeSearch
+			x.search = search{input: x.input.Value()}
+			return x, nil
+
+		case tea.KeyCtrlX:
+			return x.openEditor()
+
+		case tea.KeyCtrlT:
+			x.input.Blur()
+			return x.openTree()
+
+		case tea.KeyTab:
+			return x, x.completer.Complete(x.input.Value(), x.input.Position())
+
+		case tea.KeyPgUp, tea.KeyPgDown:
 			x.results.Top().Scroll(msg)
 		}
 
@@ -99,6 +178,87 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 		x.input, cmd = x.input.Update(msg)
 		return x, cmd
 
+	case modeSearch:
+		return x.updateSearch(msg), nil
+
+	case modeEditor:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			x.qm.Cancel()
+			return x, nil
+
+		case tea.KeyEscape:
+			x.mode = modeInput
+			x.editor.Blur()
+			return x.updateSize(x.size), textinput.Blink
+		}
+
+		var cmd tea.Cmd
+		x.editor, cmd = x.editor.Update(msg)
+		return x, cmd
+
+	case modeTree:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			x.qm.Cancel()
+			return x, nil
+
+		case tea.KeyEscape:
+			x.mode = modeScroll
+			return x, nil
+
+		case tea.KeyRunes:
+			if msg.String() == "t" {
+				x.mode = modeScroll
+				x.showTree = false
+				return x.updateSize(x.size), nil
+			}
+		}
+
+		var cmd tea.Cmd
+		x.tree, cmd = x.tree.Update(msg)
+		return x, cmd
+
+	case modeSelect:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			x.qm.Cancel()
+			return x, nil
+
+		case tea.KeyEscape:
+			x.mode = modeScroll
+			x.results.Top().ClearSelection()
+			return x, nil
+
+		case tea.KeyEnter:
+			return x.inspect()
+
+		case tea.KeyUp, tea.KeyDown:
+			x.results.Top().Select(msg)
+			return x, nil
+
+		case tea.KeyRunes:
+			switch msg.String() {
+			case "j", "k", "J", "K":
+				x.results.Top().Select(msg)
+				return x, nil
+			}
+		}
+
+		x.results.Top().Scroll(msg)
+		return x, nil
+
+	case modeDetail:
+		switch msg.Type {
+		case tea.KeyEscape:
+			x.mode = modeSelect
+			x.results.Pop()
+			return x, nil
+		}
+
+		x.results.Top().Scroll(msg)
+		return x, nil
+
 	case modeHelp:
 		switch msg.Type {
 		case tea.KeyEscape:
@@ -137,6 +297,199 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 	}
 }
 
+// query executes the query in the input
+// box & adds it to the history.
+func (x Model) query() (Model, tea.Cmd) {
+	return x.execute(x.input.Value())
+}
+
+// execute executes the given query & adds it to the
+// history. Multi-line queries are saved on a single
+// line so they can be recalled into the input box.
+func (x Model) execute(query string) (Model, tea.Cmd) {
+	entry := query
+	if line, err := editor.Reflow(query, 0); err == nil {
+		entry = line
+	}
+	if err := x.history.Add(entry); err != nil {
+		x.log.Log().Err(err).Msg("failed to save history")
+	}
+	return x, x.qm.Query(query)
+}
+
+// inspect returns a command which describes the selected result.
+// If the selected result isn't a key-value, an error is displayed
+// in the detail view instead.
+func (x Model) inspect() (Model, tea.Cmd) {
+	val, ok := x.results.Top().Selected()
+	if !ok {
+		return x, nil
+	}
+	switch val := val.(type) {
+	case stream.KeyValErr:
+		if val.Err == nil {
+			return x, x.inspector.Inspect(val.KV, &val.Raw)
+		}
+	case keyval.KeyValue:
+		return x, x.inspector.Inspect(val, nil)
+	}
+	return x.openDetail(errors.New("only key-values can be inspected")), nil
+}
+
+// updateInspect displays the details of the selected result. If
+// the selection was canceled while the details were being read,
+// they're ignored.
+func (x Model) updateInspect(msg inspect.Msg) Model {
+	if x.mode != modeSelect {
+		return x
+	}
+	if msg.Err != nil {
+		return x.openDetail(msg.Err)
+	}
+	var items []any
+	for _, section := range msg.Detail.Sections(format.New(format.WithPrintBytes())) {
+		items = append(items, section)
+	}
+	return x.openDetail(items...)
+}
+
+// openDetail displays the items on top of
+// the results stack & switches to detail mode.
+func (x Model) openDetail(items ...any) Model {
+	detail := results.New(results.WithSpaced(true), results.WithLogger(x.log))
+	for _, item := range items {
+		detail.Push(item)
+	}
+	x.results.Push(detail)
+	x.mode = modeDetail
+	return x
+}
+
+// openTree displays the directory tree, if hidden, & switches to tree
+// mode. The root directories are listed the first time it's opened.
+func (x Model) openTree() (Model, tea.Cmd) {
+	x.mode = modeTree
+	x.showTree = true
+	x = x.updateSize(x.size)
+	return x, x.tree.Init()
+}
+
+// openEditor switches to the multi-line editor. If the
+// editor is empty, it's seeded with the input box.
+func (x Model) openEditor() (Model, tea.Cmd) {
+	x.mode = modeEditor
+	x.input.Blur()
+	x = x.updateSize(x.size)
+	if x.editor.Value() == "" {
+		x.editor, _ = x.editor.Update(editor.LoadMsg{Text: x.input.Value()})
+	}
+	return x, x.editor.Focus()
+}
+
+// setInput replaces the content of the input box
+// & moves the cursor to the end of the content.
+func (x *Model) setInput(query string) {
+	x.input.SetValue(query)
+	x.input.CursorEnd()
+}
+
+// updateSearch handles the key presses during the reverse incremental
+// search of the history. Typing extends the search term & "ctrl+r"
+// finds the next older match. Pressing "enter" places the match in
+// the input box while "escape" restores the original input.
+func (x Model) updateSearch(msg tea.KeyMsg) Model {
+	switch msg.Type {
+	case tea.KeyEnter:
+		if x.search.found {
+			x.setInput(x.history.Get(x.search.match))
+		}
+		x.mode = modeInput
+		return x
+
+	case tea.KeyEscape, tea.KeyCtrlC, tea.KeyCtrlG:
+		x.setInput(x.search.input)
+		x.mode = modeInput
+		return x
+
+	case tea.KeyCtrlR:
+		if x.search.found {
+			if i, ok := x.history.Search(x.search.term, x.search.match); ok {
+				x.search.match = i
+			}
+		}
+		return x
+
+	case tea.KeyBackspace:
+		runes := []rune(x.search.term)
+		if len(runes) == 0 {
+			return x
+		}
+		x.search.term = string(runes[:len(runes)-1])
+		x.search.match, x.search.found = 0, false
+		if x.search.term != "" {
+			x.search.match, x.search.found = x.history.Search(x.search.term, x.history.Len())
+		}
+		return x
+
+	case tea.KeyRunes, tea.KeySpace:
+		// The current match is searched first so
+		// it's kept while it still contains the term.
+		before := x.history.Len()
+		if x.search.found {
+			before = x.search.match + 1
+		}
+		x.search.term += string(msg.Runes)
+		x.search.match, x.search.found = x.history.Search(x.search.term, before)
+		return x
+	}
+	return x
+}
+
+// updateComplete applies the completion to the input box. The longest
+// prefix shared by the candidates is inserted. If there are several
+// candidates, they're displayed on top of the results stack until the
+// next key press. If the input has changed since the completion was
+// requested, the completion is ignored.
+func (x Model) updateComplete(msg complete.Msg) Model {
+	if x.mode != modeInput || msg.Input != x.input.Value() || msg.Pos != x.input.Position() {
+		return x
+	}
+
+	// The typed token is only replaced if the prefix extends
+	// it. For instance, a prefix may be shorter than the token
+	// if one of the candidates is a quoted directory name.
+	runes := []rune(msg.Input)
+	prefix := []rune(msg.Prefix())
+	if len(prefix) > msg.Pos-msg.Start {
+		value := string(runes[:msg.Start]) + string(prefix) + string(runes[msg.Pos:])
+		x.input.SetValue(value)
+		x.input.SetCursor(msg.Start + len(prefix))
+	}
+
+	if msg.Err == nil && len(msg.Candidates) < 2 {
+		return x
+	}
+	list := results.New(results.WithLogger(x.log))
+	if msg.Err != nil {
+		list.Push(msg.Err)
+	}
+	for _, candidate := range msg.Candidates {
+		list.Push(candidate)
+	}
+	x.results.Push(list)
+	x.completing = true
+	return x
+}
+
+// endCompletion removes the candidates of
+// the latest completion, if displayed.
+func (x *Model) endCompletion() {
+	if x.completing {
+		x.results.Pop()
+		x.completing = false
+	}
+}
+
 func (x Model) updateMouse(msg tea.MouseMsg) (Model, tea.Cmd) {
 	var cmd tea.Cmd
 	x.input, cmd = x.input.Update(msg)
@@ -145,6 +498,7 @@ func (x Model) updateMouse(msg tea.MouseMsg) (Model, tea.Cmd) {
 }
 
 func (x Model) updateAsyncQuery(msg manager.AsyncQueryMsg) (Model, tea.Cmd) {
+	x.endCompletion()
 	if x.latest.After(msg.StartedAt) {
 		return x, nil
 	}
@@ -163,7 +517,32 @@ func (x Model) updateAsyncQuery(msg manager.AsyncQueryMsg) (Model, tea.Cmd) {
 	return x, nil
 }
 
+func (x Model) updateExplain(msg *engine.Explanation) (Model, tea.Cmd) {
+	x.endCompletion()
+	x.results.Top().Reset()
+	for _, line := range msg.Lines(x.format) {
+		x.results.Top().Push(line)
+	}
+	return x, nil
+}
+
+func (x Model) updateDryRun(msg []engine.Mutation) (Model, tea.Cmd) {
+	x.endCompletion()
+	x.results.Top().Reset()
+	if len(msg) == 0 {
+		x.results.Top().Push("nothing would be written")
+		return x, nil
+	}
+	for _, m := range msg {
+		for _, line := range m.Lines(x.format) {
+			x.results.Top().Push(line)
+		}
+	}
+	return x, nil
+}
+
 func (x Model) updateSingle(msg any) (Model, tea.Cmd) {
+	x.endCompletion()
 	x.results.Top().Reset()
 	x.results.Top().Push(msg)
 	return x, nil
@@ -172,10 +551,40 @@ func (x Model) updateSingle(msg any) (Model, tea.Cmd) {
 func (x Model) updateSize(msg tea.WindowSizeMsg) Model {
 	const inputLine = 1
 	const cursorChar = 1
-	inputHeight := x.style.input.GetVerticalFrameSize() + inputLine
+	const minEditorLines = 3
+	x.size = msg
+
+	inputLines := inputLine
+	if x.mode == modeEditor {
+		inputLines = msg.Height / 3
+		if inputLines < minEditorLines {
+			inputLines = minEditorLines
+		}
+	}
+	inputHeight := x.style.input.GetVerticalFrameSize() + inputLines
+
+	resultsWidth := msg.Width
+	if x.showTree {
+		const minTreeWidth = 20
+		const maxTreeWidth = 40
+		treeWidth := msg.Width / 4
+		if treeWidth < minTreeWidth {
+			treeWidth = minTreeWidth
+		}
+		if treeWidth > maxTreeWidth {
+			treeWidth = maxTreeWidth
+		}
+		resultsWidth -= treeWidth
+
+		x.style.tree.Height(msg.Height - x.style.tree.GetVerticalBorderSize() - inputHeight)
+		x.style.tree.Width(treeWidth - x.style.tree.GetHorizontalBorderSize())
+		x.tree.SetSize(
+			treeWidth-x.style.tree.GetHorizontalFrameSize(),
+			x.style.tree.GetHeight()-x.style.tree.GetVerticalPadding())
+	}
 
 	x.style.results.Height(msg.Height - x.style.results.GetVerticalFrameSize() - inputHeight)
-	x.style.results.Width(msg.Width - x.style.results.GetHorizontalFrameSize())
+	x.style.results.Width(resultsWidth - x.style.results.GetHorizontalFrameSize())
 
 	x.results.Height(x.style.results.GetHeight() - x.style.results.GetVerticalFrameSize())
 	x.results.WrapWidth(x.style.results.GetWidth() - x.style.results.GetHorizontalFrameSize())
@@ -183,11 +592,17 @@ func (x Model) updateSize(msg tea.WindowSizeMsg) Model {
 	x.input.Width = msg.Width - x.style.input.GetHorizontalFrameSize() - len(x.input.Prompt) - cursorChar - 2
 	x.style.input.Width(msg.Width - x.style.input.GetHorizontalFrameSize())
 
+	x.editor.SetSize(msg.Width-x.style.input.GetHorizontalFrameSize()-x.style.input.GetHorizontalPadding(), inputLines)
+
 	return x
 }
 
 func (x Model) updateBlink(msg any) (Model, tea.Cmd) {
 	var cmd tea.Cmd
+	if x.mode == modeEditor {
+		x.editor, cmd = x.editor.Update(msg)
+		return x, cmd
+	}
 	x.input, cmd = x.input.Update(msg)
 	return x, cmd
 }
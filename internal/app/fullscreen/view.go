@@ -1,11 +1,38 @@
 package fullscreen
 
 import (
+	"fmt"
+
 	lip "github.com/charmbracelet/lipgloss"
 )
 
 func (x Model) View() string {
+	input := x.input.View()
+	switch x.mode {
+	case modeSearch:
+		input = x.searchView()
+	case modeEditor:
+		input = x.editor.View()
+	}
+	results := x.style.results.Render(x.results.Top().View())
+	if x.showTree {
+		results = lip.JoinHorizontal(lip.Top,
+			x.style.tree.Render(x.tree.View()),
+			results)
+	}
 	return lip.JoinVertical(lip.Left,
-		x.style.results.Render(x.results.Top().View()),
-		x.style.input.Render(x.input.View()))
+		results,
+		x.style.input.Render(input))
+}
+
+func (x Model) searchView() string {
+	var match string
+	if x.search.found {
+		match = x.history.Get(x.search.match)
+	}
+	label := "search"
+	if !x.search.found && x.search.term != "" {
+		label = "failed search"
+	}
+	return fmt.Sprintf("(%s)'%s': %s", label, x.search.term, match)
 }
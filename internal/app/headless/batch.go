@@ -0,0 +1,181 @@
+package headless
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/internal/app/script"
+)
+
+type (
+	// batchQuery is a query executed as part of a
+	// transaction. If prefix isn't empty, the errors
+	// caused by the query are prefixed by it.
+	batchQuery struct {
+		str    string
+		prefix string
+	}
+
+	// batcher executes transactions & keeps count of them
+	// so failures can be reported & summarized.
+	batcher struct {
+		app *App
+
+		// number is true if failures are prefixed
+		// by the number of their transaction.
+		number bool
+
+		queries int
+		txs     int
+		failed  int
+	}
+)
+
+// RunTransactions executes each of the given groups of queries in its own
+// transaction, in order. If TxSize is non-zero, groups with more queries
+// are split into several transactions. If more than one transaction is
+// executed, errors are prefixed by the number of the failed transaction
+// & the index of the failed query. If KeepGoing is true, a summary is
+// printed to ErrOut once the transactions are done.
+func (x *App) RunTransactions(ctx context.Context, groups [][]string) error {
+	var txs [][]batchQuery
+	var i int
+	for _, group := range groups {
+		var tx []batchQuery
+		for _, str := range group {
+			i++
+			if x.TxSize > 0 && len(tx) == x.TxSize {
+				txs = append(txs, tx)
+				tx = nil
+			}
+			tx = append(tx, batchQuery{str: str, prefix: fmt.Sprintf("query %d", i)})
+		}
+		if len(tx) > 0 {
+			txs = append(txs, tx)
+		}
+	}
+
+	b := batcher{app: x, number: len(txs) > 1}
+	for _, tx := range txs {
+		if !b.number {
+			for i := range tx {
+				tx[i].prefix = ""
+			}
+		}
+		if err := b.run(ctx, tx, nil); err != nil {
+			return err
+		}
+	}
+	return b.finish()
+}
+
+// RunScripts executes the queries read from the given scripts in order.
+// Queries are executed as soon as they're read, so scripts of any length
+// may be executed. Unless TxSize is greater than one, each query is
+// executed in its own transaction. Errors are prefixed by the position
+// of the failed query &, if TxSize is greater than one, the number of
+// the failed transaction. If KeepGoing is true, a summary is printed to
+// ErrOut once the scripts end.
+func (x *App) RunScripts(ctx context.Context, scripts ...*script.Reader) error {
+	size := x.TxSize
+	if size <= 0 {
+		size = 1
+	}
+
+	b := batcher{app: x, number: size > 1}
+	for _, s := range scripts {
+		for done := false; !done; {
+			var (
+				tx    []batchQuery
+				txErr error
+			)
+
+			for len(tx) < size {
+				query, err := s.Next()
+				if errors.Is(err, io.EOF) {
+					done = true
+					break
+				}
+				if err != nil {
+					var serr *script.Error
+					if !errors.As(err, &serr) {
+						return err
+					}
+					txErr = serr
+					break
+				}
+				tx = append(tx, batchQuery{str: query.Text, prefix: query.Pos.String()})
+			}
+
+			// A syntax error fails its transaction,
+			// so none of the transaction's queries
+			// are executed.
+			if txErr != nil {
+				b.queries++
+			} else if len(tx) == 0 {
+				continue
+			}
+			if err := b.run(ctx, tx, txErr); err != nil {
+				return err
+			}
+		}
+	}
+	return b.finish()
+}
+
+// run executes the given queries in a single transaction. If
+// err isn't nil, the transaction fails without being executed.
+// If KeepGoing is true, failures are reported instead of being
+// returned.
+func (x *batcher) run(ctx context.Context, tx []batchQuery, err error) error {
+	x.txs++
+	x.queries += len(tx)
+
+	if err == nil {
+		_, err = x.app.Engine.Transact(func(eg engine.Engine) (interface{}, error) {
+			for _, query := range tx {
+				if err := x.app.Execute(ctx, eg, query.str); err != nil {
+					if query.prefix != "" {
+						err = errors.Wrap(err, query.prefix)
+					}
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+	}
+	if err == nil {
+		return nil
+	}
+
+	if x.number {
+		err = errors.Wrapf(err, "transaction %d", x.txs)
+	}
+	if !x.app.KeepGoing {
+		return err
+	}
+	x.failed++
+	if _, err := fmt.Fprintln(x.app.ErrOut, err); err != nil {
+		return errors.Wrap(err, "failed to print error")
+	}
+	return nil
+}
+
+// finish prints the summary if KeepGoing is true. If any
+// transactions failed, an error is returned.
+func (x *batcher) finish() error {
+	if x.app.KeepGoing {
+		_, err := fmt.Fprintf(x.app.ErrOut, "%d queries executed in %d transactions, %d failed\n", x.queries, x.txs, x.failed)
+		if err != nil {
+			return errors.Wrap(err, "failed to print summary")
+		}
+	}
+	if x.failed > 0 {
+		return errors.Errorf("%d of %d transactions failed", x.failed, x.txs)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package headless
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -9,12 +10,12 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/dispatch"
+	"github.com/janderland/fql/internal/app/special"
 	q "github.com/janderland/fql/keyval"
-	"github.com/janderland/fql/keyval/class"
 	"github.com/janderland/fql/keyval/convert"
-	"github.com/janderland/fql/parser"
 	"github.com/janderland/fql/parser/format"
-	"github.com/janderland/fql/parser/scanner"
 )
 
 type App struct {
@@ -22,57 +23,44 @@ type App struct {
 	Format format.Format
 	Out    io.Writer
 
+	// ErrOut receives the errors of failed transactions
+	// & the summary printed when KeepGoing is true.
+	ErrOut io.Writer
+
 	Write      bool
+	Explain    bool
+	DryRun     bool
 	SingleOpts engine.SingleOpts
 	RangeOpts  engine.RangeOpts
+
+	// KeepGoing continues executing transactions after one
+	// fails. The failures are reported to ErrOut instead.
+	KeepGoing bool
+
+	// TxSize is the max number of queries executed by a
+	// transaction. Once a transaction contains this many
+	// queries, it's committed & a new one is started. If
+	// zero, the size of transactions isn't limited.
+	TxSize int
+
+	// Stdin provides the content of the stdin reference. If
+	// nil, queries containing the reference fail. StdinBlob
+	// determines whether each line or all of the content is
+	// used as the reference's value.
+	Stdin     io.Reader
+	StdinBlob bool
+
+	stdin     []special.Element
+	stdinRead bool
 }
 
+// Run executes the given queries in order
+// within a single transaction.
 func (x *App) Run(ctx context.Context, queries []string) error {
 	_, err := x.Engine.Transact(func(eg engine.Engine) (interface{}, error) {
 		for _, str := range queries {
-			p := parser.New(scanner.New(strings.NewReader(str)))
-			query, err := p.Parse()
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to parse query")
-			}
-
-			if dir, ok := query.(q.Directory); ok {
-				if err := x.directories(ctx, eg, dir); err != nil {
-					return nil, err
-				}
-				continue
-			}
-
-			var kv q.KeyValue
-			if key, ok := query.(q.Key); ok {
-				kv = q.KeyValue{Key: key, Value: q.Variable{}}
-			} else {
-				kv = query.(q.KeyValue)
-			}
-
-			switch c := class.Classify(kv); c {
-			case class.Constant:
-				if err := x.set(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as set query")
-				}
-
-			case class.Clear:
-				if err := x.clear(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as clear query")
-				}
-
-			case class.ReadSingle:
-				if err := x.singleRead(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as single read query")
-				}
-
-			case class.ReadRange:
-				if err := x.rangeRead(ctx, eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as range read query")
-				}
-
-			default:
-				return nil, errors.Errorf("unexpected query class '%v'", c)
+			if err := x.Execute(ctx, eg, str); err != nil {
+				return nil, err
 			}
 		}
 		return nil, nil
@@ -80,60 +68,185 @@ func (x *App) Run(ctx context.Context, queries []string) error {
 	return err
 }
 
-func (x *App) set(eg engine.Engine, query q.KeyValue) error {
-	if !x.Write {
-		return errors.New("writing isn't enabled")
+// Execute parses the given query & executes it using the given
+// Engine, which may be the Engine passed to an [engine.Engine.Transact]
+// callback. The results are printed to the App's output. If the query
+// contains the special stdin reference, it's executed once for each
+// element read from Stdin.
+func (x *App) Execute(ctx context.Context, eg engine.Engine, str string) error {
+	query, err := special.Parse(str)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse query")
+	}
+
+	if x.Explain {
+		return errors.Wrap(x.explain(ctx, eg, query.Query), "failed to explain query")
+	}
+
+	if len(query.Stdin) == 0 {
+		return x.execute(ctx, eg, query, query.Query)
+	}
+
+	elements, err := x.readStdin()
+	if err != nil {
+		return err
+	}
+	for _, e := range elements {
+		bound, err := query.Bind(e)
+		if err != nil {
+			return errors.Wrap(err, "failed to bind stdin")
+		}
+		if err := x.execute(ctx, eg, query, bound); err != nil {
+			return err
+		}
 	}
-	return eg.Set(query)
+	return nil
 }
 
-func (x *App) clear(eg engine.Engine, query q.KeyValue) error {
-	if !x.Write {
-		return errors.New("writing isn't enabled")
+// execute executes the given query. The special query
+// determines how the results are printed.
+func (x *App) execute(ctx context.Context, eg engine.Engine, sq special.Query, query q.Query) error {
+	d, err := dispatch.Classify(query)
+	if err != nil {
+		return err
+	}
+
+	res, err := dispatch.Execute(ctx, eg, d, dispatch.Opts{
+		Write:  x.Write,
+		DryRun: x.DryRun,
+		Single: x.SingleOpts,
+		Range:  x.RangeOpts,
+	})
+	if err != nil {
+		return err
 	}
-	return eg.Clear(query)
+
+	switch {
+	case res.Directories != nil:
+		return x.directories(res)
+
+	case res.KeyValues != nil:
+		return errors.Wrapf(x.keyValues(sq, res), "failed to execute as %s query", d.Kind)
+
+	case res.KeyValue != nil:
+		return x.printKeyValue(sq, *res.KeyValue)
+
+	default:
+		return x.printMutations(res)
+	}
+}
+
+// readStdin reads the elements which replace the stdin reference.
+// Each line of Stdin is a string element or, if StdinBlob is true,
+// all of Stdin is a single bytes element. Stdin can only be read
+// once, so the elements are kept for later queries & retries.
+func (x *App) readStdin() ([]special.Element, error) {
+	if x.stdinRead {
+		return x.stdin, nil
+	}
+	if x.Stdin == nil {
+		return nil, errors.New("stdin isn't available")
+	}
+
+	if x.StdinBlob {
+		blob, err := io.ReadAll(x.Stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read stdin")
+		}
+		x.stdin = []special.Element{q.Bytes(blob)}
+		x.stdinRead = true
+		return x.stdin, nil
+	}
+
+	in := bufio.NewReader(x.Stdin)
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.Wrap(err, "failed to read stdin")
+		}
+		if line != "" {
+			x.stdin = append(x.stdin, q.String(strings.TrimRight(line, "\r\n")))
+		}
+		if err != nil {
+			break
+		}
+	}
+	x.stdinRead = true
+	return x.stdin, nil
 }
 
-func (x *App) singleRead(eg engine.Engine, query q.KeyValue) error {
-	kv, err := eg.ReadSingle(query, x.SingleOpts)
+func (x *App) explain(ctx context.Context, eg engine.Engine, query q.Query) error {
+	exp, err := eg.Explain(ctx, query, x.RangeOpts)
 	if err != nil {
 		return err
 	}
-	if kv == nil {
-		return nil
+	for _, line := range exp.Lines(x.Format) {
+		if _, err := fmt.Fprintln(x.Out, line); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
 	}
+	return nil
+}
 
-	x.Format.Reset()
-	x.Format.KeyValue(*kv)
-	if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
-		return errors.Wrap(err, "failed to print output")
+// printMutations prints the mutations which would have been performed
+// by a write query in dry-run mode. Otherwise, nothing is printed.
+func (x *App) printMutations(res dispatch.Result) error {
+	for _, m := range res.Mutations {
+		for _, line := range m.Lines(x.Format) {
+			if _, err := fmt.Fprintln(x.Out, line); err != nil {
+				return errors.Wrap(err, "failed to print output")
+			}
+		}
 	}
 	return nil
 }
 
-func (x *App) rangeRead(ctx context.Context, eg engine.Engine, query q.KeyValue) error {
-	for kv := range eg.ReadRange(ctx, query, x.RangeOpts) {
+func (x *App) keyValues(sq special.Query, res dispatch.Result) error {
+	for kv := range res.KeyValues {
 		if kv.Err != nil {
 			return kv.Err
 		}
+		if err := x.printKeyValue(sq, kv.KV); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		x.Format.Reset()
-		x.Format.KeyValue(kv.KV)
-		if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
-			return errors.Wrap(err, "failed to print output")
+// printKeyValue prints the given key-value or, if the query
+// contains stdout variables, the raw values they matched.
+func (x *App) printKeyValue(sq special.Query, kv q.KeyValue) error {
+	var str string
+	if len(sq.Stdout) > 0 {
+		var err error
+		if str, err = sq.Print(kv); err != nil {
+			return err
 		}
+	} else {
+		x.Format.Reset()
+		x.Format.KeyValue(kv)
+		str = x.Format.String()
+	}
+
+	if _, err := fmt.Fprintln(x.Out, str); err != nil {
+		return errors.Wrap(err, "failed to print output")
 	}
 	return nil
 }
 
-func (x *App) directories(ctx context.Context, eg engine.Engine, query q.Directory) error {
-	for dir := range eg.Directories(ctx, query) {
+func (x *App) directories(res dispatch.Result) error {
+	for dir := range res.Directories {
 		if dir.Err != nil {
 			return dir.Err
 		}
 
 		x.Format.Reset()
 		x.Format.Directory(convert.FromStringArray(dir.Dir.GetPath()))
+		x.Format.DirMeta(format.DirMeta{
+			Prefix:    facade.DirPrefix(dir.Dir),
+			Layer:     dir.Dir.GetLayer(),
+			Partition: facade.IsPartition(dir.Dir),
+		})
 		if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
 			return errors.Wrap(err, "failed to print output")
 		}
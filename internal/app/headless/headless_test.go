@@ -2,7 +2,9 @@ package headless
 
 import (
 	"context"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -11,12 +13,16 @@ import (
 
 	"github.com/janderland/fql/engine"
 	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/script"
+	"github.com/janderland/fql/parser/format"
 )
 
 func TestHeadless_Query(t *testing.T) {
 	tests := []struct {
 		name    string
 		write   bool
+		explain bool
+		dryRun  bool
 		queries []string
 		err     bool
 	}{
@@ -44,6 +50,46 @@ func TestHeadless_Query(t *testing.T) {
 			queries: []string{"/my/dir(\"hi\",\"there\")=clear"},
 			err:     true,
 		},
+		{
+			name:    "move",
+			write:   true,
+			queries: []string{"/old/dir=/new/dir"},
+			err:     false,
+		},
+		{
+			name:    "move error",
+			write:   false,
+			queries: []string{"/old/dir=/new/dir"},
+			err:     true,
+		},
+		{
+			name:    "explain",
+			write:   false,
+			explain: true,
+			queries: []string{"/my/dir(\"hi\",\"there\")=33.9", "/my/dir(<>,...)=<int>"},
+			err:     false,
+		},
+		{
+			name:    "explain invalid",
+			write:   false,
+			explain: true,
+			queries: []string{"/my/dir(<>)=clear"},
+			err:     true,
+		},
+		{
+			name:    "dry run",
+			write:   false,
+			dryRun:  true,
+			queries: []string{"/my/dir(\"hi\",\"there\")=33.9", "/my/dir(\"hi\")=clear"},
+			err:     false,
+		},
+		{
+			name:    "dry run move",
+			write:   true,
+			dryRun:  true,
+			queries: []string{"/old/dir=/new/dir"},
+			err:     true,
+		},
 		{
 			name:    "get nothing",
 			write:   false,
@@ -56,6 +102,8 @@ func TestHeadless_Query(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			testEnv(t, func(app App) {
 				app.Write = test.write
+				app.Explain = test.explain
+				app.DryRun = test.dryRun
 
 				err := app.Run(context.Background(), test.queries)
 				if test.err {
@@ -68,6 +116,144 @@ func TestHeadless_Query(t *testing.T) {
 	}
 }
 
+func TestHeadless_RunScripts(t *testing.T) {
+	const script1 = `/dir(1)="a"
+/dir)
+/dir(2)="b"`
+	const script2 = `/dir(<int>)=<string>`
+
+	t.Run("stop", func(t *testing.T) {
+		var out, errOut strings.Builder
+		app := newApp(&out, &errOut)
+
+		err := app.RunScripts(context.Background(),
+			script.NewReader("1.fql", strings.NewReader(script1)),
+			script.NewReader("2.fql", strings.NewReader(script2)))
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "1.fql:2:5: "), err.Error())
+		require.Empty(t, out.String())
+		require.Empty(t, errOut.String())
+	})
+
+	t.Run("keep going", func(t *testing.T) {
+		var out, errOut strings.Builder
+		app := newApp(&out, &errOut)
+		app.KeepGoing = true
+
+		err := app.RunScripts(context.Background(),
+			script.NewReader("1.fql", strings.NewReader(script1)),
+			script.NewReader("2.fql", strings.NewReader(script2)))
+		require.EqualError(t, err, "1 of 4 transactions failed")
+		require.Equal(t, "/dir(1)=\"a\"\n/dir(2)=\"b\"\n", out.String())
+
+		lines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+		require.True(t, strings.HasPrefix(lines[0], "1.fql:2:5: "), lines[0])
+		require.Equal(t, "4 queries executed in 4 transactions, 1 failed", lines[len(lines)-1])
+	})
+}
+
+func TestHeadless_RunTransactions(t *testing.T) {
+	t.Run("boundaries", func(t *testing.T) {
+		var out, errOut strings.Builder
+		app := newApp(&out, &errOut)
+
+		// The second transaction fails, so its first
+		// query isn't committed. The first transaction
+		// was already committed.
+		err := app.RunTransactions(context.Background(), [][]string{
+			{`/dir(1)="a"`},
+			{`/dir(2)="b"`, `/dir)`},
+			{`/dir(3)="c"`},
+		})
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "transaction 2: query 3: "), err.Error())
+
+		require.NoError(t, app.RunTransactions(context.Background(), [][]string{{`/dir(<int>)=<string>`}}))
+		require.Equal(t, "/dir(1)=\"a\"\n", out.String())
+	})
+
+	t.Run("keep going", func(t *testing.T) {
+		var out, errOut strings.Builder
+		app := newApp(&out, &errOut)
+		app.KeepGoing = true
+		app.TxSize = 2
+
+		err := app.RunTransactions(context.Background(), [][]string{
+			{`/dir(1)="a"`, `/dir(2)="b"`, `/dir)`},
+			{`/dir(4)="d"`},
+		})
+		require.EqualError(t, err, "1 of 3 transactions failed")
+
+		lines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+		require.True(t, strings.HasPrefix(lines[0], "transaction 2: query 3: "), lines[0])
+		require.Equal(t, "4 queries executed in 3 transactions, 1 failed", lines[len(lines)-1])
+	})
+
+	t.Run("scripts", func(t *testing.T) {
+		var out, errOut strings.Builder
+		app := newApp(&out, &errOut)
+		app.TxSize = 2
+
+		err := app.RunScripts(context.Background(), script.NewReader("1.fql", strings.NewReader(strings.Join([]string{
+			`/dir(1)="a"`,
+			`/dir(2)="b"`,
+			`/dir(3)="c"`,
+			`/dir)`,
+		}, "\n"))))
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "transaction 2: 1.fql:4:5: "), err.Error())
+
+		require.NoError(t, app.Run(context.Background(), []string{`/dir(<int>)=<string>`}))
+		require.Equal(t, "/dir(1)=\"a\"\n/dir(2)=\"b\"\n", out.String())
+	})
+}
+
+func TestHeadless_Special(t *testing.T) {
+	tests := []struct {
+		name  string
+		blob  bool
+		stdin string
+		write string
+		read  string
+		out   string
+	}{
+		{
+			name:  "lines",
+			stdin: "topicA\ntopicB\n",
+			write: `/mq("topic",:stdin)=nil`,
+			read:  `/mq("topic",<stdout:string>)`,
+			out:   "topicA\ntopicB\n",
+		},
+		{
+			name:  "blob",
+			blob:  true,
+			stdin: "line 1\nline 2\n",
+			write: `/mq("msg")=:stdin`,
+			read:  `/mq(<stdout:string>)=<stdout:>`,
+			out:   "msg\t6c696e6520310a6c696e6520320a\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			app := newApp(&out, nil)
+			app.Stdin = strings.NewReader(test.stdin)
+			app.StdinBlob = test.blob
+
+			require.NoError(t, app.Run(context.Background(), []string{test.write, test.read}))
+			require.Equal(t, test.out, out.String())
+		})
+	}
+
+	t.Run("no stdin", func(t *testing.T) {
+		testEnv(t, func(app App) {
+			app.Write = true
+			require.Error(t, app.Run(context.Background(), []string{`/mq(:stdin)=nil`}))
+		})
+	})
+}
+
 func testEnv(t *testing.T, f func(App)) {
 	writer := zerolog.ConsoleWriter{Out: os.Stdout}
 	writer.FormatLevel = func(_ interface{}) string { return "" }
@@ -79,12 +265,27 @@ func testEnv(t *testing.T, f func(App)) {
 
 	f(App{
 		Engine: engine.New(facade.NewNilTransactor(), engine.Logger(log)),
+		Format: format.New(),
 		Out:    dv,
 	})
 }
 
+// newApp returns an App which writes to an in-memory
+// DB & filters out key-values which don't match.
+func newApp(out, errOut io.Writer) App {
+	return App{
+		Engine:     engine.New(facade.NewMemTransactor(nil)),
+		Format:     format.New(),
+		Out:        out,
+		ErrOut:     errOut,
+		Write:      true,
+		SingleOpts: engine.SingleOpts{Filter: true},
+		RangeOpts:  engine.RangeOpts{Filter: true},
+	}
+}
+
 func devnull(t *testing.T) (*os.File, func()) {
-	devnull, err := os.Open(os.DevNull)
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
 	if err != nil {
 		t.Fatal(errors.Wrap(err, "failed to open devnull"))
 	}
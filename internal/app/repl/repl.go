@@ -0,0 +1,255 @@
+// Package repl implements a line-oriented interactive mode which reads
+// queries from its input & prints their results. Unlike the fullscreen
+// app, it doesn't require a terminal, so it works over plain pipes.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/dispatch"
+	"github.com/janderland/fql/internal/app/headless"
+	"github.com/janderland/fql/parser"
+)
+
+const (
+	prompt     = "fql> "
+	contPrompt = "...> "
+	txPrompt   = "fql*> "
+)
+
+const help = `Enter a query to execute it. A query may span multiple lines, such
+as a tuple with an element on each line. The following commands are
+also available:
+
+  begin      start a transaction
+  commit     execute the queries entered since 'begin' in one transaction
+  rollback   discard the queries entered since 'begin'
+  history    list the queries entered during this session
+  set        print the transaction options
+  set N V    change the transaction option N to V for the following
+             queries: timeout, retry-limit, max-retry-delay, or priority
+  !N         execute the Nth query listed by 'history'
+  help       print this message
+  exit       exit the REPL
+
+Because FDB limits transactions to 5 seconds, the queries of a transaction
+are executed together once 'commit' is entered.`
+
+// App reads queries from In, one at a time, & executes them using Exec.
+// Unless a transaction was started with the "begin" command, each query
+// is executed in its own transaction.
+type App struct {
+	In io.Reader
+
+	// Exec executes the queries & prints their results. The
+	// prompts & errors are also printed to its output.
+	Exec headless.App
+
+	// TxOpts are the transaction options of Exec's Engine.
+	// They're modified by the "set" command.
+	TxOpts facade.TxOpts
+
+	// history contains the queries entered
+	// during the session, in order.
+	history []string
+
+	// tx contains the queries entered since the
+	// "begin" command. If nil, no transaction
+	// has been started.
+	tx []string
+}
+
+// Run reads & executes queries until the input ends or
+// the "exit" command is entered.
+func (x *App) Run(ctx context.Context) error {
+	in := bufio.NewReader(x.In)
+	var buf strings.Builder
+
+	for {
+		switch {
+		case buf.Len() > 0:
+			x.print(contPrompt)
+		case x.tx != nil:
+			x.print(txPrompt)
+		default:
+			x.print(prompt)
+		}
+
+		line, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return errors.Wrap(err, "failed to read input")
+		}
+		eof := err != nil
+		line = strings.TrimRight(line, "\r\n")
+
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		} else {
+			cmd := strings.TrimSpace(line)
+			if cmd == "" {
+				if eof {
+					return x.exit()
+				}
+				continue
+			}
+			done, handled := x.command(ctx, cmd)
+			if done || (handled && eof) {
+				return x.exit()
+			}
+			if handled {
+				continue
+			}
+		}
+		buf.WriteString(line)
+
+		// An empty line ends an incomplete query,
+		// allowing the user to abandon it.
+		if !eof && strings.TrimSpace(line) != "" && incomplete(buf.String()) {
+			continue
+		}
+		query := buf.String()
+		buf.Reset()
+
+		x.history = append(x.history, query)
+		x.query(ctx, query)
+
+		if eof {
+			return x.exit()
+		}
+	}
+}
+
+// command executes the given line if it's a command, in which case
+// handled is true. If the command ends the session, done is true.
+func (x *App) command(ctx context.Context, cmd string) (done bool, handled bool) {
+	switch cmd {
+	case "exit", "quit":
+		return true, true
+
+	case "help":
+		x.println(help)
+
+	case "history":
+		for i, query := range x.history {
+			x.println(fmt.Sprintf("%3d  %s", i+1, strings.ReplaceAll(query, "\n", "\n     ")))
+		}
+
+	case "begin":
+		if x.tx != nil {
+			x.printErr(errors.New("transaction already started"))
+			break
+		}
+		x.tx = []string{}
+
+	case "commit":
+		if x.tx == nil {
+			x.printErr(errors.New("no transaction started"))
+			break
+		}
+		queries := x.tx
+		x.tx = nil
+		if err := x.Exec.Run(ctx, queries); err != nil {
+			x.printErr(errors.Wrap(err, "transaction failed"))
+		}
+
+	case "rollback":
+		if x.tx == nil {
+			x.printErr(errors.New("no transaction started"))
+			break
+		}
+		x.tx = nil
+
+	default:
+		if fields := strings.Fields(cmd); len(fields) > 0 && fields[0] == "set" {
+			x.set(fields[1:])
+			break
+		}
+		if !strings.HasPrefix(cmd, "!") {
+			return false, false
+		}
+		i, err := strconv.Atoi(cmd[1:])
+		if err != nil || i < 1 || i > len(x.history) {
+			x.printErr(errors.Errorf("invalid history index '%s'", cmd[1:]))
+			break
+		}
+		query := x.history[i-1]
+		x.history = append(x.history, query)
+		x.println(query)
+		x.query(ctx, query)
+	}
+	return false, true
+}
+
+// set prints the transaction options or, if a name & value
+// are given, changes an option for the following queries.
+func (x *App) set(args []string) {
+	switch len(args) {
+	case 0:
+		x.println(x.TxOpts.String())
+	case 2:
+		opts := x.TxOpts
+		if err := opts.Set(args[0], args[1]); err != nil {
+			x.printErr(err)
+			return
+		}
+		x.TxOpts = opts
+		x.Exec.Engine = x.Exec.Engine.WithTxOpts(opts)
+	default:
+		x.printErr(errors.New("expected 'set' or 'set NAME VALUE'"))
+	}
+}
+
+// query executes the given query. If a transaction was
+// started, the query is only checked for syntax errors
+// & is executed once the transaction is committed.
+func (x *App) query(ctx context.Context, query string) {
+	if x.tx == nil {
+		if err := x.Exec.Run(ctx, []string{query}); err != nil {
+			x.printErr(err)
+		}
+		return
+	}
+
+	if _, err := dispatch.Parse(query); err != nil {
+		x.printErr(errors.Wrap(err, "failed to parse query"))
+		return
+	}
+	x.tx = append(x.tx, query)
+}
+
+// exit ends the session. If a transaction
+// was started, its queries are discarded.
+func (x *App) exit() error {
+	if x.tx != nil {
+		x.println(fmt.Sprintf("discarding %d uncommitted queries", len(x.tx)))
+	}
+	return nil
+}
+
+// incomplete returns true if the given
+// query is missing its ending.
+func incomplete(query string) bool {
+	_, err := dispatch.Parse(query)
+	var perr *parser.Error
+	return errors.As(err, &perr) && perr.Incomplete()
+}
+
+func (x *App) print(str string) {
+	_, _ = fmt.Fprint(x.Exec.Out, str)
+}
+
+func (x *App) println(str string) {
+	_, _ = fmt.Fprintln(x.Exec.Out, str)
+}
+
+func (x *App) printErr(err error) {
+	x.println(fmt.Sprintf("error: %v", err))
+}
@@ -0,0 +1,142 @@
+package repl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/headless"
+	"github.com/janderland/fql/parser/format"
+)
+
+func run(t *testing.T, eg engine.Engine, input string) []string {
+	var out strings.Builder
+	app := App{
+		In: strings.NewReader(input),
+		Exec: headless.App{
+			Engine:     eg,
+			Format:     format.New(),
+			Out:        &out,
+			Write:      true,
+			SingleOpts: engine.SingleOpts{Filter: true},
+			RangeOpts:  engine.RangeOpts{Filter: true},
+		},
+	}
+	require.NoError(t, app.Run(context.Background()))
+
+	// Prompts are removed so only the output remains.
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		for _, p := range []string{prompt, contPrompt, txPrompt} {
+			line = strings.ReplaceAll(line, p, "")
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestREPL(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+
+	lines := run(t, eg, strings.Join([]string{
+		`/dir(1)="a"`,
+		``,
+		`/dir(`,
+		`  2,`,
+		`)="b"`,
+		`/dir(<int>)=<string>`,
+		`history`,
+		`!3`,
+	}, "\n"))
+	require.Equal(t, []string{
+		`/dir(1)="a"`,
+		`/dir(2)="b"`,
+		`  1  /dir(1)="a"`,
+		`  2  /dir(`,
+		`       2,`,
+		`     )="b"`,
+		`  3  /dir(<int>)=<string>`,
+		`/dir(<int>)=<string>`,
+		`/dir(1)="a"`,
+		`/dir(2)="b"`,
+	}, lines)
+}
+
+func TestREPL_Transaction(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+
+	// The transaction's queries are executed together, so the
+	// read observes the set. The rolled back set isn't executed.
+	lines := run(t, eg, strings.Join([]string{
+		`begin`,
+		`/dir(1)="a"`,
+		`/dir(<int>)=<string>`,
+		`commit`,
+		`begin`,
+		`/dir(2)="b"`,
+		`rollback`,
+		`/dir(<int>)=<string>`,
+		`begin`,
+		`/dir(3)="c"`,
+	}, "\n"))
+	require.Equal(t, []string{
+		`/dir(1)="a"`,
+		`/dir(1)="a"`,
+		`discarding 1 uncommitted queries`,
+	}, lines)
+}
+
+func TestREPL_Errors(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+
+	// Errors are printed & the session continues. An empty
+	// line ends an incomplete query, causing a parse error.
+	// The query after the exit command isn't executed.
+	lines := run(t, eg, strings.Join([]string{
+		`/dir)`,
+		`commit`,
+		`/dir(1,`,
+		``,
+		`!9`,
+		`/dir(1)=2`,
+		`exit`,
+		`/dir(<>)=<>`,
+	}, "\n"))
+	var errs int
+	for _, line := range lines {
+		if strings.HasPrefix(line, "error: ") {
+			errs++
+		}
+	}
+	require.Equal(t, 4, errs)
+
+	// The set was executed before the session exited.
+	lines = run(t, eg, `/dir(1)=<int>`)
+	require.Equal(t, []string{`/dir(1)=2`}, lines)
+}
+
+func TestREPL_Set(t *testing.T) {
+	eg := engine.New(facade.NewMemTransactor(nil))
+
+	// The options apply to the queries which follow.
+	lines := run(t, eg, strings.Join([]string{
+		`set retry-limit 3`,
+		`set priority batch`,
+		`set`,
+		`set priority`,
+		`set color red`,
+		`/dir(1)="a"`,
+		`/dir(<int>)=<string>`,
+	}, "\n"))
+	require.Len(t, lines, 4)
+	require.Equal(t, `timeout=0s retry-limit=3 max-retry-delay=0s priority=batch`, lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "error: "), lines[1])
+	require.True(t, strings.HasPrefix(lines[2], "error: "), lines[2])
+	require.Equal(t, `/dir(1)="a"`, lines[3])
+}
@@ -0,0 +1,173 @@
+// Package script reads the queries of a script, such as a
+// file passed to the '--file' flag. Each query starts on a new
+// line & may span multiple lines. Lines containing only comments
+// or whitespace between queries are skipped.
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/parser"
+	"github.com/janderland/fql/parser/scanner"
+)
+
+type (
+	// Pos is a position within a script. Line &
+	// Column are 1-based. Column counts bytes.
+	Pos struct {
+		Name   string
+		Line   int
+		Column int
+	}
+
+	// Query is a query read from a script. Pos
+	// is the position of the query's first byte.
+	Query struct {
+		Text string
+		Pos  Pos
+	}
+
+	// Error is an error caused by the query at Pos.
+	Error struct {
+		Pos Pos
+		Err error
+	}
+
+	// Reader reads queries from a script.
+	Reader struct {
+		name string
+		in   *bufio.Reader
+
+		// line is the number of lines read.
+		line int
+		eof  bool
+
+		// resync is true if a syntax error occurred
+		// & the next query's start hasn't been found.
+		resync bool
+	}
+)
+
+func (x Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", x.Name, x.Line, x.Column)
+}
+
+func (x *Error) Error() string {
+	return fmt.Sprintf("%v: %v", x.Pos, x.Err)
+}
+
+func (x *Error) Unwrap() error {
+	return x.Err
+}
+
+// NewReader returns a Reader which reads from the given
+// io.Reader. The name is used as the Name of each Pos.
+func NewReader(name string, in io.Reader) *Reader {
+	return &Reader{name: name, in: bufio.NewReader(in)}
+}
+
+// Next returns the next query of the script. If the query has a
+// syntax error, an *Error is returned. The following lines are then
+// skipped until one starts a query by beginning with '/' or '0x', so
+// the remainder of the invalid query doesn't cause more errors. Once
+// the script ends, io.EOF is returned.
+func (x *Reader) Next() (Query, error) {
+	var (
+		buf   strings.Builder
+		start Pos
+	)
+
+	for {
+		if x.eof {
+			return Query{}, io.EOF
+		}
+
+		line, err := x.in.ReadString('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return Query{}, errors.Wrapf(err, "failed to read %s", x.name)
+			}
+			x.eof = true
+		}
+		x.line++
+		line = strings.TrimRight(line, "\r\n")
+
+		if buf.Len() == 0 {
+			if blank(line) {
+				continue
+			}
+			trimmed := strings.TrimSpace(line)
+			if x.resync {
+				if !strings.HasPrefix(trimmed, "/") && !strings.HasPrefix(trimmed, "0x") {
+					continue
+				}
+				x.resync = false
+			}
+			start = Pos{Name: x.name, Line: x.line, Column: 1}
+		} else {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(line)
+
+		err = parse(buf.String())
+		if err == nil {
+			return Query{Text: buf.String(), Pos: start}, nil
+		}
+
+		var perr *parser.Error
+		if errors.As(err, &perr) && perr.Incomplete() && !x.eof {
+			continue
+		}
+
+		x.resync = true
+		pos := start
+		if perr != nil {
+			pos = offsetPos(start, buf.String(), perr.Offset())
+		}
+		return Query{}, &Error{Pos: pos, Err: err}
+	}
+}
+
+// blank returns true if the line only contains whitespace & comments.
+func blank(line string) bool {
+	s := scanner.New(strings.NewReader(line))
+	for {
+		kind, err := s.Scan()
+		if err != nil {
+			return false
+		}
+		switch kind {
+		case scanner.TokenKindEnd:
+			return true
+		case scanner.TokenKindWhitespace, scanner.TokenKindComment:
+			continue
+		default:
+			return false
+		}
+	}
+}
+
+func parse(query string) error {
+	p := parser.New(scanner.New(strings.NewReader(query)))
+	_, err := p.Parse()
+	return err
+}
+
+// offsetPos returns the position of the given byte offset within
+// the query, where start is the position of the query's first byte.
+func offsetPos(start Pos, query string, offset int) Pos {
+	if offset > len(query) {
+		offset = len(query)
+	}
+	before := query[:offset]
+	lines := strings.Count(before, "\n")
+	if lines == 0 {
+		return Pos{Name: start.Name, Line: start.Line, Column: start.Column + offset}
+	}
+	return Pos{Name: start.Name, Line: start.Line + lines, Column: offset - strings.LastIndex(before, "\n")}
+}
@@ -0,0 +1,73 @@
+package script
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, str string) ([]Query, []Pos) {
+	r := NewReader("test.fql", strings.NewReader(str))
+
+	var queries []Query
+	var errs []Pos
+	for {
+		query, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return queries, errs
+		}
+		if err != nil {
+			var serr *Error
+			require.ErrorAs(t, err, &serr)
+			errs = append(errs, serr.Pos)
+			continue
+		}
+		queries = append(queries, query)
+	}
+}
+
+func TestReader(t *testing.T) {
+	queries, errs := readAll(t, strings.Join([]string{
+		`% private account balances`,
+		`/account/private(`,
+		`  <int>,  % group ID`,
+		`  <string>,  % "name"`,
+		`)=<int>   % balance`,
+		``,
+		`/msg("100%")=clear`,
+		`/msg("multi`,
+		`line % string")`,
+		`/dir`,
+	}, "\n"))
+	require.Empty(t, errs)
+	require.Equal(t, []Query{
+		{Text: "/account/private(\n  <int>,  % group ID\n  <string>,  % \"name\"\n)=<int>   % balance", Pos: Pos{Name: "test.fql", Line: 2, Column: 1}},
+		{Text: `/msg("100%")=clear`, Pos: Pos{Name: "test.fql", Line: 7, Column: 1}},
+		{Text: "/msg(\"multi\nline % string\")", Pos: Pos{Name: "test.fql", Line: 8, Column: 1}},
+		{Text: "/dir", Pos: Pos{Name: "test.fql", Line: 10, Column: 1}},
+	}, queries)
+}
+
+func TestReader_Errors(t *testing.T) {
+	queries, errs := readAll(t, strings.Join([]string{
+		`/dir)`,
+		`/dir(`,
+		`  1,`,
+		`  2 3,`,
+		`  4,`,
+		`)=<>`,
+		`/valid`,
+		`/dir(1,`,
+	}, "\n"))
+	require.Equal(t, []Pos{
+		{Name: "test.fql", Line: 1, Column: 5},
+		{Name: "test.fql", Line: 4, Column: 5},
+		{Name: "test.fql", Line: 8, Column: 8},
+	}, errs)
+	require.Equal(t, []Query{{Text: "/valid", Pos: Pos{Name: "test.fql", Line: 7, Column: 1}}}, queries)
+
+	require.Equal(t, "test.fql:4:5: failed", (&Error{Pos: errs[1], Err: errors.New("failed")}).Error())
+}
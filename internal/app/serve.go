@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fql/internal/app/server"
+)
+
+// shutdownTimeout is how long the serve command waits for
+// requests to finish after being interrupted.
+const shutdownTimeout = 10 * time.Second
+
+var Serve = &cobra.Command{
+	Use:   "serve [flags]",
+	Short: "execute queries received over HTTP",
+	Long: `Execute queries received over HTTP.
+
+Queries are executed by POSTing a JSON object to the /query endpoint:
+
+  {"queries": ["/my/dir(\"key\")=<>"], "explain": false, "dryRun": false}
+
+The queries are executed in order within a single transaction. The
+results are streamed back as newline-delimited JSON. If the client
+disconnects, the queries are cancelled & the transaction isn't
+committed. Write queries are rejected unless '--write' is given.
+
+A request may override the transaction options given by the flags:
+
+  {"queries": [...], "txOpts": {"timeout": "5s", "priority": "batch"}}`,
+	Args: cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		log := zerolog.Nop()
+		if flags.Log {
+			log = zerolog.New(zerolog.ConsoleWriter{
+				Out:         os.Stderr,
+				FormatLevel: func(_ interface{}) string { return "" },
+			}).With().Timestamp().Logger()
+		}
+
+		eg, _, closeEngine, err := connect(log)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := closeEngine(); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+		}()
+
+		fmtOpts, err := flags.FormatOpts(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		// The options were validated by connect.
+		txOpts, _ := flags.TxOpts()
+
+		srv := server.Server{
+			Engine:     eg,
+			Log:        log,
+			FormatOpts: fmtOpts,
+
+			Write:      flags.Write,
+			SingleOpts: flags.SingleOpts(),
+			RangeOpts:  flags.RangeOpts(),
+			TxOpts:     txOpts,
+		}
+
+		listener, err := net.Listen("tcp", flags.Addr)
+		if err != nil {
+			return errors.Wrap(err, "failed to listen")
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "serving on http://%s\n", listener.Addr())
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		httpSrv := http.Server{Handler: srv.Handler()}
+		shutdown := make(chan error, 1)
+		go func() {
+			<-ctx.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			shutdown <- httpSrv.Shutdown(ctx)
+		}()
+
+		if err := httpSrv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return errors.Wrap(err, "failed to serve")
+		}
+		return errors.Wrap(<-shutdown, "failed to shutdown")
+	},
+}
+
+// SetupServeFlags defines the flags specific to the serve
+// command. The persistent flags of the root command, such
+// as the cluster file, are inherited by the serve command.
+func SetupServeFlags(cmd *cobra.Command, flags *Flags) {
+	cmd.Flags().StringVar(&flags.Addr, "addr", "localhost:8080", "address to listen on")
+	cmd.Flags().BoolVarP(&flags.Write, "write", "w", false, "allow write queries")
+	cmd.Flags().BoolVarP(&flags.Strict, "strict", "s", false, "throw an error if a KV is read which doesn't match the schema")
+	cmd.Flags().BoolVar(&flags.Details, "details", false, "print the prefix of each directory when listing directories")
+}
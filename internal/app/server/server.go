@@ -0,0 +1,370 @@
+// Package server hosts an engine.Engine behind an HTTP API, allowing
+// clients which don't link the FDB client to execute queries.
+//
+// Queries are executed by POSTing a JSON Request to the /query
+// endpoint. The results are streamed back as newline-delimited JSON
+// (NDJSON), one Result per line.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+	"github.com/janderland/fql/internal/app/dispatch"
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/keyval/convert"
+	"github.com/janderland/fql/parser/format"
+)
+
+// maxRequestSize is the max number of bytes
+// read from the body of a request.
+const maxRequestSize = 1 << 20
+
+type (
+	// Server executes the queries it receives over HTTP. Its
+	// fields must not be modified once it starts serving.
+	Server struct {
+		Engine     engine.Engine
+		Log        zerolog.Logger
+		FormatOpts []format.Option
+
+		// Write allows clients to execute write queries. Dry-run
+		// requests may include write queries regardless.
+		Write      bool
+		SingleOpts engine.SingleOpts
+		RangeOpts  engine.RangeOpts
+
+		// TxOpts configures the transaction of each
+		// request. Requests may override the options.
+		TxOpts facade.TxOpts
+	}
+
+	// Request is the body of a request to the /query endpoint.
+	Request struct {
+		// Queries are executed in order within
+		// a single transaction.
+		Queries []string `json:"queries"`
+
+		// Explain describes how the queries would
+		// execute instead of executing them.
+		Explain bool `json:"explain,omitempty"`
+
+		// DryRun describes the writes which would be
+		// performed by the queries instead of performing
+		// them. Writing doesn't need to be enabled.
+		DryRun bool `json:"dryRun,omitempty"`
+
+		// Reverse & Limit modify range reads as described
+		// by engine.RangeOpts. They override the options
+		// the Server was configured with.
+		Reverse bool `json:"reverse,omitempty"`
+		Limit   int  `json:"limit,omitempty"`
+
+		// TxOpts maps transaction option names to values,
+		// as accepted by facade.TxOpts.Set. They override
+		// the options the Server was configured with.
+		TxOpts map[string]string `json:"txOpts,omitempty"`
+	}
+
+	// Result is a line of the response streamed by the /query endpoint.
+	// Query is the index of the query which produced the result. Only
+	// one of the other fields is set.
+	Result struct {
+		Query int `json:"query"`
+
+		// KeyValue is a key-value read by the query.
+		KeyValue string `json:"kv,omitempty"`
+
+		// Directory is a directory listed by the query.
+		Directory string `json:"dir,omitempty"`
+
+		// Message describes a write performed by the query.
+		Message string `json:"message,omitempty"`
+
+		// Lines describe a mutation of a dry-run request
+		// or how the query of an explain request executes.
+		Lines []string `json:"lines,omitempty"`
+
+		// Error is the reason the query failed. It's only sent if
+		// the query failed after results were sent. The error is
+		// the last line & the transaction isn't committed.
+		Error string `json:"error,omitempty"`
+	}
+
+	// errorBody is the body of a response for a request which failed
+	// before any results were sent. If the request failed because of
+	// a particular query, Query is its index.
+	errorBody struct {
+		Error string `json:"error"`
+		Query *int   `json:"query,omitempty"`
+	}
+
+	// stream sends the results of a request
+	// to the client as they are produced.
+	stream struct {
+		enc     *json.Encoder
+		flusher http.Flusher
+		sent    bool
+	}
+)
+
+// Handler returns the HTTP handler serving the Server's endpoints.
+func (x *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", x.query)
+	return mux
+}
+
+func (x *Server) query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, nil, errors.New("method not allowed"))
+		return
+	}
+
+	var req Request
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, nil, errors.Wrap(err, "failed to decode request"))
+		return
+	}
+	if len(req.Queries) == 0 {
+		writeError(w, http.StatusBadRequest, nil, errors.New("no queries"))
+		return
+	}
+
+	// All the queries are parsed & classified before
+	// any are executed so invalid requests are rejected
+	// with an appropriate status code.
+	queries := make([]keyval.Query, len(req.Queries))
+	classified := make([]dispatch.Query, len(req.Queries))
+	for i, str := range req.Queries {
+		query, err := dispatch.Parse(str)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &i, errors.Wrap(err, "failed to parse query"))
+			return
+		}
+		queries[i] = query
+
+		if req.Explain {
+			continue
+		}
+		d, err := dispatch.Classify(query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, &i, err)
+			return
+		}
+		if d.Kind.Writes() && !x.Write && !req.DryRun {
+			writeError(w, http.StatusForbidden, &i, errors.New("writing isn't enabled"))
+			return
+		}
+		classified[i] = d
+	}
+
+	txOpts := x.TxOpts
+	for name, value := range req.TxOpts {
+		if err := txOpts.Set(name, value); err != nil {
+			writeError(w, http.StatusBadRequest, nil, err)
+			return
+		}
+	}
+
+	rangeOpts := x.RangeOpts
+	if req.Reverse {
+		rangeOpts.Reverse = true
+	}
+	if req.Limit > 0 {
+		rangeOpts.Limit = req.Limit
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	out := newStream(w)
+	ex := executor{
+		ctx:    r.Context(),
+		out:    out,
+		format: format.New(x.FormatOpts...),
+		opts: dispatch.Opts{
+			Write:  x.Write,
+			DryRun: req.DryRun,
+			Single: x.SingleOpts,
+			Range:  rangeOpts,
+		},
+	}
+
+	// If the transaction is retried after results were
+	// sent, the client would receive duplicate results.
+	// Instead, the request fails.
+	attempt := 0
+	eg := x.Engine.WithTxOpts(txOpts)
+	_, err := eg.Transact(func(eg engine.Engine) (interface{}, error) {
+		attempt++
+		if attempt > 1 && out.sent {
+			return nil, errors.New("transaction retried after results were sent")
+		}
+
+		for i := range queries {
+			ex.index = i
+			var err error
+			if req.Explain {
+				err = ex.explain(eg, queries[i])
+			} else {
+				err = ex.execute(eg, classified[i])
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// Range reads end early without an error if the
+			// client disconnects, so the context is checked
+			// to ensure the transaction isn't committed.
+			if err := ex.ctx.Err(); err != nil {
+				return nil, errors.Wrap(err, "request cancelled")
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		x.Log.Log().Err(err).Int("query", ex.index).Msg("request failed")
+		if !out.sent {
+			writeError(w, http.StatusInternalServerError, &ex.index, err)
+			return
+		}
+		if err := out.send(Result{Query: ex.index, Error: err.Error()}); err != nil {
+			x.Log.Log().Err(err).Msg("failed to send error")
+		}
+		return
+	}
+	x.Log.Log().Int("queries", len(queries)).Msg("request succeeded")
+}
+
+// writeError responds with the given status code & an errorBody.
+// If the error was caused by a particular query, i is its index.
+func writeError(w http.ResponseWriter, code int, i *int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorBody{Error: err.Error(), Query: i})
+}
+
+func newStream(w http.ResponseWriter) *stream {
+	flusher, _ := w.(http.Flusher)
+	return &stream{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+// send writes the result to the client as a single
+// line & flushes it so the client receives it immediately.
+func (x *stream) send(res Result) error {
+	x.sent = true
+	if err := x.enc.Encode(res); err != nil {
+		return errors.Wrap(err, "failed to send result")
+	}
+	if x.flusher != nil {
+		x.flusher.Flush()
+	}
+	return nil
+}
+
+// executor executes the queries of a single request,
+// sending the results to the client.
+type executor struct {
+	ctx    context.Context
+	out    *stream
+	format format.Format
+
+	// index is the index of the query being executed.
+	index int
+
+	opts dispatch.Opts
+}
+
+func (x *executor) explain(eg engine.Engine, query keyval.Query) error {
+	exp, err := eg.Explain(x.ctx, query, x.opts.Range)
+	if err != nil {
+		return errors.Wrap(err, "failed to explain query")
+	}
+	return x.out.send(Result{Query: x.index, Lines: exp.Lines(x.format)})
+}
+
+// execute executes the given query & sends its results. Stream
+// errors are wrapped like the errors returned by dispatch.Execute.
+func (x *executor) execute(eg engine.Engine, query dispatch.Query) error {
+	// The context is cancelled if the client disconnects or the
+	// query fails, which stops the directory & range reads.
+	ctx, cancel := context.WithCancel(x.ctx)
+	defer cancel()
+
+	res, err := dispatch.Execute(ctx, eg, query, x.opts)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case res.Directories != nil:
+		return x.directories(res)
+
+	case res.KeyValues != nil:
+		return errors.Wrapf(x.keyValues(res), "failed to execute as %s query", query.Kind)
+
+	case res.KeyValue != nil:
+		return x.keyValue(*res.KeyValue)
+
+	case res.Mutations != nil:
+		for _, m := range res.Mutations {
+			if err := x.out.send(Result{Query: x.index, Lines: m.Lines(x.format)}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case res.Message != "":
+		return x.out.send(Result{Query: x.index, Message: res.Message})
+
+	default:
+		// A single read found nothing.
+		return nil
+	}
+}
+
+func (x *executor) keyValue(kv keyval.KeyValue) error {
+	x.format.Reset()
+	x.format.KeyValue(kv)
+	return x.out.send(Result{Query: x.index, KeyValue: x.format.String()})
+}
+
+func (x *executor) keyValues(res dispatch.Result) error {
+	for kv := range res.KeyValues {
+		if kv.Err != nil {
+			return kv.Err
+		}
+		if err := x.keyValue(kv.KV); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *executor) directories(res dispatch.Result) error {
+	for dir := range res.Directories {
+		if dir.Err != nil {
+			return dir.Err
+		}
+
+		x.format.Reset()
+		x.format.Directory(convert.FromStringArray(dir.Dir.GetPath()))
+		x.format.DirMeta(format.DirMeta{
+			Prefix:    facade.DirPrefix(dir.Dir),
+			Layer:     dir.Dir.GetLayer(),
+			Partition: facade.IsPartition(dir.Dir),
+		})
+		if err := x.out.send(Result{Query: x.index, Directory: x.format.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
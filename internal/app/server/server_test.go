@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/engine"
+	"github.com/janderland/fql/engine/facade"
+)
+
+func newServer(t *testing.T, write bool) *httptest.Server {
+	srv := Server{
+		Engine:     engine.New(facade.NewMemTransactor(nil)),
+		Write:      write,
+		SingleOpts: engine.SingleOpts{Filter: true},
+		RangeOpts:  engine.RangeOpts{Filter: true},
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, ts *httptest.Server, req Request) (*http.Response, []Result) {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	resp, err := http.Post(ts.URL+"/query", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var results []Result
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var res Result
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &res))
+		results = append(results, res)
+	}
+	require.NoError(t, scanner.Err())
+	return resp, results
+}
+
+func TestServer_Query(t *testing.T) {
+	ts := newServer(t, true)
+
+	_, results := post(t, ts, Request{Queries: []string{
+		`/dir(1)="a"`,
+		`/dir(2)="b"`,
+		`/dir(3)="c"`,
+		`/dir(<int>)=<string>`,
+		`/dir(2)=<string>`,
+	}})
+	require.Equal(t, []Result{
+		{Query: 0, Message: "key set"},
+		{Query: 1, Message: "key set"},
+		{Query: 2, Message: "key set"},
+		{Query: 3, KeyValue: `/dir(1)="a"`},
+		{Query: 3, KeyValue: `/dir(2)="b"`},
+		{Query: 3, KeyValue: `/dir(3)="c"`},
+		{Query: 4, KeyValue: `/dir(2)="b"`},
+	}, results)
+
+	_, results = post(t, ts, Request{Queries: []string{`/dir(<int>)=<string>`}, Reverse: true, Limit: 2})
+	require.Equal(t, []Result{
+		{Query: 0, KeyValue: `/dir(3)="c"`},
+		{Query: 0, KeyValue: `/dir(2)="b"`},
+	}, results)
+
+	_, results = post(t, ts, Request{Queries: []string{`/dir`}})
+	require.Equal(t, []Result{{Query: 0, Directory: `/dir`}}, results)
+}
+
+func TestServer_Transaction(t *testing.T) {
+	srv := Server{
+		Engine: engine.New(facade.NewMemTransactor(nil)),
+		Write:  true,
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Without filtering, the range read fails because the value
+	// isn't a bool. The set's result was already sent, so the
+	// error is sent as the last line & the set isn't committed.
+	_, results := post(t, ts, Request{Queries: []string{
+		`/dir(1)=2`,
+		`/dir(<>)=<bool>`,
+	}})
+	require.Len(t, results, 2)
+	require.Equal(t, Result{Query: 0, Message: "key set"}, results[0])
+	require.Equal(t, 1, results[1].Query)
+	require.NotEmpty(t, results[1].Error)
+
+	_, results = post(t, ts, Request{Queries: []string{`/dir(<>)=<int>`}})
+	require.Empty(t, results)
+}
+
+func TestServer_Write(t *testing.T) {
+	ts := newServer(t, false)
+
+	resp, _ := post(t, ts, Request{Queries: []string{`/dir(1)=<>`, `/dir(1)=2`}})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, results := post(t, ts, Request{Queries: []string{`/dir(1)=2`, `/dir(2)=3`}, DryRun: true})
+	require.Len(t, results, 2)
+	require.Equal(t, 0, results[0].Query)
+	require.NotEmpty(t, results[0].Lines)
+	require.Equal(t, 1, results[1].Query)
+	require.NotEmpty(t, results[1].Lines)
+
+	_, results = post(t, ts, Request{Queries: []string{`/dir(1)=2`}, Explain: true})
+	require.Len(t, results, 1)
+	require.NotEmpty(t, results[0].Lines)
+}
+
+func TestServer_TxOpts(t *testing.T) {
+	ts := newServer(t, true)
+
+	// The request's timeout expires before
+	// the set reads the directory layer.
+	resp, _ := post(t, ts, Request{
+		Queries: []string{`/dir(1)=2`},
+		TxOpts:  map[string]string{"timeout": "1ns"},
+	})
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	_, results := post(t, ts, Request{
+		Queries: []string{`/dir(1)=2`},
+		TxOpts:  map[string]string{"timeout": "1m", "priority": "batch"},
+	})
+	require.Equal(t, []Result{{Query: 0, Message: "key set"}}, results)
+}
+
+func TestServer_BadRequest(t *testing.T) {
+	ts := newServer(t, true)
+
+	tests := map[string]struct {
+		body string
+		code int
+	}{
+		"invalid json":  {body: `{"queries":`, code: http.StatusBadRequest},
+		"unknown field": {body: `{"query":"/dir"}`, code: http.StatusBadRequest},
+		"no queries":    {body: `{"queries":[]}`, code: http.StatusBadRequest},
+		"invalid query": {body: `{"queries":["/dir","/dir("]}`, code: http.StatusBadRequest},
+		"unknown opt":   {body: `{"queries":["/dir"],"txOpts":{"tag":"a"}}`, code: http.StatusBadRequest},
+		"invalid opt":   {body: `{"queries":["/dir"],"txOpts":{"timeout":"a"}}`, code: http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/query", "application/json", bytes.NewBufferString(test.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, test.code, resp.StatusCode)
+
+			var body errorBody
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.NotEmpty(t, body.Error)
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/query")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServer_Cancel(t *testing.T) {
+	srv := Server{
+		Engine:    engine.New(facade.NewMemTransactor(nil)),
+		Write:     true,
+		RangeOpts: engine.RangeOpts{Filter: true},
+	}
+
+	body, err := json.Marshal(Request{Queries: []string{`/dir(<>)=<>`}})
+	require.NoError(t, err)
+
+	// The request's context is cancelled before the query
+	// executes, as if the client disconnected.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var res errorBody
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Contains(t, res.Error, "context canceled")
+}
@@ -0,0 +1,344 @@
+// Package special implements the special variables & references of the
+// headless app. A variable named "stdout", such as <stdout:string>, causes
+// the raw value of each element it matches to be printed instead of the
+// matching key-values. The reference ":stdin" is replaced by the content
+// of stdin.
+//
+// The parser doesn't support named variables or references, so the special
+// ones are replaced by empty variables before parsing & are then located
+// within the parsed query.
+package special
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser"
+	"github.com/janderland/fql/parser/format"
+	"github.com/janderland/fql/parser/scanner"
+)
+
+const (
+	// Stdout is the name of the variable whose
+	// matching elements are printed to stdout.
+	Stdout = "stdout"
+
+	// Stdin is the name of the reference which
+	// is replaced by the content of stdin.
+	Stdin = "stdin"
+)
+
+type (
+	// Path locates an element within a key-value.
+	Path struct {
+		// Value is true if the element is within the
+		// value. Otherwise, it's within the key's tuple.
+		Value bool
+
+		// Index contains the index of the element within
+		// each of the nested tuples containing it, starting
+		// with the outermost tuple. If Value is true & Index
+		// is empty, the element is the value itself.
+		Index []int
+	}
+
+	// Query is a parsed query along with the paths
+	// of its special variables & references.
+	Query struct {
+		// Query contains an empty variable in place
+		// of each special variable or reference.
+		Query keyval.Query
+
+		Stdout []Path
+		Stdin  []Path
+	}
+
+	// Element is implemented by the "primitive" types,
+	// which may be used as a TupElement or a Value.
+	Element interface {
+		keyval.TupElement
+		keyval.Value
+	}
+
+	// location is the position of a variable within a query.
+	location struct {
+		// directory is true if the variable is an
+		// element of a directory, in which case
+		// path is meaningless.
+		directory bool
+		path      Path
+	}
+)
+
+// Parse parses the given query, locating its special variables
+// & references.
+func Parse(str string) (Query, error) {
+	s := scanner.New(strings.NewReader(str))
+	var tokens []parser.Token
+	for {
+		kind, err := s.Scan()
+		if err != nil {
+			return Query{}, err
+		}
+		if kind == scanner.TokenKindEnd {
+			break
+		}
+		tokens = append(tokens, parser.Token{Kind: kind, Token: s.Token()})
+	}
+
+	// The special variables & references are replaced by
+	// empty variables. Their ordinals among the query's
+	// variables are recorded so they can be located once
+	// the query is parsed.
+	var (
+		out           strings.Builder
+		vars          int
+		stdout, stdin []int
+		inString      bool
+		isName        = func(i int, name string) bool {
+			return i < len(tokens) && tokens[i].Kind == scanner.TokenKindOther && tokens[i].Token == name
+		}
+	)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Kind == scanner.TokenKindStrMark {
+			inString = !inString
+		}
+		if !inString {
+			switch {
+			case token.Kind == scanner.TokenKindVarStart:
+				if isName(i+1, Stdout) && i+2 < len(tokens) && tokens[i+2].Kind == scanner.TokenKindStampSep {
+					stdout = append(stdout, vars)
+					vars++
+					out.WriteString(token.Token)
+					i += 2
+					continue
+				}
+				vars++
+
+			case token.Kind == scanner.TokenKindStampSep && isName(i+1, Stdin):
+				stdin = append(stdin, vars)
+				vars++
+				out.WriteString("<>")
+				i++
+				continue
+			}
+		}
+		out.WriteString(token.Token)
+	}
+
+	p := parser.New(scanner.New(strings.NewReader(out.String())))
+	query, err := p.Parse()
+	if err != nil {
+		return Query{}, err
+	}
+
+	locs := locate(query)
+	if len(locs) != vars {
+		return Query{}, errors.Errorf("expected %d variables, found %d", vars, len(locs))
+	}
+
+	q := Query{Query: query}
+	for _, i := range stdout {
+		if locs[i].directory {
+			return Query{}, errors.Errorf("the '%s' variable can't be used in a directory", Stdout)
+		}
+		q.Stdout = append(q.Stdout, locs[i].path)
+	}
+	for _, i := range stdin {
+		if locs[i].directory {
+			return Query{}, errors.Errorf("the '%s' reference can't be used in a directory", Stdin)
+		}
+		q.Stdin = append(q.Stdin, locs[i].path)
+	}
+	return q, nil
+}
+
+// locate returns the locations of the query's variables
+// in the order they appear within the query string.
+func locate(query keyval.Query) []location {
+	var locs []location
+	dir := func(dir keyval.Directory) {
+		for _, e := range dir {
+			if _, ok := e.(keyval.Variable); ok {
+				locs = append(locs, location{directory: true})
+			}
+		}
+	}
+
+	var tuple func(tup keyval.Tuple, path Path)
+	tuple = func(tup keyval.Tuple, path Path) {
+		for i, e := range tup {
+			index := append(append([]int(nil), path.Index...), i)
+			switch e := e.(type) {
+			case keyval.Variable:
+				locs = append(locs, location{path: Path{Value: path.Value, Index: index}})
+			case keyval.Tuple:
+				tuple(e, Path{Value: path.Value, Index: index})
+			}
+		}
+	}
+
+	switch query := query.(type) {
+	case keyval.Directory:
+		dir(query)
+
+	case keyval.Move:
+		dir(query.From)
+		dir(query.To)
+
+	case keyval.Key:
+		dir(query.Directory)
+		tuple(query.Tuple, Path{})
+
+	case keyval.KeyValue:
+		dir(query.Key.Directory)
+		tuple(query.Key.Tuple, Path{})
+		switch v := query.Value.(type) {
+		case keyval.Variable:
+			locs = append(locs, location{path: Path{Value: true}})
+		case keyval.Tuple:
+			tuple(v, Path{Value: true})
+		}
+	}
+	return locs
+}
+
+// Bind returns the query with each stdin reference
+// replaced by the given element.
+func (x Query) Bind(e Element) (keyval.Query, error) {
+	if len(x.Stdin) == 0 {
+		return x.Query, nil
+	}
+
+	var kv keyval.KeyValue
+	switch query := x.Query.(type) {
+	case keyval.Key:
+		kv = keyval.KeyValue{Key: query, Value: keyval.Variable{}}
+	case keyval.KeyValue:
+		kv = query
+	default:
+		return nil, errors.Errorf("the '%s' reference can only be used in key-values", Stdin)
+	}
+
+	for _, path := range x.Stdin {
+		var err error
+		switch {
+		case path.Value && len(path.Index) == 0:
+			kv.Value = e
+		case path.Value:
+			tup, ok := kv.Value.(keyval.Tuple)
+			if !ok {
+				return nil, errors.New("expected value to be a tuple")
+			}
+			kv.Value, err = replace(tup, path.Index, e)
+		default:
+			kv.Key.Tuple, err = replace(kv.Key.Tuple, path.Index, e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := x.Query.(keyval.Key); ok {
+		return kv.Key, nil
+	}
+	return kv, nil
+}
+
+// replace returns a copy of the tuple with the
+// element at the given index path replaced.
+func replace(tup keyval.Tuple, index []int, e Element) (keyval.Tuple, error) {
+	if index[0] >= len(tup) {
+		return nil, errors.Errorf("index %d out of bounds", index[0])
+	}
+	out := append(keyval.Tuple(nil), tup...)
+	if len(index) == 1 {
+		out[index[0]] = e
+		return out, nil
+	}
+
+	inner, ok := out[index[0]].(keyval.Tuple)
+	if !ok {
+		return nil, errors.Errorf("expected element %d to be a tuple", index[0])
+	}
+	inner, err := replace(inner, index[1:], e)
+	if err != nil {
+		return nil, err
+	}
+	out[index[0]] = inner
+	return out, nil
+}
+
+// Print returns the raw values of the elements matched by
+// the stdout variables, separated by tabs.
+func (x Query) Print(kv keyval.KeyValue) (string, error) {
+	values := make([]string, 0, len(x.Stdout))
+	for _, path := range x.Stdout {
+		e, err := get(kv, path)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, Raw(e))
+	}
+	return strings.Join(values, "\t"), nil
+}
+
+// get returns the element at the given path.
+func get(kv keyval.KeyValue, path Path) (interface{}, error) {
+	tup := kv.Key.Tuple
+	if path.Value {
+		if len(path.Index) == 0 {
+			return kv.Value, nil
+		}
+		var ok bool
+		if tup, ok = kv.Value.(keyval.Tuple); !ok {
+			return nil, errors.New("expected value to be a tuple")
+		}
+	}
+
+	for i, index := range path.Index {
+		if index >= len(tup) {
+			return nil, errors.Errorf("index %d out of bounds", index)
+		}
+		if i == len(path.Index)-1 {
+			return tup[index], nil
+		}
+		var ok bool
+		if tup, ok = tup[index].(keyval.Tuple); !ok {
+			return nil, errors.Errorf("expected element %d to be a tuple", index)
+		}
+	}
+	return nil, errors.New("empty path")
+}
+
+// Raw formats the given element without the syntax needed to
+// parse it. Strings are unquoted & unescaped, and bytes are
+// printed as hex without the '0x' prefix. Other elements, such as
+// tuples, are formatted as they would be in a query.
+func Raw(e interface{}) string {
+	switch e := e.(type) {
+	case keyval.String:
+		return string(e)
+	case keyval.Bytes:
+		return hex.EncodeToString(e)
+	case keyval.Int:
+		return strconv.FormatInt(int64(e), 10)
+	case keyval.Uint:
+		return strconv.FormatUint(uint64(e), 10)
+	case keyval.Float:
+		return strconv.FormatFloat(float64(e), 'g', -1, 64)
+	case keyval.Bool:
+		return strconv.FormatBool(bool(e))
+	case keyval.Value:
+		f := format.New(format.WithPrintBytes())
+		f.Value(e)
+		return f.String()
+	default:
+		return ""
+	}
+}
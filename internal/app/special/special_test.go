@@ -0,0 +1,100 @@
+package special
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/janderland/fql/keyval"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		parsed keyval.Query
+		stdout []Path
+		stdin  []Path
+		err    bool
+	}{
+		{
+			name:  "none",
+			query: `/dir(<int>,":stdin <stdout:int>")=<>`,
+			parsed: keyval.KeyValue{
+				Key:   keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{keyval.Variable{keyval.IntType}, keyval.String(":stdin <stdout:int>")}},
+				Value: keyval.Variable{},
+			},
+		},
+		{
+			name:  "stdout",
+			query: `/dir(<int>,(<stdout:string|int>))=<stdout:>`,
+			parsed: keyval.KeyValue{
+				Key: keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{
+					keyval.Variable{keyval.IntType},
+					keyval.Tuple{keyval.Variable{keyval.StringType, keyval.IntType}},
+				}},
+				Value: keyval.Variable{},
+			},
+			stdout: []Path{{Index: []int{1, 0}}, {Value: true}},
+		},
+		{
+			name:  "stdin",
+			query: `/dir(1,:stdin)=(2,:stdin)`,
+			parsed: keyval.KeyValue{
+				Key:   keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{keyval.Int(1), keyval.Variable{}}},
+				Value: keyval.Tuple{keyval.Int(2), keyval.Variable{}},
+			},
+			stdin: []Path{{Index: []int{1}}, {Value: true, Index: []int{1}}},
+		},
+		{
+			name:  "directory",
+			query: `/<stdout:>(1)`,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := Parse(test.query)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.parsed, q.Query)
+			require.Equal(t, test.stdout, q.Stdout)
+			require.Equal(t, test.stdin, q.Stdin)
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	q, err := Parse(`/dir(1,:stdin)=(2,:stdin)`)
+	require.NoError(t, err)
+
+	bound, err := q.Bind(keyval.String("hi"))
+	require.NoError(t, err)
+	require.Equal(t, keyval.KeyValue{
+		Key:   keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{keyval.Int(1), keyval.String("hi")}},
+		Value: keyval.Tuple{keyval.Int(2), keyval.String("hi")},
+	}, bound)
+
+	// The parsed query isn't modified by binding.
+	require.Equal(t, keyval.Variable{}, q.Query.(keyval.KeyValue).Key.Tuple[1])
+}
+
+func TestPrint(t *testing.T) {
+	q, err := Parse(`/dir(<stdout:>,<stdout:>,<>)=<stdout:>`)
+	require.NoError(t, err)
+
+	str, err := q.Print(keyval.KeyValue{
+		Key: keyval.Key{Directory: keyval.Directory{keyval.String("dir")}, Tuple: keyval.Tuple{
+			keyval.String("a \"b\""),
+			keyval.Bytes{0xab, 0x01},
+			keyval.Int(3),
+		}},
+		Value: keyval.Tuple{keyval.Float(1.5), keyval.Nil{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "a \"b\"\tab01\t(1.5,nil)", str)
+}
@@ -60,6 +60,11 @@ func Classify(kv q.KeyValue) Class {
 		return invalidClass(kvAttr)
 	}
 
+	// Raw prefixes must be the only element of the directory.
+	if kvAttr.badRaw {
+		return invalidClass(kvAttr)
+	}
+
 	// KeyValues should contain, at most, 1 VStampFuture.
 	if kvAttr.vstampFutures > 1 {
 		return invalidClass(kvAttr)
@@ -104,6 +109,7 @@ type attributes struct {
 	hasVariable   bool
 	hasClear      bool
 	hasNil        bool
+	badRaw        bool
 }
 
 // merge combines the attributes of parts of a KeyValue
@@ -114,6 +120,7 @@ func (x *attributes) merge(c attributes) attributes {
 		hasVariable:   x.hasVariable || c.hasVariable,
 		hasClear:      x.hasClear || c.hasClear,
 		hasNil:        x.hasNil || c.hasNil,
+		badRaw:        x.badRaw || c.badRaw,
 	}
 }
 
@@ -146,6 +153,10 @@ func invalidClass(attr attributes) Class {
 			cond:   attr.hasNil,
 			substr: "nil",
 		},
+		{
+			cond:   attr.badRaw,
+			substr: "raw",
+		},
 	}
 
 	str.WriteString("invalid[")
@@ -23,6 +23,16 @@ func TestClassify(t *testing.T) {
 				Value: q.Int(-38),
 			},
 		},
+		{
+			kind: Constant,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.Bytes{0x01, 0x02}},
+					Tuple:     q.Tuple{q.Int(123), q.String("wow")},
+				},
+				Value: q.Int(-38),
+			},
+		},
 		{
 			kind: VStampKey,
 			kv: q.KeyValue{
@@ -148,6 +158,16 @@ func TestClassifyInvalid(t *testing.T) {
 				Value: nil,
 			},
 		},
+		{
+			name: "raw prefix in path",
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("hi"), q.Bytes{0x01}},
+					Tuple:     q.Tuple{q.Int(34)},
+				},
+				Value: q.Bytes{},
+			},
+		},
 		{
 			name: "vstamp key & value",
 			kv: q.KeyValue{
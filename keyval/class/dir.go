@@ -14,13 +14,19 @@ func getAttributesOfDir(dir q.Directory) attributes {
 		}
 		element.DirElement(&attr)
 	}
-	return attr.merge(attributes{hasNil: hasNil})
+
+	// A raw prefix must be the only
+	// element of the directory.
+	badRaw := attr.rawPrefixes > 0 && len(dir) > 1
+
+	return attr.merge(attributes{hasNil: hasNil, badRaw: badRaw})
 }
 
 var _ q.DirectoryOperation = &dirAttributes{}
 
 type dirAttributes struct {
 	hasVariable bool
+	rawPrefixes int
 }
 
 func (x *dirAttributes) merge(c attributes) attributes {
@@ -33,3 +39,7 @@ func (x *dirAttributes) ForString(q.String) {}
 func (x *dirAttributes) ForVariable(q.Variable) {
 	x.hasVariable = true
 }
+
+func (x *dirAttributes) ForBytes(q.Bytes) {
+	x.rawPrefixes++
+}
@@ -38,6 +38,23 @@ func FromStringArray(in []string) q.Directory {
 	return out
 }
 
+// ToRawPrefix returns the byte string of a raw prefix. If the
+// given keyval.Directory is not a raw prefix, meaning it doesn't
+// contain a single keyval.Bytes element, then false is returned.
+func ToRawPrefix(in q.Directory) ([]byte, bool) {
+	if len(in) != 1 {
+		return nil, false
+	}
+	prefix, ok := in[0].(q.Bytes)
+	return prefix, ok
+}
+
+// FromRawPrefix converts a byte string into a keyval.Directory
+// representing a raw prefix.
+func FromRawPrefix(in []byte) q.Directory {
+	return q.Directory{q.Bytes(in)}
+}
+
 // ToFDBTuple converts a keyval.Tuple into a tuple.Tuple. If the
 // keyval.Tuple contains a keyval.Variable or keyval.MaybeMore
 // then an error is returned.
@@ -24,6 +24,23 @@ func TestFromStringArray(t *testing.T) {
 	require.Equal(t, q.Directory{q.String("my"), q.String("dir"), q.String("path")}, dir)
 }
 
+func TestToRawPrefix(t *testing.T) {
+	raw, ok := ToRawPrefix(q.Directory{q.Bytes{0x01, 0x02}})
+	require.True(t, ok)
+	require.Equal(t, []byte{0x01, 0x02}, raw)
+
+	_, ok = ToRawPrefix(q.Directory{q.String("my"), q.Bytes{0x01}})
+	require.False(t, ok)
+
+	_, ok = ToRawPrefix(q.Directory{q.String("my")})
+	require.False(t, ok)
+}
+
+func TestFromRawPrefix(t *testing.T) {
+	dir := FromRawPrefix([]byte{0x01, 0x02})
+	require.Equal(t, q.Directory{q.Bytes{0x01, 0x02}}, dir)
+}
+
 func TestToFDBTuple(t *testing.T) {
 	tup, err := ToFDBTuple(q.Tuple{q.Nil{}, q.Int(22), q.Bool(false)})
 	require.NoError(t, err)
@@ -44,6 +44,14 @@ func (x KeyValue) Eq(e interface{}) bool {
 	return x.Key.Eq(v.Key) && x.Value.Eq(v.Value)
 }
 
+func (x Move) Eq(e interface{}) bool {
+	v, ok := e.(Move)
+	if !ok {
+		return false
+	}
+	return x.From.Eq(v.From) && x.To.Eq(v.To)
+}
+
 func (x Key) Eq(e interface{}) bool {
 	v, ok := e.(Key)
 	if !ok {
@@ -77,7 +85,7 @@ func (x Directory) Eq(e interface{}) bool {
 		return false
 	}
 	for i := range x {
-		if x[i] != v[i] {
+		if !x[i].Eq(v[i]) {
 			return false
 		}
 	}
@@ -76,6 +76,14 @@ func TestMaybeMore_Eq(t *testing.T) {
 	assert.False(t, x.Eq(Int(0)))
 }
 
+func TestDirectory_Eq(t *testing.T) {
+	x := Directory{String("my"), Variable{IntType}}
+	assert.True(t, x.Eq(Directory{String("my"), Variable{IntType}}))
+	assert.False(t, x.Eq(Directory{String("my"), Variable{}}))
+	assert.True(t, Directory{Bytes{0x01}}.Eq(Directory{Bytes{0x01}}))
+	assert.False(t, x.Eq(Int(55)))
+}
+
 func TestTuple_Eq(t *testing.T) {
 	x := Tuple{Int(1), Float(2.2), Tuple{Bool(true), Bool(false)}}
 	assert.True(t, x.Eq(Tuple{Int(1), Float(2.2), Tuple{Bool(true), Bool(false)}}))
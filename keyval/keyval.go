@@ -37,15 +37,15 @@
 // and are serialized by FQL.
 package keyval
 
-//go:generate go run ./operation -op-name Query     -param-name query      -types Directory,Key,KeyValue
-//go:generate go run ./operation -op-name Directory -param-name DirElement -types String,Variable
+//go:generate go run ./operation -op-name Query     -param-name query      -types Directory,Key,KeyValue,Move
+//go:generate go run ./operation -op-name Directory -param-name DirElement -types String,Variable,Bytes
 //go:generate go run ./operation -op-name Tuple     -param-name TupElement -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,MaybeMore,VStamp,VStampFuture
 //go:generate go run ./operation -op-name Value     -param-name value      -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,Clear,VStamp,VStampFuture
 
 type (
 	// Query is an interface implemented by the types which can
 	// be passed to [engine.Engine] as a query. This includes
-	// KeyValue, Key, & Directory.
+	// KeyValue, Key, Directory, & Move.
 	Query = query
 
 	// KeyValue can be passed to [engine.Engine] as a query or be
@@ -69,8 +69,23 @@ type (
 	// query. These kinds of queries define a directory path
 	// schema. When executed, all directories matching the
 	// schema are returned.
+	//
+	// When used as part of a Key, a Directory may instead
+	// contain a single Bytes element. This is known as a raw
+	// prefix. The Key's tuple is packed directly after the
+	// raw prefix without consulting the directory layer.
+	// Raw prefixes cannot be used as directory queries.
 	Directory []DirElement
 
+	// Move can be passed to [engine.Engine] as a query. When
+	// executed, the directory at path From is moved to path
+	// To along with all of its contents. Neither directory
+	// may contain a Variable or raw prefix.
+	Move struct {
+		From Directory
+		To   Directory
+	}
+
 	// Tuple may contain a Tuple, Variable, MaybeMore, or any
 	// of the "primitive" types.
 	Tuple []TupElement
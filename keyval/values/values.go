@@ -76,8 +76,11 @@ func Unpack(val []byte, typ keyval.ValueType, order binary.ByteOrder) (keyval.Va
 		return uuid, nil
 
 	case keyval.TupleType:
-		tup, err := tuple.Unpack(val)
-		return convert.FromFDBTuple(tup), errors.Wrap(err, "failed to unpack tuple")
+		tup, err := UnpackTuple(val)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unpack tuple")
+		}
+		return convert.FromFDBTuple(tup), nil
 
 	case keyval.VStampType:
 		var vstamp keyval.VStamp
@@ -92,3 +95,15 @@ func Unpack(val []byte, typ keyval.ValueType, order binary.ByteOrder) (keyval.Va
 		return nil, UnexpectedValueTypeErr{errors.Errorf("unknown ValueType '%v'", typ)}
 	}
 }
+
+// UnpackTuple unpacks the given bytes as a tuple. The FDB bindings
+// panic when given some kinds of malformed tuples, so the panic is
+// recovered & returned as an error.
+func UnpackTuple(b []byte) (tup tuple.Tuple, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tup, err = nil, errors.Errorf("malformed tuple: %v", r)
+		}
+	}()
+	return tuple.Unpack(b)
+}
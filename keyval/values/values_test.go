@@ -70,6 +70,7 @@ func TestInvalidUnpack(t *testing.T) {
 		{val: []byte{0x12, 0xA7}, typ: q.BoolType},
 		{val: []byte{0x88, 0x10, 0xA2, 0xBB, 0x74}, typ: q.FloatType},
 		{val: []byte{0xec, 0x4d, 0xf5, 0x43, 0xb6, 0x8c, 0x79, 0x81}, typ: q.UUIDType},
+		{val: []byte{0x21}, typ: q.TupleType},
 	}
 
 	for _, test := range tests {
@@ -4,20 +4,57 @@ fql is a query language for Foundation DB
 Usage:
 
 	fql [flags] query ...
+	fql [command]
+
+Available Commands:
+
+	decode      decode raw FDB key & value bytes into FQL
+	help        Help about any command
+	serve       execute queries received over HTTP
 
 Flags:
 
-	-b, --bytes               print full byte strings instead of just their length
-	-c, --cluster string      path to cluster file
-	-h, --help                help for fql
-	    --limit int           limit the number of KVs read in range-reads
-	-l, --little              encode/decode values as little endian instead of big endian
-	    --log                 enable debug logging
-	    --log-file string     logging file when in fullscreen (default "log.txt")
-	-q, --query stringArray   execute query non-interactively
-	-r, --reverse             query range-reads in reverse order
-	-s, --strict              throw an error if a KV is read which doesn't match the schema
-	-w, --write               allow write queries
+	    --buffer-file string         file which the multi-line editor of the fullscreen UI saves to & loads from, defaults to fql/buffer.fql in the user config directory
+	-b, --bytes                      print full byte strings instead of just their length
+	-c, --cluster string             path to cluster file
+	    --color string               highlight the output: auto, always, or never (default "auto")
+	    --details                    print the prefix of each directory when listing directories
+	    --dry-run                    print the packed bytes of write queries instead of writing them
+	    --explain                    describe how the given queries would execute instead of executing them
+	-f, --file stringArray           execute the queries in the given file non-interactively, or '-' for stdin
+	-h, --help                       help for fql
+	    --history-file string        file storing the query history of the fullscreen UI, defaults to fql/history in the user config directory
+	    --history-size int           max number of queries kept in the history, 0 disables saving the history (default 1000)
+	    --keep-going                 report failed transactions & continue executing the rest
+	    --limit int                  limit the number of KVs read in range-reads
+	-l, --little                     encode/decode values as little endian instead of big endian
+	    --log                        enable debug logging
+	    --log-file string            logging file when in fullscreen (default "log.txt")
+	    --max-retry-delay duration   max backoff delay between transaction retries
+	    --metrics string             after executing the queries, write a summary of metrics to the given file, or '-' for stderr
+	    --placeholder stringArray    print elements of the given type as a variable instead of their value
+	    --priority string            transaction priority: default, batch, or immediate (default "default")
+	-q, --query stringArray          execute query non-interactively
+	    --record string              record the DB calls & their results to the given file
+	    --redact-dir ints            replace the directory elements at the given indexes with hashes
+	    --redact-key ints            replace the strings & bytes of the key's tuple elements at the given indexes with hashes
+	    --redact-salt string         salt mixed into the redaction hashes, defaults to $FQL_REDACT_SALT or a random salt
+	    --redact-value               replace the strings & bytes of values with hashes
+	    --repl                       read queries from stdin line by line instead of starting the fullscreen UI
+	    --replay string              serve DB calls from the given recording instead of a DB
+	    --retry-limit int            max number of times a transaction is retried, -1 disables retries
+	-r, --reverse                    query range-reads in reverse order
+	    --stdin-blob                 use all of stdin as the value of the ':stdin' reference instead of each line
+	-s, --strict                     throw an error if a KV is read which doesn't match the schema
+	    --timeout duration           cancel transactions which take longer than the given duration
+	    --trace string               write a span for each query & pipeline stage to the given file as OTLP JSON
+	    --trace-parent string        W3C traceparent of the span which the spans are children of, defaults to $TRACEPARENT
+	    --tx                         end the transaction of the preceding queries, so the following queries execute in a new transaction
+	    --tx-size int                commit after every given number of queries, defaults to 1 when executing files
+	    --width int                  print tuples across multiple indented lines if they would exceed the given width
+	-w, --write                      allow write queries
+
+Use "fql [command] --help" for more information about a command.
 */
 package main
 
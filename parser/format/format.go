@@ -4,8 +4,10 @@ package format
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/janderland/fql/keyval"
 	"github.com/janderland/fql/parser/internal"
@@ -23,6 +25,89 @@ type Format struct {
 	// When set to false, byte strings are formatted
 	// as their length instead of the actual string.
 	printBytes bool
+
+	// When set to true, directory metadata includes
+	// the prefix allocated to the directory.
+	dirDetails bool
+
+	// theme styles the tokens as they're
+	// appended to the internal buffer.
+	theme Theme
+
+	// When greater than zero, tuples which would cause
+	// a line to exceed this width are split across
+	// multiple indented lines.
+	width int
+
+	// column is the width of the last line
+	// in the internal buffer, excluding
+	// the codes added by the theme.
+	column int
+
+	// depth is the number of multi-line
+	// tuples the next line is nested in.
+	depth int
+
+	// placeholders contains the types of the data
+	// elements which are formatted as a variable
+	// of their type instead of their value.
+	placeholders map[keyval.ValueType]struct{}
+
+	// redaction specifies which elements are
+	// replaced by hashes. If nil, nothing is
+	// redacted.
+	redaction *Redaction
+
+	// redacting is true while formatting
+	// an element selected by redaction.
+	redacting bool
+}
+
+// Style wraps a token, such as a string or a number,
+// to change how it's displayed. For instance, a Style
+// may surround the token with ANSI color codes.
+type Style func(string) string
+
+// Theme specifies the Style of each class of token.
+// If a Style is nil then the token is left as is.
+type Theme struct {
+	// Directory styles the elements of directories.
+	Directory Style
+
+	// String styles strings, including their quotes.
+	String Style
+
+	// Number styles ints, uints, and floats.
+	Number Style
+
+	// Bytes styles byte strings, UUIDs, & versionstamps.
+	Bytes Style
+
+	// Keyword styles nil, booleans, clear, & maybe-more.
+	Keyword Style
+
+	// Variable styles variables, including their brackets.
+	Variable Style
+
+	// Comment styles directory metadata.
+	Comment Style
+}
+
+// DirMeta contains the metadata of a directory
+// which is included in directory listings.
+type DirMeta struct {
+	// Prefix is the byte string allocated to the
+	// directory by the directory layer. It's nil
+	// for partitions, whose prefix isn't exposed
+	// by the FDB bindings.
+	Prefix []byte
+
+	// Layer is the layer tag of the directory.
+	Layer []byte
+
+	// Partition is true if the directory is the root
+	// of a partition, as reported by facade.IsPartition.
+	Partition bool
 }
 
 type Option func(*Format)
@@ -43,14 +128,112 @@ func WithPrintBytes() Option {
 	}
 }
 
+func WithDirDetails() Option {
+	return func(x *Format) {
+		x.dirDetails = true
+	}
+}
+
+// WithTheme styles the formatted tokens using the given Theme.
+// Themes only add to the output, so removing the styles yields
+// the same string as formatting without a theme.
+func WithTheme(theme Theme) Option {
+	return func(x *Format) {
+		x.theme = theme
+	}
+}
+
+// WithWidth splits tuples across multiple lines when they
+// would cause a line to exceed the given width. Each element
+// is placed on its own indented line & followed by a comma.
+// The output can still be parsed by parser.Parser.
+func WithWidth(width int) Option {
+	return func(x *Format) {
+		x.width = width
+	}
+}
+
+// WithPlaceholders formats the data elements of the given
+// types as variables instead of their values. For instance,
+// if keyval.UUIDType is given then UUIDs are formatted as
+// "<uuid>". Placeholders apply to the elements of tuples
+// & values, but not to directories.
+func WithPlaceholders(types ...keyval.ValueType) Option {
+	return func(x *Format) {
+		if x.placeholders == nil {
+			x.placeholders = make(map[keyval.ValueType]struct{})
+		}
+		for _, typ := range types {
+			x.placeholders[typ] = struct{}{}
+		}
+	}
+}
+
+// WithRedaction replaces the strings & byte strings selected
+// by the given Redaction with hashes of their contents.
+func WithRedaction(redaction Redaction) Option {
+	return func(x *Format) {
+		x.redaction = &redaction
+	}
+}
+
+// ANSITheme returns a Theme which colors
+// the tokens using ANSI escape codes.
+func ANSITheme() Theme {
+	ansi := func(code string) Style {
+		return func(str string) string {
+			return "\x1b[" + code + "m" + str + "\x1b[0m"
+		}
+	}
+	return Theme{
+		Directory: ansi("34"),
+		String:    ansi("32"),
+		Number:    ansi("36"),
+		Bytes:     ansi("35"),
+		Keyword:   ansi("33"),
+		Variable:  ansi("1"),
+		Comment:   ansi("90"),
+	}
+}
+
 // String returns the contents of the internal buffer.
 func (x *Format) String() string {
 	return x.builder.String()
 }
 
+// Sprint returns the string produced by the given
+// function's calls to a Format created without options.
+func Sprint(f func(*Format)) string {
+	x := New()
+	f(&x)
+	return x.String()
+}
+
 // Reset clears the contents of the internal buffer.
 func (x *Format) Reset() {
 	x.builder.Reset()
+	x.column = 0
+	x.depth = 0
+}
+
+// write appends the given token to the internal buffer,
+// applying the given style if it's not nil.
+func (x *Format) write(style Style, token string) {
+	if i := strings.LastIndexByte(token, '\n'); i >= 0 {
+		x.column = utf8.RuneCountInString(token[i+1:])
+	} else {
+		x.column += utf8.RuneCountInString(token)
+	}
+	if style != nil {
+		token = style(token)
+	}
+	x.builder.WriteString(token)
+}
+
+// newline begins a new line indented
+// to the current tuple depth.
+func (x *Format) newline() {
+	x.write(nil, "\n"+strings.Repeat("  ", x.depth))
 }
 
 // Query formats the given keyval.Query and appends
@@ -63,152 +246,254 @@ func (x *Format) Query(in keyval.Query) {
 // and appends it to the internal buffer.
 func (x *Format) KeyValue(in keyval.KeyValue) {
 	x.Key(in.Key)
-	x.builder.WriteRune(internal.KeyValSep)
+	x.write(nil, string(internal.KeyValSep))
 	x.Value(in.Value)
 }
 
+// Move formats the given keyval.Move
+// and appends it to the internal buffer.
+func (x *Format) Move(in keyval.Move) {
+	x.Directory(in.From)
+	x.write(nil, string(internal.KeyValSep))
+	x.Directory(in.To)
+}
+
 // Key formats the given keyval.Key
 // and appends it to the internal buffer.
 func (x *Format) Key(in keyval.Key) {
 	x.Directory(in.Directory)
-	x.Tuple(in.Tuple)
+	x.tuple(in.Tuple, true)
 }
 
 // Value formats the given keyval.Value
 // and appends it to the internal buffer.
 func (x *Format) Value(in keyval.Value) {
-	in.Value(&formatData{x})
+	x.redact(x.redaction != nil && x.redaction.Value, func() {
+		in.Value(&formatData{x})
+	})
 }
 
 // Directory formats the given keyval.Directory
 // and appends it to the internal buffer.
 func (x *Format) Directory(in keyval.Directory) {
-	for _, element := range in {
-		x.builder.WriteRune(internal.DirSep)
-		element.DirElement(&formatDirElement{x})
+	for i, element := range in {
+		x.redact(x.redaction != nil && contains(x.redaction.Directory, i), func() {
+			element.DirElement(&formatDirElement{x})
+		})
 	}
 }
 
+// DirMeta formats the given directory metadata as a comment
+// and appends it to the internal buffer. The comment is meant
+// to follow a directory within a listing. The directory's
+// prefix is only included if WithDirDetails was provided.
+// Partitions are marked as such instead of listing their
+// layer. If there is nothing to include, nothing is appended.
+func (x *Format) DirMeta(in DirMeta) {
+	var parts []string
+
+	if in.Partition {
+		parts = append(parts, "partition")
+	} else {
+		if x.dirDetails && in.Prefix != nil {
+			parts = append(parts, "prefix "+internal.HexStart+hex.EncodeToString(in.Prefix))
+		}
+		if len(in.Layer) > 0 {
+			parts = append(parts, "layer "+string(internal.StrMark)+escapeString(string(in.Layer))+string(internal.StrMark))
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+
+	x.write(nil, " ")
+	x.write(x.theme.Comment, string(internal.CommentStart)+" "+strings.Join(parts, ", "))
+}
+
 // Tuple formats the given keyval.Tuple
 // and appends it to the internal buffer.
 func (x *Format) Tuple(in keyval.Tuple) {
-	x.builder.WriteRune(internal.TupStart)
+	x.tuple(in, false)
+}
+
+// tuple formats the given keyval.Tuple. If key is true then
+// the tuple belongs to a key, so its elements may be selected
+// for redaction by their index.
+func (x *Format) tuple(in keyval.Tuple, key bool) {
+	if x.width > 0 && len(in) > 0 && x.column+x.tupleWidth(in, key) > x.width {
+		x.multiLineTuple(in, key)
+		return
+	}
+
+	x.write(nil, string(internal.TupStart))
 	for i, element := range in {
 		if i != 0 {
-			x.builder.WriteRune(internal.TupSep)
+			x.write(nil, string(internal.TupSep))
 		}
-		element.TupElement(&formatData{x})
+		x.tupElement(i, element, key)
 	}
-	x.builder.WriteRune(internal.TupEnd)
+	x.write(nil, string(internal.TupEnd))
+}
+
+// multiLineTuple formats the given tuple with each
+// element on its own line, indented one level deeper
+// than the line containing the tuple's start.
+func (x *Format) multiLineTuple(in keyval.Tuple, key bool) {
+	x.write(nil, string(internal.TupStart))
+	x.depth++
+	for i, element := range in {
+		x.newline()
+		x.tupElement(i, element, key)
+		x.write(nil, string(internal.TupSep))
+	}
+	x.depth--
+	x.newline()
+	x.write(nil, string(internal.TupEnd))
+}
+
+// tupElement formats the given element found at
+// index i of a tuple. See tuple for details.
+func (x *Format) tupElement(i int, in keyval.TupElement, key bool) {
+	x.redact(key && x.redaction != nil && contains(x.redaction.Tuple, i), func() {
+		in.TupElement(&formatData{x})
+	})
+}
+
+// tupleWidth returns the width of the
+// given tuple when formatted on one line.
+func (x *Format) tupleWidth(in keyval.Tuple, key bool) int {
+	f := *x
+	f.builder = &strings.Builder{}
+	f.theme = Theme{}
+	f.width = 0
+	f.column = 0
+	f.tuple(in, key)
+	return f.column
 }
 
 // Variable formats the given keyval.Variable
 // and appends it to the internal buffer.
 func (x *Format) Variable(in keyval.Variable) {
-	x.builder.WriteRune(internal.VarStart)
+	var str strings.Builder
+	str.WriteRune(internal.VarStart)
 	for i, vType := range in {
 		if i != 0 {
-			x.builder.WriteRune(internal.VarSep)
+			str.WriteRune(internal.VarSep)
 		}
-		x.builder.WriteString(string(vType))
+		str.WriteString(string(vType))
 	}
-	x.builder.WriteRune(internal.VarEnd)
+	str.WriteRune(internal.VarEnd)
+	x.write(x.theme.Variable, str.String())
 }
 
 // Bytes formats the given keyval.Bytes
 // and appends it to the internal buffer.
+// Redacted bytes are always printed as
+// their hash, so they may be correlated.
 func (x *Format) Bytes(in keyval.Bytes) {
-	if x.printBytes {
-		x.builder.WriteString(internal.HexStart)
-		x.builder.WriteString(hex.EncodeToString(in))
+	in = x.redactBytes(in)
+	if x.printBytes || x.redacting {
+		x.write(x.theme.Bytes, internal.HexStart+hex.EncodeToString(in))
 	} else {
-		x.builder.WriteString(strconv.FormatInt(int64(len(in)), 10))
-		x.builder.WriteString(" bytes")
+		x.write(x.theme.Bytes, strconv.FormatInt(int64(len(in)), 10)+" bytes")
 	}
 }
 
 // Str formats the given keyval.String
 // and appends it to the internal buffer.
 func (x *Format) Str(in keyval.String) {
-	x.builder.WriteRune(internal.StrMark)
-	x.builder.WriteString(escapeString(string(in)))
-	x.builder.WriteRune(internal.StrMark)
+	mark := string(internal.StrMark)
+	x.write(x.theme.String, mark+escapeString(x.redactStr(string(in)))+mark)
 }
 
 // UUID formats the given keyval.UUID
 // and appends it to the internal buffer.
 func (x *Format) UUID(in keyval.UUID) {
-	x.builder.WriteString(hex.EncodeToString(in[:4]))
-	x.builder.WriteRune('-')
-	x.builder.WriteString(hex.EncodeToString(in[4:6]))
-	x.builder.WriteRune('-')
-	x.builder.WriteString(hex.EncodeToString(in[6:8]))
-	x.builder.WriteRune('-')
-	x.builder.WriteString(hex.EncodeToString(in[8:10]))
-	x.builder.WriteRune('-')
-	x.builder.WriteString(hex.EncodeToString(in[10:]))
+	x.write(x.theme.Bytes, strings.Join([]string{
+		hex.EncodeToString(in[:4]),
+		hex.EncodeToString(in[4:6]),
+		hex.EncodeToString(in[6:8]),
+		hex.EncodeToString(in[8:10]),
+		hex.EncodeToString(in[10:]),
+	}, "-"))
 }
 
 // Bool formats the given keyval.Bool
 // and appends it to the internal buffer.
 func (x *Format) Bool(in keyval.Bool) {
 	if in {
-		x.builder.WriteString(internal.True)
+		x.write(x.theme.Keyword, internal.True)
 	} else {
-		x.builder.WriteString(internal.False)
+		x.write(x.theme.Keyword, internal.False)
 	}
 }
 
 // Int formats the given keyval.Int
 // and appends it to the internal buffer.
 func (x *Format) Int(in keyval.Int) {
-	x.builder.WriteString(strconv.FormatInt(int64(in), 10))
+	x.write(x.theme.Number, strconv.FormatInt(int64(in), 10))
 }
 
 // Uint formats the given keyval.Uint
 // and appends it to the internal buffer.
 func (x *Format) Uint(in keyval.Uint) {
-	x.builder.WriteString(strconv.FormatUint(uint64(in), 10))
+	x.write(x.theme.Number, strconv.FormatUint(uint64(in), 10))
 }
 
 // Float formats the given keyval.Float
 // and appends it to the internal buffer.
+// The shortest string which parses back
+// to the same float is used.
 func (x *Format) Float(in keyval.Float) {
-	x.builder.WriteString(strconv.FormatFloat(float64(in), 'g', 10, 64))
+	f := float64(in)
+	str := strconv.FormatFloat(f, 'g', -1, 64)
+
+	// The parser doesn't accept a '+' within
+	// a float, so large exponents are avoided.
+	if strings.Contains(str, "e+") {
+		str = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	// Without a '.', the parser would
+	// read the number as an integer.
+	if !strings.Contains(str, ".") && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		if i := strings.IndexByte(str, 'e'); i >= 0 {
+			str = str[:i] + ".0" + str[i:]
+		} else {
+			str += ".0"
+		}
+	}
+	x.write(x.theme.Number, str)
 }
 
 // Nil formats the given keyval.Nil
 // and appends it to the internal buffer.
 func (x *Format) Nil(_ keyval.Nil) {
-	x.builder.WriteString(internal.Nil)
+	x.write(x.theme.Keyword, internal.Nil)
 }
 
 // Clear formats the given keyval.Clear
 // and appends it to the internal buffer.
 func (x *Format) Clear(_ keyval.Clear) {
-	x.builder.WriteString(internal.Clear)
+	x.write(x.theme.Keyword, internal.Clear)
 }
 
 // MaybeMore formats the given keyval.MaybeMore
 // and appends it to the internal buffer.
 func (x *Format) MaybeMore(_ keyval.MaybeMore) {
-	x.builder.WriteString(internal.MaybeMore)
+	x.write(x.theme.Keyword, internal.MaybeMore)
 }
 
 // VStamp formats the given keyval.VStamp
 // and appends it to the internal buffer.
 func (x *Format) VStamp(in keyval.VStamp) {
-	x.builder.WriteRune('#')
-	x.builder.WriteString(hex.EncodeToString(in.TxVersion[:]))
-	x.builder.WriteRune(':')
-	x.builder.WriteString(bigEndianHex(in.UserVersion))
+	x.write(x.theme.Bytes, "#"+hex.EncodeToString(in.TxVersion[:])+":"+bigEndianHex(in.UserVersion))
 }
 
 // VStampFuture formats the given keyval.VStampFuture
 // and appends it to the internal buffer.
 func (x *Format) VStampFuture(in keyval.VStampFuture) {
-	x.builder.WriteString("#:")
-	x.builder.WriteString(bigEndianHex(in.UserVersion))
+	x.write(x.theme.Bytes, "#:"+bigEndianHex(in.UserVersion))
 }
 
 func escapeString(in string) string {
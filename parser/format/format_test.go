@@ -0,0 +1,213 @@
+package format
+
+import (
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	q "github.com/janderland/fql/keyval"
+	"github.com/janderland/fql/parser"
+	"github.com/janderland/fql/parser/scanner"
+)
+
+var kv = q.KeyValue{
+	Key: q.Key{
+		Directory: q.Directory{q.String("people"), q.String("with space")},
+		Tuple: q.Tuple{
+			q.String("jon"),
+			q.Tuple{q.Int(-12), q.Int(33), q.Float(1.5), q.Bool(true), q.Nil{}},
+			q.Bytes{0xab, 0x12},
+			q.MaybeMore{},
+		},
+	},
+	Value: q.Tuple{
+		q.UUID{0xbc, 0xef, 0xd2, 0xec, 0x4d, 0xf5, 0x43, 0xb6, 0x8c, 0x79, 0x81, 0xb7, 0x0b, 0x88, 0x6a, 0xf9},
+		q.Float(-0.25),
+		q.Tuple{},
+	},
+}
+
+func TestWithWidth(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		str   string
+	}{
+		{
+			name:  "disabled",
+			width: 0,
+			str: `/people/"with space"("jon",(-12,33,1.5,true,nil),0xab12,...)=` +
+				`(bcefd2ec-4df5-43b6-8c79-81b70b886af9,-0.25,())`,
+		},
+		{
+			name:  "wide",
+			width: 80,
+			str: strings.Join([]string{
+				`/people/"with space"("jon",(-12,33,1.5,true,nil),0xab12,...)=(`,
+				`  bcefd2ec-4df5-43b6-8c79-81b70b886af9,`,
+				`  -0.25,`,
+				`  (),`,
+				`)`,
+			}, "\n"),
+		},
+		{
+			name:  "narrow",
+			width: 20,
+			str: strings.Join([]string{
+				`/people/"with space"(`,
+				`  "jon",`,
+				`  (`,
+				`    -12,`,
+				`    33,`,
+				`    1.5,`,
+				`    true,`,
+				`    nil,`,
+				`  ),`,
+				`  0xab12,`,
+				`  ...,`,
+				`)=(`,
+				`  bcefd2ec-4df5-43b6-8c79-81b70b886af9,`,
+				`  -0.25,`,
+				`  (),`,
+				`)`,
+			}, "\n"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := New(WithPrintBytes(), WithWidth(test.width))
+			f.KeyValue(kv)
+			require.Equal(t, test.str, f.String())
+
+			p := parser.New(scanner.New(strings.NewReader(f.String())))
+			ast, err := p.Parse()
+			require.NoError(t, err)
+			require.Equal(t, kv, ast)
+		})
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		in  float64
+		str string
+	}{
+		{in: 5, str: "5.0"},
+		{in: -0.25, str: "-0.25"},
+		{in: 0.30000000000000004, str: "0.30000000000000004"},
+		{in: 1.2345678901234567, str: "1.2345678901234567"},
+		{in: 1e21, str: "1000000000000000000000.0"},
+		{in: 1234567, str: "1234567.0"},
+		{in: 3.47e-8, str: "3.47e-08"},
+		{in: 1e-300, str: "1.0e-300"},
+		{in: math.MaxFloat64},
+		{in: math.SmallestNonzeroFloat64},
+	}
+
+	for _, test := range tests {
+		f := New()
+		f.Float(q.Float(test.in))
+		if test.str != "" {
+			require.Equal(t, test.str, f.String())
+		}
+
+		p := parser.New(scanner.New(strings.NewReader("/dir(0)=" + f.String())))
+		ast, err := p.Parse()
+		require.NoError(t, err, f.String())
+		require.Equal(t, q.Float(test.in), ast.(q.KeyValue).Value)
+	}
+}
+
+func TestWithTheme(t *testing.T) {
+	plain := New(WithPrintBytes(), WithWidth(20))
+	plain.KeyValue(kv)
+
+	styled := New(WithPrintBytes(), WithWidth(20), WithTheme(ANSITheme()))
+	styled.KeyValue(kv)
+	require.NotEqual(t, plain.String(), styled.String())
+
+	ansi := regexp.MustCompile("\x1b\\[[0-9;]*m")
+	require.Equal(t, plain.String(), ansi.ReplaceAllString(styled.String(), ""))
+
+	// Resetting the Format also resets
+	// the width of the current line.
+	styled.Reset()
+	styled.Str("hi")
+	require.Equal(t, "\x1b[32m\"hi\"\x1b[0m", styled.String())
+}
+
+func TestWithPlaceholders(t *testing.T) {
+	f := New(WithPrintBytes(), WithPlaceholders(q.UUIDType, q.TupleType, q.IntType))
+	f.KeyValue(kv)
+	require.Equal(t, `/people/"with space"("jon",<tuple>,0xab12,...)=<tuple>`, f.String())
+
+	f = New(WithPlaceholders(q.UUIDType))
+	f.Value(kv.Value)
+	require.Equal(t, `(<uuid>,-0.25,())`, f.String())
+
+	// Directories & the key's tuple itself
+	// aren't replaced by placeholders.
+	f = New(WithPlaceholders(q.IntType))
+	f.Key(q.Key{Directory: q.Directory{q.String("dir")}, Tuple: q.Tuple{q.Int(1)}})
+	require.Equal(t, `/dir(<int>)`, f.String())
+}
+
+func TestWithRedaction(t *testing.T) {
+	redaction := Redaction{
+		Salt:      []byte("salt"),
+		Directory: []int{1},
+		Tuple:     []int{0, 1, 2},
+	}
+
+	f := New(WithPrintBytes(), WithRedaction(redaction))
+	f.KeyValue(kv)
+	first := f.String()
+
+	p := parser.New(scanner.New(strings.NewReader(first)))
+	ast, err := p.Parse()
+	require.NoError(t, err)
+
+	// Only the strings & bytes at the selected
+	// positions are replaced by hashes.
+	redacted := ast.(q.KeyValue)
+	require.Equal(t, q.String("people"), redacted.Key.Directory[0])
+	require.NotEqual(t, kv.Key.Directory[1], redacted.Key.Directory[1])
+	require.NotEqual(t, kv.Key.Tuple[0], redacted.Key.Tuple[0])
+	require.Equal(t, kv.Key.Tuple[1], redacted.Key.Tuple[1])
+	require.NotEqual(t, kv.Key.Tuple[2], redacted.Key.Tuple[2])
+	require.Len(t, redacted.Key.Tuple[2], 8)
+	require.Equal(t, kv.Key.Tuple[3], redacted.Key.Tuple[3])
+	require.Equal(t, kv.Value, redacted.Value)
+	require.True(t, strings.HasPrefix(string(redacted.Key.Tuple[0].(q.String)), "redacted:"))
+
+	// Hashes are stable for a given salt.
+	f.Reset()
+	f.KeyValue(kv)
+	require.Equal(t, first, f.String())
+
+	redaction.Salt = []byte("other")
+	f = New(WithPrintBytes(), WithRedaction(redaction))
+	f.KeyValue(kv)
+	require.NotEqual(t, first, f.String())
+
+	// Nested strings are redacted
+	// along with their tuple.
+	f = New(WithRedaction(Redaction{Tuple: []int{0}, Value: true}))
+	f.KeyValue(q.KeyValue{
+		Key:   q.Key{Tuple: q.Tuple{q.Tuple{q.String("a")}, q.String("a")}},
+		Value: q.String("a"),
+	})
+	hash := `"redacted:` + hex.EncodeToString((&Redaction{}).hash([]byte("a"))) + `"`
+	require.Equal(t, `((`+hash+`),"a")=`+hash, f.String())
+
+	// Redacted bytes are printed as their hash
+	// even if bytes aren't printed otherwise.
+	f = New(WithRedaction(Redaction{Tuple: []int{0}}))
+	f.Key(q.Key{Tuple: q.Tuple{q.Bytes("a"), q.Bytes("a")}})
+	require.Equal(t, `(0x`+hex.EncodeToString((&Redaction{}).hash([]byte("a")))+`,1 bytes)`, f.String())
+}
@@ -1,6 +1,7 @@
 package format
 
 import (
+	"encoding/hex"
 	"strings"
 
 	q "github.com/janderland/fql/keyval"
@@ -25,20 +26,27 @@ var quotedRunes = internal.AllSingleRuneTokens() +
 	internal.Whitespace
 
 func (x *formatDirElement) ForString(in q.String) {
-	needsQuotes := strings.ContainsAny(string(in), quotedRunes)
-	if needsQuotes {
-		x.format.builder.WriteRune(internal.StrMark)
-	}
-	x.format.builder.WriteString(escapeString(string(in)))
-	if needsQuotes {
-		x.format.builder.WriteRune(internal.StrMark)
+	in = q.String(x.format.redactStr(string(in)))
+	str := escapeString(string(in))
+	if strings.ContainsAny(string(in), quotedRunes) {
+		str = string(internal.StrMark) + str + string(internal.StrMark)
 	}
+	x.format.write(x.format.theme.Directory, string(internal.DirSep)+str)
 }
 
 func (x *formatDirElement) ForVariable(in q.Variable) {
+	x.format.write(x.format.theme.Directory, string(internal.DirSep))
 	x.format.Variable(in)
 }
 
+// ForBytes formats a raw prefix. Unlike other byte strings,
+// raw prefixes are always printed in full because they
+// identify where the key is stored.
+func (x *formatDirElement) ForBytes(in q.Bytes) {
+	in = x.format.redactBytes(in)
+	x.format.write(x.format.theme.Bytes, internal.HexStart+hex.EncodeToString(in))
+}
+
 // formatQuery is a keyval.QueryOperation which calls the
 // appropriate Format method for the given keyval.Query.
 type formatQuery struct {
@@ -59,9 +67,15 @@ func (x *formatQuery) ForKeyValue(in q.KeyValue) {
 	x.format.KeyValue(in)
 }
 
+func (x *formatQuery) ForMove(in q.Move) {
+	x.format.Move(in)
+}
+
 // formatData is both a keyval.TupleOperation and a
 // keyval.ValueOperation which calls the appropriate
-// Format method for the given data element.
+// Format method for the given data element. If the
+// element's type was given to WithPlaceholders, it's
+// formatted as a variable instead.
 type formatData struct {
 	format *Format
 }
@@ -76,6 +90,9 @@ func (x *formatData) ForVariable(in q.Variable) {
 }
 
 func (x *formatData) ForString(in q.String) {
+	if x.format.placeholder(q.StringType) {
+		return
+	}
 	x.format.Str(in)
 }
 
@@ -88,30 +105,51 @@ func (x *formatData) ForMaybeMore(in q.MaybeMore) {
 }
 
 func (x *formatData) ForTuple(in q.Tuple) {
+	if x.format.placeholder(q.TupleType) {
+		return
+	}
 	x.format.Tuple(in)
 }
 
 func (x *formatData) ForInt(in q.Int) {
+	if x.format.placeholder(q.IntType) {
+		return
+	}
 	x.format.Int(in)
 }
 
 func (x *formatData) ForUint(in q.Uint) {
+	if x.format.placeholder(q.UintType) {
+		return
+	}
 	x.format.Uint(in)
 }
 
 func (x *formatData) ForBool(in q.Bool) {
+	if x.format.placeholder(q.BoolType) {
+		return
+	}
 	x.format.Bool(in)
 }
 
 func (x *formatData) ForFloat(in q.Float) {
+	if x.format.placeholder(q.FloatType) {
+		return
+	}
 	x.format.Float(in)
 }
 
 func (x *formatData) ForUUID(in q.UUID) {
+	if x.format.placeholder(q.UUIDType) {
+		return
+	}
 	x.format.UUID(in)
 }
 
 func (x *formatData) ForBytes(in q.Bytes) {
+	if x.format.placeholder(q.BytesType) {
+		return
+	}
 	x.format.Bytes(in)
 }
 
@@ -120,9 +158,15 @@ func (x *formatData) ForClear(in q.Clear) {
 }
 
 func (x *formatData) ForVStamp(in q.VStamp) {
+	if x.format.placeholder(q.VStampType) {
+		return
+	}
 	x.format.VStamp(in)
 }
 
 func (x *formatData) ForVStampFuture(in q.VStampFuture) {
+	if x.format.placeholder(q.VStampType) {
+		return
+	}
 	x.format.VStampFuture(in)
 }
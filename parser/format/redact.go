@@ -0,0 +1,96 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/janderland/fql/keyval"
+)
+
+// Redaction specifies which strings & byte strings are
+// replaced by hashes of their contents. Equal values
+// are replaced by equal hashes, so redacted key-values
+// can still be correlated with each other.
+type Redaction struct {
+	// Salt is mixed into the hashes, preventing the original
+	// values from being recovered by hashing guesses. Outputs
+	// can only be correlated if they use the same Salt.
+	Salt []byte
+
+	// Directory contains the indexes of the
+	// directory elements which are redacted.
+	Directory []int
+
+	// Tuple contains the indexes of the key's tuple elements
+	// which are redacted. If a selected element is a tuple,
+	// all the strings & byte strings within it are redacted.
+	Tuple []int
+
+	// Value, when true, redacts all the strings
+	// & byte strings contained in the value.
+	Value bool
+}
+
+// redactedPrefix is prepended to the hash
+// which replaces a redacted string.
+const redactedPrefix = "redacted:"
+
+// hash returns the first 8 bytes of
+// the HMAC-SHA256 of the given bytes.
+func (x *Redaction) hash(in []byte) []byte {
+	mac := hmac.New(sha256.New, x.Salt)
+	_, _ = mac.Write(in)
+	return mac.Sum(nil)[:8]
+}
+
+// redact calls the given function with the redacting
+// flag set if enabled is true. If an enclosing element
+// is already being redacted, the flag remains set.
+func (x *Format) redact(enabled bool, f func()) {
+	if !enabled || x.redacting {
+		f()
+		return
+	}
+	x.redacting = true
+	defer func() { x.redacting = false }()
+	f()
+}
+
+// redactStr returns the hash of the given string if it's
+// being redacted. Otherwise, the string is returned as is.
+func (x *Format) redactStr(in string) string {
+	if !x.redacting {
+		return in
+	}
+	return redactedPrefix + hex.EncodeToString(x.redaction.hash([]byte(in)))
+}
+
+// redactBytes returns the hash of the given bytes if they're
+// being redacted. Otherwise, the bytes are returned as is.
+func (x *Format) redactBytes(in []byte) []byte {
+	if !x.redacting {
+		return in
+	}
+	return x.redaction.hash(in)
+}
+
+// placeholder formats a variable of the given type
+// & returns true if the type was given to
+// WithPlaceholders. Otherwise, it returns false.
+func (x *Format) placeholder(typ keyval.ValueType) bool {
+	if _, ok := x.placeholders[typ]; !ok {
+		return false
+	}
+	x.Variable(keyval.Variable{typ})
+	return true
+}
+
+func contains(list []int, i int) bool {
+	for _, v := range list {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
@@ -29,6 +29,11 @@ func (x *KeyValBuilder) AppendPartToDirectory(token string) {
 	x.kv.Key.Directory = append(x.kv.Key.Directory, keyval.String(token))
 }
 
+// SetRawPrefix replaces the directory with a raw prefix.
+func (x *KeyValBuilder) SetRawPrefix(prefix keyval.Bytes) {
+	x.kv.Key.Directory = keyval.Directory{prefix}
+}
+
 // AppendToLastDirPart appends the given string to the last element of the
 // directory, which is assumed to be a keyval.String. If the last element is
 // not a keyval.String then this method panics.
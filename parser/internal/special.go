@@ -32,7 +32,6 @@ const (
 
 	Exclamation = '!'
 	Dollar      = '$'
-	Percent     = '%'
 	Ampersand   = '&'
 	CurlyStart  = '{'
 	CurlyEnd    = '}'
@@ -68,6 +67,10 @@ const (
 	// Escape marks the start of an escape token.
 	Escape = '\\'
 
+	// CommentStart marks the start of a comment, which
+	// continues until the end of the line.
+	CommentStart = '%'
+
 	// HexStart marks the start of a hexadecimal number token.
 	HexStart = "0x"
 
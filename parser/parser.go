@@ -22,6 +22,8 @@ const (
 	stateDirHead
 	stateDirTail
 	stateDirVarEnd
+	stateRawPrefix
+	stateMoveTo
 	stateTupleHead
 	stateTupleTail
 	stateSeparator
@@ -50,6 +52,10 @@ func stateName(state state) string {
 		return "DirTail"
 	case stateDirVarEnd:
 		return "DirVarEnd"
+	case stateRawPrefix:
+		return "RawPrefix"
+	case stateMoveTo:
+		return "MoveTo"
 	case stateTupleHead:
 		return "TupleHead"
 	case stateTupleTail:
@@ -103,6 +109,8 @@ func tokenKindName(kind scanner.TokenKind) string {
 		return "End"
 	case scanner.TokenKindReserved:
 		return "Reserved"
+	case scanner.TokenKindComment:
+		return "Comment"
 	default:
 		return fmt.Sprintf("[unknown token kind %v]", kind)
 	}
@@ -150,6 +158,22 @@ func (x *Error) Error() string {
 	return errors.Wrap(x.Err, msg.String()).Error()
 }
 
+// Incomplete returns true if parsing failed because the
+// query ended early, meaning more input may complete it.
+func (x *Error) Incomplete() bool {
+	return x.Index > 0 && x.Index <= len(x.Tokens) && x.Tokens[x.Index-1].Kind == scanner.TokenKindEnd
+}
+
+// Offset returns the byte offset of the
+// failing token within the query string.
+func (x *Error) Offset() int {
+	var offset int
+	for i := 0; i < x.Index-1 && i < len(x.Tokens); i++ {
+		offset += len(x.Tokens[i].Token)
+	}
+	return offset
+}
+
 // Parser obtains tokens from the given [scanner.Scanner]
 // and attempts to parse them into a keyval.Query.
 type Parser struct {
@@ -182,6 +206,13 @@ func (x *Parser) Parse() (keyval.Query, error) {
 		// variable is for use in a tuple.
 		valVar bool
 
+		// TODO: Work into the state machine?
+		// If true, the directory being parsed is the
+		// destination of a move query. The source
+		// directory is stored in moveFrom.
+		move     bool
+		moveFrom keyval.Directory
+
 		// TODO: Work into the state machine?
 		// If < 0 then the string is a directory part.
 		// If == 0 then the string is in a tuple.
@@ -205,15 +236,38 @@ func (x *Parser) Parse() (keyval.Query, error) {
 			Token: token,
 		})
 
+		// Comments are ignored, regardless of the state.
+		// The scanner doesn't produce comments in strings.
+		if kind == scanner.TokenKindComment {
+			continue
+		}
+
 		switch x.state {
 		// The Parser should be at stateInitial when it begins
-		// parsing a query. Because all queries begin with a
-		// TokenKindDirSep, this is the only accepted token.
+		// parsing a query. Most queries begin with a
+		// TokenKindDirSep. Keys may instead begin with a
+		// hex string, which is used as a raw prefix. Any
+		// whitespace before the query is ignored, so the
+		// query may follow lines containing comments.
 		case stateInitial:
 			switch kind {
+			case scanner.TokenKindWhitespace, scanner.TokenKindNewline:
+				break
+
 			case scanner.TokenKindDirSep:
 				x.state = stateDirHead
 
+			case scanner.TokenKindOther:
+				if !strings.HasPrefix(token, internal.HexStart) {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+				x.state = stateRawPrefix
+				data, err := parseData(token)
+				if err != nil {
+					return nil, x.withTokens(err)
+				}
+				kv.SetRawPrefix(data.(keyval.Bytes))
+
 			default:
 				return nil, x.withTokens(x.tokenErr(kind))
 			}
@@ -243,18 +297,35 @@ func (x *Parser) Parse() (keyval.Query, error) {
 
 		// During stateDirTail the Parser transitions to create
 		// a new directory element, start parsing the key's
-		// tuple, or finishes the query as a directory query.
+		// tuple, start parsing the destination of a move
+		// query, or finishes the query as a directory or
+		// move query.
 		case stateDirTail:
 			switch kind {
 			case scanner.TokenKindDirSep:
 				x.state = stateDirHead
 
 			case scanner.TokenKindTupStart:
+				if move {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
 				x.state = stateTupleHead
 				tup = internal.TupBuilder{}
 				valTup = false
 
+			case scanner.TokenKindKeyValSep:
+				if move {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+				x.state = stateMoveTo
+				move = true
+				moveFrom = kv.Get().Key.Directory
+				kv = internal.KeyValBuilder{}
+
 			case scanner.TokenKindEnd:
+				if move {
+					return keyval.Move{From: moveFrom, To: kv.Get().Key.Directory}, nil
+				}
 				return kv.Get().Key.Directory, nil
 
 			default:
@@ -273,6 +344,33 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				return nil, x.withTokens(x.tokenErr(kind))
 			}
 
+		// stateMoveTo ensures that the destination
+		// directory of a move query begins with a
+		// TokenKindDirSep.
+		case stateMoveTo:
+			switch kind {
+			case scanner.TokenKindDirSep:
+				x.state = stateDirHead
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
+		// stateRawPrefix ensures that the key's tuple
+		// follows the raw prefix parsed during
+		// stateInitial. Raw prefixes cannot be used
+		// as directory queries.
+		case stateRawPrefix:
+			switch kind {
+			case scanner.TokenKindTupStart:
+				x.state = stateTupleHead
+				tup = internal.TupBuilder{}
+				valTup = false
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
 		// During stateTupleHead, the Parser creates a new
 		// keyval.TupElement current tuple, starts a new
 		// sub-tuple, or ends the current tuple. Allowing
@@ -285,15 +383,17 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				tup.StartSubTuple()
 
 			case scanner.TokenKindTupEnd:
-				if tup.EndTuple() {
-					if valTup {
-						x.state = stateFinished
-						kv.SetValue(tup.Get())
-						break
-					}
-					x.state = stateSeparator
-					kv.SetKeyTuple(tup.Get())
+				if !tup.EndTuple() {
+					x.state = stateTupleTail
+					break
+				}
+				if valTup {
+					x.state = stateFinished
+					kv.SetValue(tup.Get())
+					break
 				}
+				x.state = stateSeparator
+				kv.SetKeyTuple(tup.Get())
 
 			case scanner.TokenKindVarStart:
 				x.state = stateVarHead
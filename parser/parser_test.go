@@ -62,6 +62,123 @@ func TestDirectory(t *testing.T) {
 	})
 }
 
+func TestMove(t *testing.T) {
+	roundTrips := []struct {
+		name string
+		str  string
+		ast  q.Move
+	}{
+		{
+			name: "simple",
+			str:  "/old=/new",
+			ast:  q.Move{From: q.Directory{q.String("old")}, To: q.Directory{q.String("new")}},
+		},
+		{
+			name: "multi",
+			str:  "/my/old/dir=/my/\"new dir\"",
+			ast: q.Move{
+				From: q.Directory{q.String("my"), q.String("old"), q.String("dir")},
+				To:   q.Directory{q.String("my"), q.String("new dir")},
+			},
+		},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, test := range roundTrips {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+
+				ast, err := p.Parse()
+				require.NoError(t, err)
+				require.Equal(t, test.ast, ast)
+
+				f := newFormat()
+				f.Move(test.ast)
+				require.Equal(t, test.str, f.String())
+			})
+		}
+	})
+
+	parseFailures := []struct {
+		name string
+		str  string
+	}{
+		{name: "no destination", str: "/old="},
+		{name: "destination tuple", str: "/old=/new(1)"},
+		{name: "double move", str: "/old=/new=/other"},
+		{name: "value", str: "/old=12"},
+	}
+
+	t.Run("parse failures", func(t *testing.T) {
+		for _, test := range parseFailures {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+				ast, err := p.Parse()
+				require.Error(t, err)
+				require.Nil(t, ast)
+			})
+		}
+	})
+}
+
+func TestRawPrefix(t *testing.T) {
+	roundTrips := []struct {
+		name string
+		str  string
+		ast  q.KeyValue
+	}{
+		{
+			name: "empty tuple",
+			str:  "0x0102()=<>",
+			ast:  q.KeyValue{Key: q.Key{Directory: q.Directory{q.Bytes{0x01, 0x02}}}, Value: q.Variable{}},
+		},
+		{
+			name: "tuple",
+			str:  "0xfe(\"a\",1)=clear",
+			ast: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.Bytes{0xfe}}, Tuple: q.Tuple{q.String("a"), q.Int(1)}},
+				Value: q.Clear{},
+			},
+		},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, test := range roundTrips {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+
+				ast, err := p.Parse()
+				require.NoError(t, err)
+				require.Equal(t, test.ast, ast)
+
+				f := newFormat()
+				f.KeyValue(test.ast)
+				require.Equal(t, test.str, f.String())
+			})
+		}
+	})
+
+	parseFailures := []struct {
+		name string
+		str  string
+	}{
+		{name: "no tuple", str: "0x0102"},
+		{name: "directory after", str: "0x0102/dir(1)"},
+		{name: "bad hex", str: "0x01g2(1)"},
+	}
+
+	t.Run("parse failures", func(t *testing.T) {
+		for _, test := range parseFailures {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+				ast, err := p.Parse()
+				require.Error(t, err)
+				require.Nil(t, ast)
+			})
+		}
+	})
+}
+
 func TestTuple(t *testing.T) {
 	roundTrips := []struct {
 		name string
@@ -72,6 +189,7 @@ func TestTuple(t *testing.T) {
 		{name: "one", str: "(17)", ast: q.Tuple{q.Int(17)}},
 		{name: "two", str: "(17,\"hello world\")", ast: q.Tuple{q.Int(17), q.String("hello world")}},
 		{name: "sub tuple", str: "(\"hello\",23.3,(-3))", ast: q.Tuple{q.String("hello"), q.Float(23.3), q.Tuple{q.Int(-3)}}},
+		{name: "empty sub tuple", str: "(1,(),2)", ast: q.Tuple{q.Int(1), q.Tuple{}, q.Int(2)}},
 		{name: "uuid", str: "((bcefd2ec-4df5-43b6-8c79-81b70b886af9))", ast: q.Tuple{q.Tuple{q.UUID{0xbc, 0xef, 0xd2, 0xec, 0x4d, 0xf5, 0x43, 0xb6, 0x8c, 0x79, 0x81, 0xb7, 0x0b, 0x88, 0x6a, 0xf9}}}},
 		{name: "maybe more", str: "(18.2,0xffaa,...)", ast: q.Tuple{q.Float(18.2), q.Bytes{0xFF, 0xAA}, q.MaybeMore{}}},
 		{name: "escape", str: "(\"i want to say \\\"yo\\\"\")", ast: q.Tuple{q.String("i want to say \"yo\"")}},
@@ -353,6 +471,85 @@ func TestData(t *testing.T) {
 	}
 }
 
+func TestError(t *testing.T) {
+	tests := []struct {
+		str        string
+		incomplete bool
+		offset     int
+	}{
+		{str: "", incomplete: true, offset: 0},
+		{str: "/dir(1,", incomplete: true, offset: 7},
+		{str: "/dir(\"hi", incomplete: true, offset: 8},
+		{str: "/dir(1)=", incomplete: true, offset: 8},
+		{str: "/dir(<int|", incomplete: true, offset: 10},
+		{str: "/dir)", incomplete: false, offset: 4},
+		{str: "/dir(1)=1)", incomplete: false, offset: 9},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			p := New(scanner.New(strings.NewReader(test.str)))
+			_, err := p.Parse()
+
+			var perr *Error
+			require.ErrorAs(t, err, &perr)
+			require.Equal(t, test.incomplete, perr.Incomplete())
+			require.Equal(t, test.offset, perr.Offset())
+		})
+	}
+}
+
+func TestComment(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		ast  q.Query
+	}{
+		{
+			name: "directory",
+			str:  "/dir % partition",
+			ast:  q.Directory{q.String("dir")},
+		},
+		{
+			name: "leading",
+			str:  "% first\n\n  % second\n/dir",
+			ast:  q.Directory{q.String("dir")},
+		},
+		{
+			name: "tuple",
+			str:  "/dir(\n  1, % one\n  % nothing\n  \"% two\",\n)=clear % done",
+			ast: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("dir")}, Tuple: q.Tuple{q.Int(1), q.String("% two")}},
+				Value: q.Clear{},
+			},
+		},
+		{
+			name: "no space",
+			str:  "/dir(1)=2%done",
+			ast: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("dir")}, Tuple: q.Tuple{q.Int(1)}},
+				Value: q.Int(2),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := New(scanner.New(strings.NewReader(test.str)))
+			ast, err := p.Parse()
+			require.NoError(t, err)
+			require.Equal(t, test.ast, ast)
+		})
+	}
+
+	// A comment doesn't complete a query.
+	p := New(scanner.New(strings.NewReader("% only a comment")))
+	_, err := p.Parse()
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	require.True(t, perr.Incomplete())
+}
+
 func newFormat() format.Format {
 	return format.New(format.WithPrintBytes())
 }
@@ -81,6 +81,13 @@ const (
 	// isn't currently used by the language but reserved for
 	// later use.
 	TokenKindReserved
+
+	// TokenKindComment identifies a token which starts with
+	// CommentStart & continues until the end of the line,
+	// excluding the newline. Any whitespace preceding the
+	// comment is included in the token. Like whitespace,
+	// comments don't affect the meaning of a query.
+	TokenKindComment
 )
 
 type state int
@@ -114,6 +121,11 @@ const (
 	// include any of the single-rune constants from special.go, or any of
 	// the runes in the constants runesWhitespace and runesNewline.
 	stateOther
+
+	// stateComment follows any state, save for stateString, if
+	// a CommentStart rune is encountered. The scanner remains in
+	// this state until a rune found in runesNewline is encountered.
+	stateComment
 )
 
 // singleRuneKind returns a TokenKind which identifies a token equal
@@ -153,8 +165,6 @@ func singleRuneKind(r rune) TokenKind {
 		return TokenKindReserved
 	case internal.Dollar:
 		return TokenKindReserved
-	case internal.Percent:
-		return TokenKindReserved
 	case internal.Ampersand:
 		return TokenKindReserved
 	case internal.CurlyStart:
@@ -201,6 +211,8 @@ func primaryKind(state state) TokenKind {
 		return TokenKindOther
 	case stateOther:
 		return TokenKindOther
+	case stateComment:
+		return TokenKindComment
 	default:
 		// Its expected that this panic is recovered in Scanner.Scan.
 		err := errors.Errorf("unrecognized scanner state '%v'", state)
@@ -280,6 +292,18 @@ func (x *Scanner) Scan() (kind TokenKind, err error) {
 			return TokenKindEnd, nil
 		}
 
+		// Comments include every rune until the end of the line.
+		// The newline is left for the following token.
+		if x.state == stateComment {
+			if strings.ContainsRune(internal.Newline, r) {
+				x.unread()
+				x.state = stateWhitespace
+				return TokenKindComment, nil
+			}
+			x.append(r)
+			continue
+		}
+
 		// No matter what state the scanner is in, if the Escape rune
 		// is encountered it starts a new 2-rune escape token.
 		if x.escape {
@@ -296,6 +320,20 @@ func (x *Scanner) Scan() (kind TokenKind, err error) {
 			continue
 		}
 
+		// Outside of strings, the CommentStart rune starts a comment.
+		// Whitespace preceding the comment is included in its token.
+		if r == internal.CommentStart && x.state != stateString {
+			if x.state != stateWhitespace && x.token.Len() > 0 {
+				x.unread()
+				kind := primaryKind(x.state)
+				x.state = stateWhitespace
+				return kind, nil
+			}
+			x.state = stateComment
+			x.append(r)
+			continue
+		}
+
 		// Check if the current rune should start a single-rune token.
 		// These kinds of tokens are always equal to a specific rune.
 		if kind := singleRuneKind(r); kind != TokenKindUnassigned {
@@ -115,6 +115,28 @@ func TestScanner(t *testing.T) {
 				tokenStrMark,
 			},
 		},
+		{
+			name:  "comments",
+			input: "% top\n/dir % partition\n(1,% one\n\"% no\")%end",
+			tokens: []token{
+				{TokenKindComment, "% top"},
+				{TokenKindNewline, "\n"},
+				tokenDirSep,
+				{TokenKindOther, "dir"},
+				{TokenKindComment, " % partition"},
+				{TokenKindNewline, "\n"},
+				tokenTupStart,
+				{TokenKindOther, "1"},
+				tokenTupSep,
+				{TokenKindComment, "% one"},
+				{TokenKindNewline, "\n"},
+				tokenStrMark,
+				{TokenKindOther, "% no"},
+				tokenStrMark,
+				tokenTupEnd,
+				{TokenKindComment, "%end"},
+			},
+		},
 	}
 
 	for _, test := range tests {
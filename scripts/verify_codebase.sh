@@ -16,3 +16,7 @@ find . -type f -iname 'Dockerfile' -print0 | xargs -t -0 -n 1 hadolint
 go build ./...
 golangci-lint run ./...
 go test ./...
+
+# Run the engine's tests against the FDB cluster
+# instead of the in-memory implementation.
+go test ./engine/ ./engine/stream/ -args -fdb